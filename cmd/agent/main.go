@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"github.com/rshafikov/alertme/internal/agent"
 	"github.com/rshafikov/alertme/internal/agent/config"
 	"github.com/rshafikov/alertme/internal/agent/metrics"
+	"github.com/rshafikov/alertme/internal/agent/spool"
+	"github.com/rshafikov/alertme/internal/certs"
+	"github.com/rshafikov/alertme/internal/encryption"
 	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"log"
+	"net/http"
 	"net/url"
+	"syscall"
+	"time"
 )
 
 var (
@@ -23,14 +34,89 @@ func main() {
 	}
 	printBuildInfo()
 
-	baseURL, err := url.Parse("http://" + config.ServerAddress.String())
+	scheme := "http://"
+	var tlsConfig *tls.Config
+	if config.TLSEnabled() {
+		reloader, reloadErr := certs.NewReloader(config.TLSCert, config.TLSKey, config.TLSCA)
+		if reloadErr != nil {
+			log.Fatal(reloadErr)
+		}
+		go reloader.WatchSignals(context.Background(), syscall.SIGHUP)
+		tlsConfig = reloader.ClientConfig()
+		scheme = "https://"
+	}
+
+	baseURL, err := url.Parse(scheme + config.ServerAddress.String())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collectorConfigs, err := metrics.ParseCollectorConfigs(config.Collectors)
 	if err != nil {
 		log.Fatal(err)
 	}
+	collectors, err := metrics.DefaultRegistry(metrics.Options{
+		DiskInclude:     config.SplitList(config.DiskInclude),
+		DiskExclude:     config.SplitList(config.DiskExclude),
+		ProcessNames:    config.SplitList(config.ProcessNames),
+		ProcessPidfiles: config.SplitList(config.ProcessPidfiles),
+		StatsDAddress:   config.StatsDAddress,
+	}).Build(collectorConfigs, time.Duration(config.PollInterval)*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(collectors) == 0 {
+		log.Fatal("no collectors are enabled")
+	}
 
-	dc := metrics.NewEmptyDataCollector()
-	client := agent.NewClient(baseURL)
+	dc := metrics.NewDataCollector(collectors...)
+	hostInfo, err := agent.HostInfo(context.Background())
+	if err != nil {
+		logger.Log.Warn("unable to get host info", zap.Error(err))
+	}
+	if hostInfo != nil && hostInfo.Hostname == "" {
+		hostInfo = nil
+	}
+
+	httpClient := agent.NewClient(baseURL)
+	httpClient.HostInfo = hostInfo
+	if config.CryptoKey != "" {
+		httpClient.PublicKey, err = encryption.LoadPublicKey(config.CryptoKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if tlsConfig != nil {
+		httpClient.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}
+	}
+
+	var client agent.Sender = httpClient
+	if config.GRPCAddress != "" {
+		var grpcOpts []grpc.DialOption
+		if tlsConfig != nil {
+			grpcOpts = append(grpcOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		grpcClient, grpcErr := agent.NewGRPCClient(config.GRPCAddress, grpcOpts...)
+		if grpcErr != nil {
+			log.Fatal(grpcErr)
+		}
+		defer grpcClient.Close()
+		grpcClient.HostInfo = hostInfo
+		client = grpcClient
+	}
 	wp := agent.NewWorkerPool(config.RateLimit)
+	if config.SpoolDir != "" {
+		wp.Spool, err = spool.Open(config.SpoolDir, spool.Options{
+			MaxSize: config.SpoolMaxSize,
+			MaxAge:  time.Duration(config.SpoolMaxAge) * time.Second,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	app := agent.NewAgentApp(client, dc, wp)
 	app.Start()
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rshafikov/alertme/internal/encryption"
+)
+
+// keygenCommand is the name of the subcommand generating an RSA key pair.
+const keygenCommand = "keygen"
+
+// runKeygen generates an RSA key pair for payload encryption and writes it to files.
+// The private key is used by the server (-crypto-key), the public key is handed to agents.
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet(keygenCommand, flag.ContinueOnError)
+	bits := fs.Int("bits", encryption.DefaultKeyBits, "RSA key size in bits")
+	privPath := fs.String("private", "private.pem", "path to write the private key to")
+	pubPath := fs.String("public", "public.pem", "path to write the public key to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	privPEM, pubPEM, err := encryption.GenerateKeys(*bits)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(*privPath, privPEM, 0o600); err != nil {
+		return err
+	}
+	if err = os.WriteFile(*pubPath, pubPEM, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("private key: %s\npublic key: %s\n", *privPath, *pubPath)
+	return nil
+}
@@ -2,17 +2,36 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rshafikov/alertme/internal/certs"
+	"github.com/rshafikov/alertme/internal/encryption"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/audit"
+	"github.com/rshafikov/alertme/internal/server/auth"
 	"github.com/rshafikov/alertme/internal/server/database"
+	"github.com/rshafikov/alertme/internal/server/grpcserver"
+	"github.com/rshafikov/alertme/internal/server/history"
+	"github.com/rshafikov/alertme/internal/server/keys"
 	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/pubsub"
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+	"github.com/rshafikov/alertme/internal/server/replay"
 	"github.com/rshafikov/alertme/internal/server/routers/metrics"
 	"github.com/rshafikov/alertme/internal/server/settings"
 	"github.com/rshafikov/alertme/internal/server/storage"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"syscall"
 	"time"
 )
 
@@ -23,6 +42,13 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == keygenCommand {
+		if err := runKeygen(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	settings.InitServerConfiguration()
 
 	printBuildInfo()
@@ -46,11 +72,119 @@ func runServer() error {
 		}
 	}
 
-	metricsRouter := metrics.NewMetricsRouter(memStorage)
+	var store storage.BaseMetricStorage = memStorage
 
 	db, _ := setupDB(settings.CONF.DatabaseURL)
 	if db != nil {
-		metricsRouter = metrics.NewMetricsRouter(db)
+		store = db
+	}
+
+	hub := pubsub.NewHub(pubsub.DefaultBufferSize)
+	hist := history.NewHistory(history.DefaultSize)
+	publishingStore := storage.NewPublishingStorage(store, hub, hist)
+	rejections := middlewares.NewRejectionCounter()
+	replayWindow := time.Duration(settings.CONF.ReplayWindow) * time.Second
+	signatures := middlewares.HasherConfig{
+		Nonces:       replay.NewNonceCache(replayWindow, replay.DefaultCacheSize),
+		Strict:       settings.CONF.StrictSignatures,
+		RequireNonce: settings.CONF.RequireNonce,
+		Rejections:   rejections.Record,
+	}
+	var limiter *ratelimit.Limiter
+	if settings.CONF.RateLimit > 0 {
+		limiter = ratelimit.NewLimiter(settings.CONF.RateLimit, settings.CONF.RateBurst)
+	}
+	routerOpts := []metrics.RouterOption{
+		metrics.WithRejectionCounter(rejections),
+		metrics.WithHub(hub),
+		metrics.WithHistory(hist),
+		metrics.WithReplayWindow(replayWindow),
+		metrics.WithStrictSignatures(settings.CONF.StrictSignatures),
+		metrics.WithRequireNonce(settings.CONF.RequireNonce),
+		metrics.WithLimiter(limiter),
+		metrics.WithMaxBodySize(settings.CONF.MaxBodySize),
+		metrics.WithMaxIngestSize(settings.CONF.MaxIngestSize),
+		metrics.WithMaxBatchSize(settings.CONF.MaxBatchSize),
+	}
+
+	var subnet *net.IPNet
+	if settings.CONF.TrustedSubnet != "" {
+		_, ipNet, err := net.ParseCIDR(settings.CONF.TrustedSubnet)
+		if err != nil {
+			return err
+		}
+		subnet = ipNet
+		routerOpts = append(routerOpts, metrics.WithTrustedSubnet(subnet))
+	}
+
+	if settings.CONF.KeyRegistry != "" {
+		registry, err := setupKeyRegistry(settings.CONF.KeyRegistry, db)
+		if err != nil {
+			return err
+		}
+		signatures.Keys = registry
+		routerOpts = append(routerOpts, metrics.WithKeyRegistry(registry))
+	}
+
+	if settings.CONF.CryptoKey != "" {
+		privateKey, err := encryption.LoadPrivateKey(settings.CONF.CryptoKey)
+		if err != nil {
+			return err
+		}
+		routerOpts = append(routerOpts, metrics.WithPrivateKey(privateKey))
+	}
+
+	var tokens *auth.Tokens
+	if settings.CONF.AuthTokens != "" {
+		var err error
+		tokens, err = auth.NewFileTokens(settings.CONF.AuthTokens)
+		if err != nil {
+			return err
+		}
+		go tokens.WatchSignals(context.Background(), syscall.SIGHUP)
+		routerOpts = append(routerOpts, metrics.WithTokens(tokens))
+	}
+
+	auditor, err := setupAuditor(settings.CONF.AuditFile, settings.CONF.AuditURL)
+	if err != nil {
+		return err
+	}
+	if auditor != nil {
+		defer auditor.Close()
+		routerOpts = append(routerOpts, metrics.WithAuditor(auditor))
+	}
+
+	agentRegistry := agents.NewRegistry()
+	routerOpts = append(routerOpts, metrics.WithAgents(agentRegistry))
+
+	metricsRouter := metrics.NewMetricsRouter(publishingStore, routerOpts...)
+
+	var tlsConfig *tls.Config
+	if settings.CONF.TLSCert != "" {
+		reloader, err := certs.NewReloader(settings.CONF.TLSCert, settings.CONF.TLSKey, settings.CONF.TLSClientCA)
+		if err != nil {
+			return err
+		}
+		go reloader.WatchSignals(context.Background(), syscall.SIGHUP)
+		tlsConfig = reloader.ServerConfig()
+	}
+
+	if settings.CONF.GRPCAddress != "" {
+		lis, err := net.Listen("tcp", settings.CONF.GRPCAddress)
+		if err != nil {
+			return err
+		}
+		cfg := grpcserver.Config{
+			Signatures:   signatures,
+			Limiter:      limiter,
+			MaxBatchSize: settings.CONF.MaxBatchSize,
+			Auditor:      auditor,
+		}
+		cfg.MaxMessageSize = math.MaxInt32
+		if settings.CONF.MaxBodySize > 0 && settings.CONF.MaxBodySize < math.MaxInt32 {
+			cfg.MaxMessageSize = int(settings.CONF.MaxBodySize)
+		}
+		go startGRPCServer(lis, publishingStore, cfg, agentRegistry, tlsConfig, subnet, tokens)
 	}
 
 	if settings.CONF.StoreInterval > 0 && db == nil {
@@ -59,7 +193,45 @@ func runServer() error {
 		}
 	}
 
-	return startServer(metricsRouter)
+	return startServer(metricsRouter, tlsConfig, tokens)
+}
+
+// setupKeyRegistry returns the database as the key registry, or a registry loaded from the file,
+// which is reloaded on SIGHUP.
+func setupKeyRegistry(source string, db *database.DB) (keys.Registry, error) {
+	if source == settings.KeyRegistryDB {
+		if db == nil {
+			return nil, errors.New("database key registry requires a database")
+		}
+		return db, nil
+	}
+
+	registry, err := keys.NewFileRegistry(source)
+	if err != nil {
+		return nil, err
+	}
+	go registry.WatchSignals(context.Background(), syscall.SIGHUP)
+	return registry, nil
+}
+
+// setupAuditor returns an auditor delivering to the file and the URL, whichever are set,
+// or nil if neither is.
+func setupAuditor(path, url string) (*audit.Auditor, error) {
+	var sinks []audit.Sink
+	if path != "" {
+		sink, err := audit.NewFileSink(path)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if url != "" {
+		sinks = append(sinks, audit.NewHTTPSink(url, nil))
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return audit.NewAuditor(audit.DefaultQueueSize, sinks...), nil
 }
 
 func restoreStorage(fileSaver *storage.FileSaver) error {
@@ -91,16 +263,49 @@ func setupDB(dbURL string) (*database.DB, error) {
 	return db, nil
 }
 
-func startServer(mR *metrics.Router) error {
+// startServer serves the HTTP API, over TLS if the configuration is not nil.
+// The profiling endpoint requires the admin role if tokens are configured.
+func startServer(mR *metrics.Router, tlsConfig *tls.Config, tokens *auth.Tokens) error {
 	r := chi.NewRouter()
 	r.Mount("/", mR.Routes())
 
 	if settings.CONF.Profiling {
 		logger.Log.Info("profiling enabled")
-		r.Mount("/debug", middleware.Profiler())
+		r.Route("/debug", func(r chi.Router) {
+			r.Use(middlewares.RequireRole(tokens, auth.RoleAdmin))
+			r.Mount("/", middleware.Profiler())
+		})
+	}
+
+	if tlsConfig == nil {
+		return http.ListenAndServe(settings.CONF.ServerAddress.String(), r)
 	}
 
-	return http.ListenAndServe(settings.CONF.ServerAddress.String(), r)
+	srv := &http.Server{
+		Addr:      settings.CONF.ServerAddress.String(),
+		Handler:   r,
+		TLSConfig: tlsConfig,
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+func startGRPCServer(lis net.Listener, store storage.BaseMetricStorage, cfg grpcserver.Config, agentRegistry *agents.Registry, tlsConfig *tls.Config, subnet *net.IPNet, tokens *auth.Tokens) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcserver.AuthUnaryInterceptor(tokens)),
+		grpc.ChainStreamInterceptor(
+			grpcserver.AuthStreamInterceptor(tokens),
+			grpcserver.TrustedSubnetStreamInterceptor(subnet),
+			grpcserver.AgentInfoStreamInterceptor(agentRegistry),
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	logger.Log.Info("starting gRPC server", zap.String("address", lis.Addr().String()))
+	if err := grpcserver.NewServer(store, cfg, opts...).Serve(lis); err != nil {
+		logger.Log.Error("gRPC server stopped", zap.Error(err))
+	}
 }
 
 func printBuildInfo() {
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"github.com/rshafikov/alertme/internal/agent/config"
 	"github.com/rshafikov/alertme/internal/agent/metrics"
 	"github.com/rshafikov/alertme/internal/server/logger"
@@ -15,15 +16,18 @@ import (
 
 const profilingServerAddress = ":8888"
 
+// shutdownTimeout is the time the agent waits on shutdown for the final metrics to be sent.
+const shutdownTimeout = 10 * time.Second
+
 // App represents the agent application that collects and sends metrics.
 type App struct {
-	Client        *Client
+	Client        Sender
 	DataCollector *metrics.DataCollector
 	WorkerPool    *WorkerPool
 }
 
 // NewAgentApp creates a new agent application with the provided client, data collector, and worker pool.
-func NewAgentApp(client *Client, dc *metrics.DataCollector, pool *WorkerPool) *App {
+func NewAgentApp(client Sender, dc *metrics.DataCollector, pool *WorkerPool) *App {
 	return &App{
 		Client:        client,
 		DataCollector: dc,
@@ -33,7 +37,7 @@ func NewAgentApp(client *Client, dc *metrics.DataCollector, pool *WorkerPool) *A
 
 // Start begins the agent's operation, collecting and sending metrics at regular intervals.
 // It sets up profiling if enabled, initializes tickers for polling and reporting,
-// and handles graceful shutdown on interrupt signals.
+// and handles graceful shutdown on interrupt signals, sending the metrics collected so far before it returns.
 func (app *App) Start() {
 	if config.Profiling {
 		logger.Log.Info("starting pprof server")
@@ -45,18 +49,17 @@ func (app *App) Start() {
 		}()
 	}
 
-	pollTicker := time.NewTicker(time.Duration(config.PollInterval) * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	sendTicker := time.NewTicker(time.Duration(config.ReportInterval) * time.Second)
 	shutdown := make(chan os.Signal, 1)
 
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
-	defer func() {
-		pollTicker.Stop()
-		sendTicker.Stop()
-	}()
+	defer sendTicker.Stop()
 
-	go app.DataCollector.CollectMetrics(pollTicker)
+	go app.DataCollector.CollectMetrics(ctx)
 	go app.DataCollector.SendMetrics(sendTicker, app.WorkerPool.JobsCh)
 	go app.handleResults()
 
@@ -65,11 +68,29 @@ func (app *App) Start() {
 	}
 
 	<-shutdown
-	logger.Log.Info("received shutdown signal, stopping workers...")
+	logger.Log.Info("received shutdown signal, sending the final metrics...")
+	cancel()
+	sendTicker.Stop()
+	app.shutdown()
+
+	logger.Log.Info("stopping workers...")
 	app.WorkerPool.Stop()
 	time.Sleep(300 * time.Millisecond)
 }
 
+// shutdown closes the collectors, e.g. the listener of the StatsD collector, and sends the metrics
+// not sent yet, including the counters the collectors received since their previous collection,
+// as the final batches, waiting for the workers to send them for up to shutdownTimeout.
+func (app *App) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := app.DataCollector.Close(ctx); err != nil {
+		logger.Log.Error("unable to close collectors", zap.Error(err))
+	}
+	app.DataCollector.Flush(ctx, app.WorkerPool.JobsCh)
+}
+
 func (app *App) handleResults() {
 	for r := range app.WorkerPool.ResultCh {
 		if r.Err != nil {
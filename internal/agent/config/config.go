@@ -28,6 +28,30 @@ func InitAgentConfiguration() {
 			PollInterval = Env.PollIntrv
 		}
 
+		if Env.Collectors != "" {
+			Collectors = Env.Collectors
+		}
+
+		if Env.DiskInclude != "" {
+			DiskInclude = Env.DiskInclude
+		}
+
+		if Env.DiskExclude != "" {
+			DiskExclude = Env.DiskExclude
+		}
+
+		if Env.ProcNames != "" {
+			ProcessNames = Env.ProcNames
+		}
+
+		if Env.ProcPids != "" {
+			ProcessPidfiles = Env.ProcPids
+		}
+
+		if Env.StatsDAddr != "" {
+			StatsDAddress = Env.StatsDAddr
+		}
+
 		if Env.LogLevel != "" {
 			LogLevel = Env.LogLevel
 		}
@@ -35,22 +59,110 @@ func InitAgentConfiguration() {
 		if Env.Key != "" {
 			Key = Env.Key
 		}
+
+		if Env.KeyID != "" {
+			KeyID = Env.KeyID
+		}
+
+		if Env.AuthToken != "" {
+			AuthToken = Env.AuthToken
+		}
+
+		if Env.GRPCAddr != "" {
+			GRPCAddress = Env.GRPCAddr
+		}
+
+		if Env.CryptoKey != "" {
+			CryptoKey = Env.CryptoKey
+		}
+
+		if Env.TLSCA != "" {
+			TLSCA = Env.TLSCA
+		}
+
+		if Env.TLSCert != "" {
+			TLSCert = Env.TLSCert
+		}
+
+		if Env.TLSKey != "" {
+			TLSKey = Env.TLSKey
+		}
+
+		if Env.SpoolDir != "" {
+			SpoolDir = Env.SpoolDir
+		}
+
+		if Env.SpoolSize > 0 {
+			SpoolMaxSize = Env.SpoolSize
+		}
+
+		if Env.SpoolAge > 0 {
+			SpoolMaxAge = Env.SpoolAge
+		}
 	}
 
 	initMessage := "\033[1;36m╭────────────────────────────────────────\033[0m\n" +
 		"\033[1;36m│ \033[1;34m🚀 Agent Initialized Successfully \033[1;36m\033[0m\n" +
 		"\033[1;36m├────────────────────────────────────────\033[0m\n" +
 		"\033[1;36m│ \033[1;33m📡 Server Address:   \033[0;37m%-47s \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📡 gRPC Address:     \033[0;37m%-47s \033[1;36m\033[0m\n" +
 		"\033[1;36m│ \033[1;33m⏱  Report Interval:  \033[0;37m%-47d \033[1;36m\033[0m\n" +
 		"\033[1;36m│ \033[1;33m⏱  Poll Interval:    \033[0;37m%-47d \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📊 Collectors:       \033[0;37m%-47s \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📥 StatsD:           \033[0;37m%-47s \033[1;36m\033[0m\n" +
 		"\033[1;36m│ \033[1;33m🔐 Hash Key:         \033[0;37m%-47s \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🎫 Auth Token:       \033[0;37m%-47s \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🔑 Crypto Key:       \033[0;37m%-47s \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🔒 TLS:              \033[0;37m%-47s \033[1;36m\033[0m\n" +
+		"\033[1;36m│ \033[1;33m💾 Spool:            \033[0;37m%-47s \033[1;36m\033[0m\n" +
 		"\033[1;36m│ \033[1;33m📝 Logging Level:    \033[0;37m%-47s \033[1;36m\033[0m\n" +
 		"\033[1;36m│ \033[1;33m📝 Rate Limit:       \033[0;37m%-47v \033[1;36m\033[0m\n" +
 		"\033[1;36m╰────────────────────────────────────────\033[0m\n"
 
+	collectorsInitMessage := "default"
+	if Collectors != "" {
+		collectorsInitMessage = Collectors
+	}
+
+	statsdInitMessage := "-----"
+	if StatsDAddress != "" {
+		statsdInitMessage = StatsDAddress
+	}
+
 	keyInitMessage := "-----"
 	if Key != "" {
 		keyInitMessage = "********"
+		if KeyID != "" {
+			keyInitMessage += " (" + KeyID + ")"
+		}
+	}
+
+	authTokenInitMessage := "-----"
+	if AuthToken != "" {
+		authTokenInitMessage = "********"
+	}
+
+	cryptoKeyInitMessage := "-----"
+	if CryptoKey != "" {
+		cryptoKeyInitMessage = CryptoKey
+	}
+
+	tlsInitMessage := "-----"
+	if TLSEnabled() {
+		tlsInitMessage = "enabled"
+		if TLSCert != "" {
+			tlsInitMessage = "mutual"
+		}
+	}
+
+	grpcInitMessage := "-----"
+	if GRPCAddress != "" {
+		grpcInitMessage = GRPCAddress
+	}
+
+	spoolInitMessage := "-----"
+	if SpoolDir != "" {
+		spoolInitMessage = fmt.Sprintf("%s (%d bytes, %ds)", SpoolDir, SpoolMaxSize, SpoolMaxAge)
 	}
 
 	rateLimitInitMessage := "-----"
@@ -61,9 +173,16 @@ func InitAgentConfiguration() {
 	fmt.Printf(
 		initMessage,
 		ServerAddress.String(),
+		grpcInitMessage,
 		ReportInterval,
 		PollInterval,
+		collectorsInitMessage,
+		statsdInitMessage,
 		keyInitMessage,
+		authTokenInitMessage,
+		cryptoKeyInitMessage,
+		tlsInitMessage,
+		spoolInitMessage,
 		LogLevel,
 		rateLimitInitMessage,
 	)
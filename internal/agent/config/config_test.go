@@ -3,6 +3,7 @@ package config
 import (
 	"net"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -98,4 +99,22 @@ func TestInitAgentConfiguration(t *testing.T) {
 	if RateLimit != 10 {
 		t.Errorf("Expected RateLimit to be 10, got %d", RateLimit)
 	}
-}
\ No newline at end of file
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []string
+	}{
+		{list: "", expected: nil},
+		{list: "/", expected: []string{"/"}},
+		{list: " /, /var/* ,,", expected: []string{"/", "/var/*"}},
+	}
+	for _, test := range tests {
+		t.Run(test.list, func(t *testing.T) {
+			if got := SplitList(test.list); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -10,9 +10,25 @@ type envConfig struct {
 	LogLevel    string `env:"LOG_LEVEL"`
 	SrvAddr     string `env:"ADDRESS"`
 	Key         string `env:"KEY"`
+	KeyID       string `env:"KEY_ID"`
+	AuthToken   string `env:"AUTH_TOKEN"`
 	ReportIntrv int    `env:"REPORT_INTERVAL"`
 	PollIntrv   int    `env:"POLL_INTERVAL"`
+	Collectors  string `env:"COLLECTORS"`
+	DiskInclude string `env:"DISK_INCLUDE"`
+	DiskExclude string `env:"DISK_EXCLUDE"`
+	ProcNames   string `env:"PROCESS_NAMES"`
+	ProcPids    string `env:"PROCESS_PIDFILES"`
+	StatsDAddr  string `env:"STATSD_ADDRESS"`
 	RateLimit   int    `env:"RATE_LIMIT"`
+	GRPCAddr    string `env:"GRPC_ADDRESS"`
+	CryptoKey   string `env:"CRYPTO_KEY"`
+	TLSCA       string `env:"TLS_CA"`
+	TLSCert     string `env:"TLS_CERT"`
+	TLSKey      string `env:"TLS_KEY"`
+	SpoolDir    string `env:"SPOOL_DIR"`
+	SpoolSize   int64  `env:"SPOOL_MAX_SIZE"`
+	SpoolAge    int    `env:"SPOOL_MAX_AGE"`
 }
 
 // Env holds the configuration values loaded from environment variables.
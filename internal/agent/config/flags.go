@@ -6,6 +6,7 @@ import (
 	"log"
 	"net"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -16,6 +17,8 @@ const (
 	defaultLogLevel       = "info"
 	defaultRateLimit      = 2
 	defaultProfiling      = false
+	defaultSpoolMaxSize   = 64 << 20
+	defaultSpoolMaxAge    = 24 * 60 * 60
 )
 
 type netAddress struct {
@@ -50,27 +53,116 @@ var ReportInterval int
 // PollInterval is the interval in seconds between collecting metrics.
 var PollInterval int
 
+// Collectors enables or disables collectors and sets their intervals,
+// e.g. "runtime=5,psutil=off". Collectors run every PollInterval unless set otherwise.
+var Collectors string
+
+// DiskInclude is a comma-separated list of patterns of mount points reported by the disk collector.
+// All mount points are reported if it is empty.
+var DiskInclude string
+
+// DiskExclude is a comma-separated list of patterns of mount points not reported by the disk collector.
+var DiskExclude string
+
+// ProcessNames is a comma-separated list of names of the processes reported by the process collector.
+var ProcessNames string
+
+// ProcessPidfiles is a comma-separated list of pidfiles of the processes reported by the process collector.
+var ProcessPidfiles string
+
+// StatsDAddress is the UDP address the agent listens on for metrics pushed by applications in the StatsD format.
+// The listener is disabled if it is empty.
+var StatsDAddress string
+
 // LogLevel determines the verbosity of logging.
 var LogLevel string
 
 // Key is used to sign the metrics data for security.
 var Key string
 
+// KeyID identifies Key in the server key registry.
+// It is sent along with signed data, so the server can verify it with the agent's own key.
+var KeyID string
+
+// AuthToken is the bearer token sent to the server, which must grant the writer role.
+var AuthToken string
+
 // RateLimit controls the maximum number of concurrent workers.
 var RateLimit int
 
+// GRPCAddress is the address of the gRPC metrics server.
+// Metrics are sent over HTTP if it is empty.
+var GRPCAddress string
+
+// CryptoKey is the path to the server's public key used to encrypt sent data.
+// Data is sent unencrypted if it is empty.
+var CryptoKey string
+
+// TLSCA is the path to the CA bundle verifying the server certificate.
+// The system roots are used if it is empty.
+var TLSCA string
+
+// TLSCert is the path to the client certificate presented to the server.
+var TLSCert string
+
+// TLSKey is the path to the private key of the client certificate.
+var TLSKey string
+
+// SpoolDir is the directory where batches that cannot be sent are kept until the server is reachable.
+// Such batches are dropped if it is empty.
+var SpoolDir string
+
+// SpoolMaxSize is the maximum size of the spool in bytes; the oldest batches are dropped beyond it.
+var SpoolMaxSize int64
+
+// SpoolMaxAge is the age in seconds after which spooled batches are dropped.
+var SpoolMaxAge int
+
 // Profiling enables the pprof profiling server when true.
 var Profiling bool
 
+// TLSEnabled reports whether metrics are sent over HTTPS.
+// HTTPS is used as soon as a CA bundle or a client certificate is configured.
+func TLSEnabled() bool {
+	return TLSCA != "" || TLSCert != ""
+}
+
+// SplitList splits a comma-separated list, dropping surrounding spaces and empty items.
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // InitAgentFlags initializes command-line flags for the agent configuration.
 // It sets default values and validates the provided values.
 func InitAgentFlags() {
 	flag.Var(&ServerAddress, "a", "server address")
 	flag.IntVar(&ReportInterval, "r", defaultReportInterval, "report interval")
 	flag.IntVar(&PollInterval, "p", defaultPollInterval, "poll interval")
+	flag.StringVar(&Collectors, "collectors", "", `collectors to enable or disable and their intervals in seconds, e.g. "runtime=5,psutil=off"`)
+	flag.StringVar(&DiskInclude, "disk-include", "", `comma-separated patterns of mount points to report disk usage of, e.g. "/,/var/*", all if empty`)
+	flag.StringVar(&DiskExclude, "disk-exclude", "", `comma-separated patterns of mount points not to report disk usage of, e.g. "/mnt/*"`)
+	flag.StringVar(&ProcessNames, "process-names", "", `comma-separated names of processes to report metrics of, e.g. "nginx,postgres"`)
+	flag.StringVar(&ProcessPidfiles, "process-pidfiles", "", "comma-separated pidfiles of processes to report metrics of")
+	flag.StringVar(&StatsDAddress, "statsd-address", "", `UDP address to receive StatsD metrics on, e.g. "127.0.0.1:8125", disabled if empty`)
 	flag.StringVar(&LogLevel, "v", defaultLogLevel, "log level")
 	flag.StringVar(&Key, "k", "", "key to sign sending data")
+	flag.StringVar(&KeyID, "key-id", "", "ID of the signing key in the server key registry")
+	flag.StringVar(&AuthToken, "auth-token", "", "bearer token to authenticate to the server")
 	flag.IntVar(&RateLimit, "l", defaultRateLimit, "rate limit")
+	flag.StringVar(&GRPCAddress, "g", "", "gRPC server address, metrics are sent over HTTP if empty")
+	flag.StringVar(&CryptoKey, "crypto-key", "", "path to the server public key to encrypt sending data")
+	flag.StringVar(&TLSCA, "tls-ca", "", "path to the CA bundle to verify the server certificate")
+	flag.StringVar(&TLSCert, "tls-cert", "", "path to the client TLS certificate")
+	flag.StringVar(&TLSKey, "tls-key", "", "path to the client TLS private key")
+	flag.StringVar(&SpoolDir, "spool-dir", "", "directory to keep metrics that cannot be sent in, they are dropped if empty")
+	flag.Int64Var(&SpoolMaxSize, "spool-max-size", defaultSpoolMaxSize, "maximum size of the spool in bytes")
+	flag.IntVar(&SpoolMaxAge, "spool-max-age", defaultSpoolMaxAge, "age in seconds after which spooled metrics are dropped")
 	flag.BoolVar(&Profiling, "pprof", defaultProfiling, "enable pprof web-server")
 	flag.Parse()
 
@@ -81,4 +173,16 @@ func InitAgentFlags() {
 	if PollInterval <= 0 {
 		log.Fatal("poll interval cannot be negative or null")
 	}
+
+	if SpoolMaxSize <= 0 {
+		log.Fatal("spool max size must be positive")
+	}
+
+	if SpoolMaxAge <= 0 {
+		log.Fatal("spool max age must be positive")
+	}
+
+	if (TLSCert == "") != (TLSKey == "") {
+		log.Fatal("both client certificate and key must be set")
+	}
 }
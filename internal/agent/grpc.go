@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/agent/config"
+	"github.com/rshafikov/alertme/internal/proto"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/retry"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClient represents a gRPC client for sending metrics to the server.
+type GRPCClient struct {
+	conn    *grpc.ClientConn
+	client  proto.MetricsClient
+	address string
+	// HostInfo is the host metadata sent as "agent-*" metadata on the first stream,
+	// and again once the server is reachable after a failed send. Nothing is sent if it is nil.
+	HostInfo *agents.Info
+	infoSent atomic.Bool
+}
+
+// NewGRPCClient creates a new gRPC client for the server at the provided address.
+// The connection is established lazily on the first call. Insecure credentials
+// are used unless the options provide other transport credentials.
+func NewGRPCClient(address string, opts ...grpc.DialOption) (*GRPCClient, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.NewClient(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{
+		conn:    conn,
+		client:  proto.NewMetricsClient(conn),
+		address: address,
+	}, nil
+}
+
+// SendData sends the provided metrics to the server over the UpdateMetrics stream.
+// It uses retries with exponential backoff while the server is unavailable.
+// Returns an error if the metrics cannot be sent after all retries.
+func (c *GRPCClient) SendData(metrics []*models.Metric) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := retry.OnErr(ctx, []error{ErrUnableToSendMetrics}, sendRetryIntervals,
+		func(args ...any) error {
+			return c.sendMetrics(ctx, metrics)
+		},
+	)
+	// The server may have been restarted meanwhile, so the host metadata is sent again.
+	if errors.Is(err, ErrUnableToSendMetrics) {
+		c.infoSent.Store(false)
+	}
+	return err
+}
+
+// Close closes the underlying connection.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCClient) sendMetrics(ctx context.Context, metrics []*models.Metric) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	req := &proto.UpdateMetricsRequest{Metrics: proto.FromModels(metrics)}
+	if config.Key != "" {
+		nonce, err := newNonce()
+		if err != nil {
+			logger.Log.Error("failed to generate nonce:", zap.Error(err))
+			return err
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		// The request is the only message of the stream.
+		if err = req.SignAt(config.Key, timestamp, nonce, 0); err != nil {
+			logger.Log.Error("failed to sign metrics:", zap.Error(err))
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, proto.TimestampMetadataKey, timestamp, proto.NonceMetadataKey, nonce)
+		if config.KeyID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, proto.KeyIDMetadataKey, config.KeyID)
+		}
+	}
+
+	if ip, ipErr := OutboundIP(c.address); ipErr == nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, proto.RealIPMetadataKey, ip.String())
+	} else {
+		logger.Log.Warn("unable to determine outbound address", zap.Error(ipErr))
+	}
+
+	if config.AuthToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, proto.AuthorizationMetadataKey, "Bearer "+config.AuthToken)
+	}
+
+	sendInfo := c.HostInfo != nil && !c.infoSent.Load()
+	if sendInfo {
+		ctx = metadata.AppendToOutgoingContext(ctx, c.HostInfo.Pairs()...)
+	}
+
+	stream, err := c.client.UpdateMetrics(ctx)
+	if err != nil {
+		return handleGRPCErr(err)
+	}
+
+	// On io.EOF the server has closed the stream, the actual error is returned by CloseAndRecv.
+	if err = stream.Send(req); err != nil && !errors.Is(err, io.EOF) {
+		return handleGRPCErr(err)
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return handleGRPCErr(err)
+	}
+
+	if sendInfo {
+		c.infoSent.Store(true)
+	}
+	logger.Log.Debug("metrics sent over gRPC", zap.Int64("accepted", resp.GetAccepted()))
+	return nil
+}
+
+// handleGRPCErr maps transient gRPC errors to ErrUnableToSendMetrics, so they are retried,
+// and InvalidArgument, which the server refuses the content of the metrics with, to ErrMetricsRejected.
+func handleGRPCErr(err error) error {
+	code := status.Code(err)
+	logger.Log.Error(
+		"unable to send metrics",
+		zap.String("code", code.String()),
+		zap.Error(err),
+	)
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unauthenticated, codes.PermissionDenied:
+		return ErrUnableToSendMetrics
+	case codes.InvalidArgument:
+		return fmt.Errorf("%w: %w", ErrMetricsRejected, err)
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/agent/config"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/grpcserver"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/settings"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCClient_SendData(t *testing.T) {
+	originalAgentKey := config.Key
+	originalServerKey := settings.CONF.Key
+	defer func() {
+		config.Key = originalAgentKey
+		settings.CONF.Key = originalServerKey
+	}()
+	config.Key = "testkey"
+	settings.CONF.Key = "testkey"
+
+	store := storage.NewMemStorage()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpcserver.NewServer(store, grpcserver.Config{})
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	client, err := NewGRPCClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	defer client.Close()
+
+	value := 1.5
+	delta := int64(2)
+	err = client.SendData([]*models.Metric{
+		{Name: "grpc_g", Type: models.GaugeType, Value: &value},
+		{Name: "grpc_c", Type: models.CounterType, Delta: &delta},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if got := len(store.List(context.Background())); got != 2 {
+		t.Errorf("Expected 2 stored metrics, got %d", got)
+	}
+
+	config.Key = "wrongkey"
+	err = client.SendData([]*models.Metric{{Name: "grpc_g", Type: models.GaugeType, Value: &value}})
+	if err == nil {
+		t.Error("Expected error for wrongly signed metrics, got nil")
+	}
+}
+
+func TestGRPCClient_SendDataHostInfo(t *testing.T) {
+	registry := agents.NewRegistry()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpcserver.NewServer(storage.NewMemStorage(), grpcserver.Config{},
+		grpc.ChainStreamInterceptor(grpcserver.AgentInfoStreamInterceptor(registry)),
+	)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	client, err := NewGRPCClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	defer client.Close()
+	client.HostInfo = &agents.Info{Hostname: "web", OS: "linux", KernelVersion: "6.1.0"}
+
+	value := 1.5
+	if err = client.SendData([]*models.Metric{{Name: "grpc_g", Type: models.GaugeType, Value: &value}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	listed := registry.List()
+	if len(listed) != 1 || listed[0].Hostname != "web" || listed[0].KernelVersion != "6.1.0" {
+		t.Errorf("Expected host info of web to be recorded, got %+v", listed)
+	}
+	if !client.infoSent.Load() {
+		t.Error("Expected host info to be marked as sent")
+	}
+}
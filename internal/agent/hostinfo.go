@@ -0,0 +1,24 @@
+package agent
+
+import (
+	"context"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// HostInfo returns the metadata of the host the agent runs on: the hostname, the operating system
+// and the kernel. It may return the metadata it managed to read along with an error.
+func HostInfo(ctx context.Context) (*agents.Info, error) {
+	info, err := host.InfoWithContext(ctx)
+	if info == nil {
+		return nil, err
+	}
+	return &agents.Info{
+		Hostname:        info.Hostname,
+		OS:              info.OS,
+		Platform:        info.Platform,
+		PlatformVersion: info.PlatformVersion,
+		KernelVersion:   info.KernelVersion,
+		KernelArch:      info.KernelArch,
+	}, err
+}
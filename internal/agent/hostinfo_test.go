@@ -0,0 +1,16 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHostInfo(t *testing.T) {
+	info, err := HostInfo(context.Background())
+	if info == nil {
+		t.Fatalf("Expected host info, got error %v", err)
+	}
+	if info.Hostname == "" || info.OS == "" {
+		t.Errorf("Expected hostname and OS to be set, got %+v", info)
+	}
+}
@@ -5,26 +5,54 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/rshafikov/alertme/internal/agent/config"
+	"github.com/rshafikov/alertme/internal/encryption"
+	"github.com/rshafikov/alertme/internal/server/agents"
 	"github.com/rshafikov/alertme/internal/server/logger"
 	"github.com/rshafikov/alertme/internal/server/models"
 	"github.com/rshafikov/alertme/internal/server/retry"
+	"github.com/rshafikov/alertme/internal/signature"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
-// ErrUnableToSendMetrics is returned when metrics cannot be sent to the server.
-var ErrUnableToSendMetrics = errors.New("unable to send metrics")
+var (
+	// ErrUnableToSendMetrics is returned when metrics cannot be sent to the server for now,
+	// e.g. because it is unreachable or fails with a 5xx error. Such sends are retried.
+	ErrUnableToSendMetrics = errors.New("unable to send metrics")
+	// ErrMetricsRejected is returned when the server refuses the content of the metrics,
+	// with 400 Bad Request or 413 Request Entity Too Large. Sending them again would fail the same way,
+	// so such sends are neither retried nor spooled.
+	ErrMetricsRejected = errors.New("metrics rejected by the server")
+)
+
+// sendRetryIntervals defines the time intervals between attempts to send metrics.
+var sendRetryIntervals = []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
 
 // Client represents an HTTP client for sending metrics to the server.
 type Client struct {
 	URL *url.URL
+	// PublicKey is the server's public key. If set, request bodies are encrypted with it.
+	PublicKey *rsa.PublicKey
+	// HTTPClient is used to send requests, e.g. with a TLS configuration.
+	// http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+	// HostInfo is the host metadata sent to the server before the first metrics,
+	// and again once the server is reachable after a failed send. Nothing is sent if it is nil.
+	HostInfo *agents.Info
+	infoSent atomic.Bool
 }
 
 // NewClient creates a new client with the provided server URL.
@@ -32,21 +60,26 @@ func NewClient(serverURL *url.URL) *Client {
 	return &Client{URL: serverURL}
 }
 
-// SendData sends the provided metrics to the server.
+// SendData sends the provided metrics to the server, preceded by the host metadata
+// if it has not been sent yet.
 // It uses retries with exponential backoff in case of failures.
 // Returns an error if the metrics cannot be sent after all retries.
 func (c *Client) SendData(metrics []*models.Metric) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := retry.OnErr(ctx, []error{ErrUnableToSendMetrics}, []time.Duration{
-		1 * time.Second, 3 * time.Second, 5 * time.Second},
+	c.sendHostInfo(ctx)
+	err := retry.OnErr(ctx, []error{ErrUnableToSendMetrics}, sendRetryIntervals,
 		func(args ...any) error {
 			return c.sendMetrics(ctx, metrics)
 		},
 	)
 
 	if err != nil {
+		// The server may have been restarted meanwhile, so the host metadata is sent again.
+		if errors.Is(err, ErrUnableToSendMetrics) {
+			c.infoSent.Store(false)
+		}
 		return err
 	}
 	return nil
@@ -63,43 +96,138 @@ func (c *Client) sendMetrics(ctx context.Context, metric []*models.Metric) error
 		return err
 	}
 
-	gzipData, err := c.compressData(jsonBody)
+	req, err := c.newRequest(ctx, "/updates/", jsonBody)
 	if err != nil {
-		logger.Log.Error("failed to compress metric:", zap.Error(err))
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL.String()+"/updates/", gzipData)
-	if err != nil {
-		logger.Log.Error("failed to create request:", zap.Error(err))
-		return err
-	}
-
-	if config.Key != "" {
-		hash := c.hashData(jsonBody)
-		req.Header.Set("HashSHA256", hash)
-		logger.Log.Info("hash:", zap.String("hash", hash))
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
 		logger.Log.Error("failed to send request:", zap.Error(err))
 		return ErrUnableToSendMetrics
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		err = statusErr(resp.StatusCode)
 		logger.Log.Error(
 			"unable to send metrics",
 			zap.Int("response_code", resp.StatusCode),
-			zap.Error(ErrUnableToSendMetrics),
+			zap.Error(err),
 		)
-		return ErrUnableToSendMetrics
+		return err
+	}
+	return nil
+}
+
+// statusErr returns ErrMetricsRejected for the status codes the server refuses the content of the metrics with,
+// and ErrUnableToSendMetrics for the others, e.g. 5xx, or 401 and 403 until the key or the token is fixed.
+func statusErr(code int) error {
+	if code == http.StatusBadRequest || code == http.StatusRequestEntityTooLarge {
+		return fmt.Errorf("%w: %d %s", ErrMetricsRejected, code, http.StatusText(code))
+	}
+	return fmt.Errorf("%w: %d %s", ErrUnableToSendMetrics, code, http.StatusText(code))
+}
+
+// sendHostInfo sends the host metadata to the server, unless it has already been sent on this connection.
+// Failures are logged and do not prevent the metrics from being sent; if the server is unreachable,
+// the metadata is sent again with the next metrics. Servers without the /agents/info route ignore it.
+func (c *Client) sendHostInfo(ctx context.Context) {
+	if c.HostInfo == nil || !c.infoSent.CompareAndSwap(false, true) {
+		return
+	}
+
+	jsonBody, err := json.Marshal(c.HostInfo)
+	if err != nil {
+		logger.Log.Error("failed to serialize host info:", zap.Error(err))
+		return
 	}
 
+	req, err := c.newRequest(ctx, "/agents/info", jsonBody)
+	if err != nil {
+		return
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		c.infoSent.Store(false)
+		logger.Log.Warn("unable to send host info", zap.Error(err))
+		return
+	}
 	defer resp.Body.Close()
-	return nil
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Log.Warn("host info was not accepted", zap.Int("response_code", resp.StatusCode))
+	}
+}
+
+// newRequest creates a POST request to the server path with the JSON body compressed, encrypted
+// with the server's public key if set, and signed with the key if configured.
+func (c *Client) newRequest(ctx context.Context, path string, jsonBody []byte) (*http.Request, error) {
+	gzipData, err := c.compressData(jsonBody)
+	if err != nil {
+		logger.Log.Error("failed to compress request body:", zap.Error(err))
+		return nil, err
+	}
+
+	var body io.Reader = gzipData
+	if c.PublicKey != nil {
+		encrypted, encErr := encryption.Encrypt(c.PublicKey, gzipData.Bytes())
+		if encErr != nil {
+			logger.Log.Error("failed to encrypt request body:", zap.Error(encErr))
+			return nil, encErr
+		}
+		body = bytes.NewReader(encrypted)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL.String()+path, body)
+	if err != nil {
+		logger.Log.Error("failed to create request:", zap.Error(err))
+		return nil, err
+	}
+
+	if c.PublicKey != nil {
+		req.Header.Set(encryption.Header, encryption.Scheme)
+	}
+
+	if ip, ipErr := OutboundIP(c.URL.Host); ipErr == nil {
+		req.Header.Set(realIPHeader, ip.String())
+	} else {
+		logger.Log.Warn("unable to determine outbound address", zap.Error(ipErr))
+	}
+
+	if config.Key != "" {
+		nonce, nonceErr := newNonce()
+		if nonceErr != nil {
+			logger.Log.Error("failed to generate nonce:", zap.Error(nonceErr))
+			return nil, nonceErr
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		hash := c.hashData(signature.Material(timestamp, nonce, jsonBody))
+		req.Header.Set(signature.HashHeader, hash)
+		req.Header.Set(signature.TimestampHeader, timestamp)
+		req.Header.Set(signature.NonceHeader, nonce)
+		if config.KeyID != "" {
+			req.Header.Set(signature.KeyIDHeader, config.KeyID)
+		}
+		logger.Log.Info("hash:", zap.String("hash", hash))
+	}
+
+	if config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.AuthToken)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	return req, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
 }
 
 func (c *Client) compressData(data []byte) (*bytes.Buffer, error) {
@@ -116,6 +244,15 @@ func (c *Client) compressData(data []byte) (*bytes.Buffer, error) {
 	return buf, nil
 }
 
+// newNonce returns a random hex-encoded value unique to a request.
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (c *Client) hashData(data []byte) string {
 	h := hmac.New(sha256.New, []byte(config.Key))
 	h.Write(data)
@@ -5,14 +5,23 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"github.com/rshafikov/alertme/internal/agent/config"
+	"github.com/rshafikov/alertme/internal/encryption"
+	"github.com/rshafikov/alertme/internal/server/agents"
 	"github.com/rshafikov/alertme/internal/server/models"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -121,4 +130,253 @@ func TestClient_SendDataSuccess(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestClient_SendDataEncrypted(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(encryption.Header) != encryption.Scheme {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		compressed, err := encryption.Decrypt(key, body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received, _ = io.ReadAll(zr)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testURL, _ := url.Parse(server.URL)
+	client := NewClient(testURL)
+	client.PublicKey = &key.PublicKey
+
+	metricValue := 1.0
+	metrics := []*models.Metric{
+		{
+			Name:  "test",
+			Type:  models.GaugeType,
+			Value: &metricValue,
+		},
+	}
+
+	if err = client.SendData(metrics); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected, _ := json.Marshal(metrics)
+	if !bytes.Equal(received, expected) {
+		t.Errorf("Expected body %s, got %s", expected, received)
+	}
+}
+
+func TestClient_SendDataKeyID(t *testing.T) {
+	originalKey, originalKeyID := config.Key, config.KeyID
+	defer func() {
+		config.Key, config.KeyID = originalKey, originalKeyID
+	}()
+	config.Key = "agentkey"
+	config.KeyID = "agent-1"
+
+	var keyID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID = r.Header.Get("KeyID")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testURL, _ := url.Parse(server.URL)
+	client := NewClient(testURL)
+
+	metricValue := 1.0
+	err := client.SendData([]*models.Metric{{Name: "test", Type: models.GaugeType, Value: &metricValue}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if keyID != "agent-1" {
+		t.Errorf("Expected KeyID header to be 'agent-1', got '%s'", keyID)
+	}
+}
+
+func TestClient_SendDataReplayProtection(t *testing.T) {
+	originalKey := config.Key
+	defer func() { config.Key = originalKey }()
+	config.Key = "testkey"
+
+	nonces := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(zr)
+
+		timestamp, nonce := r.Header.Get("Timestamp"), r.Header.Get("Nonce")
+		h := hmac.New(sha256.New, []byte(config.Key))
+		h.Write([]byte("alertme-v1\n" + timestamp + "\n" + nonce + "\n"))
+		h.Write(body)
+		if r.Header.Get("HashSHA256") != hex.EncodeToString(h.Sum(nil)) || nonces[nonce] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		nonces[nonce] = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testURL, _ := url.Parse(server.URL)
+	client := NewClient(testURL)
+
+	metricValue := 1.0
+	metrics := []*models.Metric{{Name: "test", Type: models.GaugeType, Value: &metricValue}}
+	for i := 0; i < 2; i++ {
+		if err := client.SendData(metrics); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if len(nonces) != 2 {
+		t.Errorf("Expected a new nonce for every request, got %d distinct nonces", len(nonces))
+	}
+}
+
+func TestClient_SendDataAuthToken(t *testing.T) {
+	originalToken := config.AuthToken
+	defer func() { config.AuthToken = originalToken }()
+	config.AuthToken = "write-token"
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testURL, _ := url.Parse(server.URL)
+	client := NewClient(testURL)
+
+	metricValue := 1.0
+	err := client.SendData([]*models.Metric{{Name: "test", Type: models.GaugeType, Value: &metricValue}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if authorization != "Bearer write-token" {
+		t.Errorf("Expected Authorization header to be 'Bearer write-token', got '%s'", authorization)
+	}
+}
+
+func TestClient_SendDataHostInfo(t *testing.T) {
+	var paths []string
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/agents/info" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var info agents.Info
+			if err = json.NewDecoder(zr).Decode(&info); err != nil || info.Hostname != "web" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testURL, _ := url.Parse(server.URL)
+	client := NewClient(testURL)
+	client.HostInfo = &agents.Info{Hostname: "web", OS: "linux", KernelVersion: "6.1.0"}
+
+	metricValue := 1.0
+	metrics := []*models.Metric{{Name: "test", Type: models.GaugeType, Value: &metricValue}}
+	for i := 0; i < 2; i++ {
+		if err := client.SendData(metrics); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	expected := []string{"/agents/info", "/updates/", "/updates/"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected host info to be sent once before the metrics, got requests %v", paths)
+	}
+
+	originalIntervals := sendRetryIntervals
+	defer func() { sendRetryIntervals = originalIntervals }()
+	sendRetryIntervals = []time.Duration{time.Millisecond}
+
+	available = false
+	if err := client.SendData(metrics); err == nil {
+		t.Fatal("Expected error while the server is unavailable, got nil")
+	}
+
+	available, paths = true, nil
+	if err := client.SendData(metrics); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(paths) == 0 || paths[0] != "/agents/info" {
+		t.Errorf("Expected host info to be sent again after a failed send, got requests %v", paths)
+	}
+}
+
+func TestClient_SendDataStatusCodes(t *testing.T) {
+	originalIntervals := sendRetryIntervals
+	defer func() { sendRetryIntervals = originalIntervals }()
+	sendRetryIntervals = []time.Duration{time.Millisecond}
+
+	tests := []struct {
+		name             string
+		code             int
+		expectedErr      error
+		expectedRequests int
+	}{
+		{name: "bad request", code: http.StatusBadRequest, expectedErr: ErrMetricsRejected, expectedRequests: 1},
+		{name: "too large", code: http.StatusRequestEntityTooLarge, expectedErr: ErrMetricsRejected, expectedRequests: 1},
+		{name: "unauthorized", code: http.StatusUnauthorized, expectedErr: ErrUnableToSendMetrics, expectedRequests: 2},
+		{name: "forbidden", code: http.StatusForbidden, expectedErr: ErrUnableToSendMetrics, expectedRequests: 2},
+		{name: "too many requests", code: http.StatusTooManyRequests, expectedErr: ErrUnableToSendMetrics, expectedRequests: 2},
+		{name: "server error", code: http.StatusInternalServerError, expectedErr: ErrUnableToSendMetrics, expectedRequests: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(test.code)
+			}))
+			defer server.Close()
+
+			testURL, _ := url.Parse(server.URL)
+			metricValue := 1.0
+			err := NewClient(testURL).SendData([]*models.Metric{{Name: "test", Type: models.GaugeType, Value: &metricValue}})
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("Expected %v, got %v", test.expectedErr, err)
+			}
+			if requests != test.expectedRequests {
+				t.Errorf("Expected %d requests, got %d", test.expectedRequests, requests)
+			}
+		})
+	}
+}
@@ -2,185 +2,347 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/rshafikov/alertme/internal/server/logger"
 	"github.com/rshafikov/alertme/internal/server/models"
-	"github.com/shirou/gopsutil/v4/cpu"
-	"github.com/shirou/gopsutil/v4/mem"
 	"go.uber.org/zap"
-	"math/rand"
-	"runtime"
+	"io"
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // SendMetricsTimeout is the timeout for sending metrics to the channel.
 const SendMetricsTimeout = time.Second * 1
 
-// MetricSource represents the source of metrics (runtime or PSUtil).
-type MetricSource int
+// Collector collects a group of metrics, e.g. from the Go runtime or the host system.
+type Collector interface {
+	// Name identifies the collector in the configuration and in logs.
+	Name() string
+	// Collect returns the current values of the gauges and the increments of the counters
+	// since the previous collection.
+	// It may return the metrics it managed to collect along with an error.
+	// The returned metrics are kept and sent as is, so they must not be modified afterwards.
+	Collect(ctx context.Context) ([]*models.Metric, error)
+}
 
-const (
-	// RuntimeMetrics indicates metrics collected from Go runtime.
-	RuntimeMetrics MetricSource = iota
-	// PSUtilMetrics indicates metrics collected from system using PSUtil.
-	PSUtilMetrics
-)
+// ScheduledCollector is a collector run at its own interval.
+type ScheduledCollector struct {
+	Collector Collector
+	Interval  time.Duration
+}
+
+// snapshot is an immutable set of the metrics of a collector.
+// It is never modified once published, every change replaces it with a new snapshot.
+type snapshot struct {
+	counters map[string]int64 // increments of the counters accumulated since the last send
+	gauges   []*models.Metric // latest values of the gauges
+}
+
+// metrics returns the gauges followed by the counters, ordered by name.
+// Counters are returned as new metrics, so they are not shared between batches.
+func (s *snapshot) metrics() []*models.Metric {
+	if s == nil {
+		return nil
+	}
+
+	counters := make([]string, 0, len(s.counters))
+	for counter := range s.counters {
+		counters = append(counters, counter)
+	}
+	sort.Strings(counters)
 
-// DataCollector collects and manages various system and runtime metrics.
+	metrics := make([]*models.Metric, 0, len(s.gauges)+len(counters))
+	metrics = append(metrics, s.gauges...)
+	for _, counter := range counters {
+		delta := s.counters[counter]
+		metrics = append(metrics, &models.Metric{Name: counter, Type: models.CounterType, Delta: &delta})
+	}
+	return metrics
+}
+
+// DataCollector runs the collectors and keeps their metrics until they are sent:
+// the latest value of every gauge, and the sum of the increments of every counter
+// collected since the last send.
+//
+// The metrics of every collector are kept in an immutable snapshot swapped atomically,
+// so collections and sends run concurrently without locks and a send always gets
+// the metrics of a single collection.
 type DataCollector struct {
-	Metrics        []*models.Metric
-	PollCount      *models.Metric
-	TotalMemory    *models.Metric
-	FreeMemory     *models.Metric
-	CPUUtilization []*models.Metric
+	snapshots  map[string]*atomic.Pointer[snapshot]
+	collectors []ScheduledCollector
 }
 
-// NewEmptyDataCollector creates a new DataCollector with initialized PollCount metric.
-func NewEmptyDataCollector() *DataCollector {
-	initalCount := int64(0)
+// NewDataCollector creates a new DataCollector running the given collectors.
+func NewDataCollector(collectors ...ScheduledCollector) *DataCollector {
+	snapshots := make(map[string]*atomic.Pointer[snapshot], len(collectors))
+	for _, sc := range collectors {
+		snapshots[sc.Collector.Name()] = &atomic.Pointer[snapshot]{}
+	}
 	return &DataCollector{
-		PollCount: &models.Metric{Name: "PollCount", Delta: &initalCount, Type: models.CounterType},
+		collectors: collectors,
+		snapshots:  snapshots,
 	}
 }
 
-// CollectMetrics continuously collects metrics at intervals specified by the ticker.
-// It updates both runtime and PSUtil metrics on each tick.
-func (d *DataCollector) CollectMetrics(ticker *time.Ticker) {
-	for range ticker.C {
-		logger.Log.Debug("collecting metrics")
-		d.UpdateRuntimeMetrics()
-		d.UpdatePSUtilMetrics()
+// Collectors returns the collectors run by the DataCollector.
+func (d *DataCollector) Collectors() []ScheduledCollector {
+	return d.collectors
+}
+
+// CollectMetrics runs every collector at its interval until the context is done.
+func (d *DataCollector) CollectMetrics(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sc := range d.collectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.run(ctx, sc)
+		}()
 	}
+	wg.Wait()
 }
 
-// String returns a formatted string representation of all collected metrics.
-func (d *DataCollector) String() string {
-	metrics := "========================================\n"
-	for _, metric := range d.Metrics {
-		metrics += fmt.Sprintf("%v\n", metric)
+func (d *DataCollector) run(ctx context.Context, sc ScheduledCollector) {
+	ticker := time.NewTicker(sc.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logger.Log.Debug("collecting metrics", zap.String("collector", sc.Collector.Name()))
+			d.Collect(ctx, sc.Collector)
+		}
 	}
-	metrics += fmt.Sprintf("========================================\n%v", d.PollCount)
-	return metrics
 }
 
-// UpdateRuntimeMetrics collects metrics from the Go runtime and updates the DataCollector.
-// This includes memory statistics and a random value metric.
-func (d *DataCollector) UpdateRuntimeMetrics() {
-	if d.PollCount.Delta == nil {
-		d.PollCount.Delta = new(int64)
-	}
-	*d.PollCount.Delta++
-
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
-
-	d.Metrics = []*models.Metric{
-		{Name: "Alloc", Type: models.GaugeType, Value: float64Ptr(float64(memStats.Alloc))},
-		{Name: "BuckHashSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.BuckHashSys))},
-		{Name: "Frees", Type: models.GaugeType, Value: float64Ptr(float64(memStats.Frees))},
-		{Name: "GCCPUFraction", Type: models.GaugeType, Value: float64Ptr(memStats.GCCPUFraction)},
-		{Name: "GCSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.GCSys))},
-		{Name: "HeapAlloc", Type: models.GaugeType, Value: float64Ptr(float64(memStats.HeapAlloc))},
-		{Name: "HeapIdle", Type: models.GaugeType, Value: float64Ptr(float64(memStats.HeapIdle))},
-		{Name: "HeapInuse", Type: models.GaugeType, Value: float64Ptr(float64(memStats.HeapInuse))},
-		{Name: "HeapObjects", Type: models.GaugeType, Value: float64Ptr(float64(memStats.HeapObjects))},
-		{Name: "HeapReleased", Type: models.GaugeType, Value: float64Ptr(float64(memStats.HeapReleased))},
-		{Name: "HeapSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.HeapSys))},
-		{Name: "LastGC", Type: models.GaugeType, Value: float64Ptr(float64(memStats.LastGC))},
-		{Name: "Lookups", Type: models.GaugeType, Value: float64Ptr(float64(memStats.Lookups))},
-		{Name: "MCacheInuse", Type: models.GaugeType, Value: float64Ptr(float64(memStats.MCacheInuse))},
-		{Name: "MCacheSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.MCacheSys))},
-		{Name: "MSpanInuse", Type: models.GaugeType, Value: float64Ptr(float64(memStats.MSpanInuse))},
-		{Name: "MSpanSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.MSpanSys))},
-		{Name: "Mallocs", Type: models.GaugeType, Value: float64Ptr(float64(memStats.Mallocs))},
-		{Name: "NextGC", Type: models.GaugeType, Value: float64Ptr(float64(memStats.NextGC))},
-		{Name: "NumForcedGC", Type: models.GaugeType, Value: float64Ptr(float64(memStats.NumForcedGC))},
-		{Name: "NumGC", Type: models.GaugeType, Value: float64Ptr(float64(memStats.NumGC))},
-		{Name: "OtherSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.OtherSys))},
-		{Name: "PauseTotalNs", Type: models.GaugeType, Value: float64Ptr(float64(memStats.PauseTotalNs))},
-		{Name: "StackInuse", Type: models.GaugeType, Value: float64Ptr(float64(memStats.StackInuse))},
-		{Name: "StackSys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.StackSys))},
-		{Name: "Sys", Type: models.GaugeType, Value: float64Ptr(float64(memStats.Sys))},
-		{Name: "TotalAlloc", Type: models.GaugeType, Value: float64Ptr(float64(memStats.TotalAlloc))},
-		{Name: "RandomValue", Type: models.GaugeType, Value: float64Ptr(rand.Float64())},
-	}
-}
-
-// UpdatePSUtilMetrics collects system metrics using PSUtil and updates the DataCollector.
-// This includes memory and CPU utilization metrics.
-func (d *DataCollector) UpdatePSUtilMetrics() {
-	memoryData, err := mem.VirtualMemory()
-	if err != nil {
-		logger.Log.Error("Failed to get virtual memory info", zap.Error(err))
+// Collect runs the collector once, replacing the gauges it collected before
+// and adding the counter increments to the ones not sent yet.
+// Errors are logged and returned; if no metrics were collected, the previous ones are kept.
+// Collectors not run by the DataCollector are rejected.
+func (d *DataCollector) Collect(ctx context.Context, c Collector) error {
+	if _, ok := d.snapshots[c.Name()]; !ok {
+		return fmt.Errorf("collector %q is not run by the data collector", c.Name())
 	}
 
-	d.TotalMemory = &models.Metric{
-		Name:  "TotalMemory",
-		Value: float64Ptr(float64(memoryData.Total)),
-		Delta: nil,
-		Type:  models.GaugeType,
+	metrics, err := c.Collect(ctx)
+	if err != nil {
+		logger.Log.Error("failed to collect metrics", zap.String("collector", c.Name()), zap.Error(err))
+	}
+	if len(metrics) == 0 {
+		return err
 	}
 
-	d.FreeMemory = &models.Metric{
-		Name:  "FreeMemory",
-		Value: float64Ptr(float64(memoryData.Free)),
-		Delta: nil,
-		Type:  models.GaugeType,
+	var gauges []*models.Metric
+	increments := make(map[string]int64)
+	for _, metric := range metrics {
+		if metric.Type == models.CounterType && metric.Delta != nil {
+			increments[metric.Name] += *metric.Delta
+			continue
+		}
+		gauges = append(gauges, metric)
 	}
-	cpuData, err := cpu.Percent(time.Second, true)
-	if err != nil {
-		logger.Log.Error("Failed to get cpu usage", zap.Error(err))
+
+	d.update(c.Name(), func(current *snapshot) *snapshot {
+		next := &snapshot{gauges: gauges, counters: make(map[string]int64)}
+		if current != nil {
+			maps.Copy(next.counters, current.counters)
+		}
+		for counter, delta := range increments {
+			next.counters[counter] += delta
+		}
+		return next
+	})
+	return err
+}
+
+// update replaces the snapshot of the named collector with the one built from it by next.
+// next may be called more than once if the snapshot is replaced concurrently, so it must not have side effects
+// other than on the values it returns.
+func (d *DataCollector) update(name string, next func(current *snapshot) *snapshot) {
+	ptr, ok := d.snapshots[name]
+	if !ok {
 		return
 	}
+	for {
+		current := ptr.Load()
+		if ptr.CompareAndSwap(current, next(current)) {
+			return
+		}
+	}
+}
 
-	var cpuMetrics []*models.Metric
-	for c, v := range cpuData {
-		cpuMetrics = append(
-			cpuMetrics,
-			&models.Metric{
-				Name:  fmt.Sprintf("CPUutilization%v", c),
-				Value: float64Ptr(v),
-				Delta: nil,
-				Type:  models.GaugeType,
-			},
-		)
+// Metrics returns the metrics of the named collector that would be sent now:
+// the latest gauges followed by the counters, ordered by name.
+func (d *DataCollector) Metrics(name string) []*models.Metric {
+	ptr, ok := d.snapshots[name]
+	if !ok {
+		return nil
 	}
+	return ptr.Load().metrics()
+}
 
-	d.CPUUtilization = cpuMetrics
+// takeMetrics returns the metrics of the named collector and removes its counters,
+// so counters that are no longer collected, e.g. of exited processes, are not sent again.
+func (d *DataCollector) takeMetrics(name string) []*models.Metric {
+	var metrics []*models.Metric
+	d.update(name, func(current *snapshot) *snapshot {
+		metrics = current.metrics()
+		if current == nil {
+			return nil
+		}
+		return &snapshot{gauges: current.gauges, counters: make(map[string]int64)}
+	})
+	return metrics
 }
 
-// PassMetrics sends metrics of the specified type to the provided channel.
-// It uses a timeout context to avoid blocking indefinitely.
-func (d *DataCollector) PassMetrics(t MetricSource, ch chan []*models.Metric) {
-	ctx, cancel := context.WithTimeout(context.Background(), SendMetricsTimeout)
-	defer cancel()
+// restoreCounters adds the increments of the counters that could not be sent back to the named collector.
+// Gauges are not restored, the next batch carries their latest values.
+func (d *DataCollector) restoreCounters(name string, metrics []*models.Metric) {
+	d.update(name, func(current *snapshot) *snapshot {
+		if current == nil {
+			return nil
+		}
+		next := &snapshot{gauges: current.gauges, counters: maps.Clone(current.counters)}
+		for _, metric := range metrics {
+			if metric.Type == models.CounterType && metric.Delta != nil {
+				next.counters[metric.Name] += *metric.Delta
+			}
+		}
+		return next
+	})
+}
 
-	var metrics []*models.Metric
-	switch t {
-	case RuntimeMetrics:
-		metrics = append(metrics, d.Metrics...)
-		metrics = append(metrics, d.PollCount)
+// String returns a formatted string representation of all collected metrics.
+func (d *DataCollector) String() string {
+	metrics := "========================================\n"
+	for _, sc := range d.collectors {
+		for _, metric := range d.Metrics(sc.Collector.Name()) {
+			metrics += fmt.Sprintf("%v\n", metric)
+		}
+	}
+	metrics += "========================================"
+	return metrics
+}
+
+// Batch is a batch of metrics of a collector to be sent to the server.
+type Batch struct {
+	// Done is called once with the result of sending the batch, if set.
+	Done    func(err error)
+	Metrics []*models.Metric
+}
+
+// Ack reports the result of sending the batch: nil once the batch is handled, e.g. accepted by the server,
+// or the error it failed with, its counters being carried into the next batch.
+func (b Batch) Ack(err error) {
+	if b.Done != nil {
+		b.Done(err)
+	}
+}
+
+// PassMetrics sends the metrics of the named collector to the provided channel as a batch.
+// Counter increments are passed once: they are taken out of the collector with the batch, and put back
+// unless the batch is acknowledged as sent, so a failed send carries them into the next batch.
+// Nothing is sent if the collector has not collected any metrics yet.
+// It uses a timeout context to avoid blocking indefinitely; on timeout the counters are kept for the next send.
+func (d *DataCollector) PassMetrics(name string, ch chan Batch) {
+	d.passMetrics(name, ch, nil)
+}
 
-	case PSUtilMetrics:
-		metrics = append(metrics, d.CPUUtilization...)
-		metrics = append(metrics, d.TotalMemory, d.FreeMemory)
+// passMetrics sends the metrics of the named collector to the channel as PassMetrics does,
+// and calls acked, if set, once the batch is acknowledged. It reports whether a batch was sent.
+func (d *DataCollector) passMetrics(name string, ch chan Batch, acked func()) bool {
+	metrics := d.takeMetrics(name)
+	if len(metrics) == 0 {
+		return false
 	}
 
+	batch := Batch{
+		Metrics: metrics,
+		Done: func(err error) {
+			if err != nil {
+				d.restoreCounters(name, metrics)
+				logger.Log.Warn("metrics weren't sent, counters are carried into the next batch",
+					zap.String("collector", name),
+					zap.Error(err),
+				)
+			}
+			if acked != nil {
+				acked()
+			}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SendMetricsTimeout)
+	defer cancel()
+
 	select {
-	case ch <- metrics:
+	case ch <- batch:
+		return true
 	case <-ctx.Done():
-		logger.Log.Warn("metrics weren't sent, reached timeout", zap.Duration("timeout", SendMetricsTimeout))
+		d.restoreCounters(name, metrics)
+		logger.Log.Warn("metrics weren't sent, reached timeout",
+			zap.String("collector", name),
+			zap.Duration("timeout", SendMetricsTimeout),
+		)
+		return false
 	}
-
 }
 
-// SendMetrics periodically sends both runtime and PSUtil metrics to the jobs channel.
-// The sending frequency is determined by the provided ticker.
-func (d *DataCollector) SendMetrics(ticker *time.Ticker, jobs chan []*models.Metric) {
+// SendMetrics periodically sends the metrics of every collector to the jobs channel,
+// one batch per collector. The sending frequency is determined by the provided ticker.
+func (d *DataCollector) SendMetrics(ticker *time.Ticker, jobs chan Batch) {
 	for range ticker.C {
-		logger.Log.Debug("collecting metrics")
-		go d.PassMetrics(RuntimeMetrics, jobs)
-		go d.PassMetrics(PSUtilMetrics, jobs)
+		logger.Log.Debug("sending metrics")
+		for _, sc := range d.collectors {
+			go d.PassMetrics(sc.Collector.Name(), jobs)
+		}
+	}
+}
+
+// Close closes the collectors holding resources, such as the listener of the StatsD collector,
+// and collects them one last time, so the metrics they received since their previous collection
+// are sent by Flush. It must be called once the collectors are no longer run by CollectMetrics.
+func (d *DataCollector) Close(ctx context.Context) error {
+	var errs []error
+	for _, sc := range d.collectors {
+		closer, ok := sc.Collector.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to close collector %q: %w", sc.Collector.Name(), err))
+		}
+		_ = d.Collect(ctx, sc.Collector)
+	}
+	return errors.Join(errs...)
+}
+
+// Flush sends the metrics of every collector to the channel as the final batches, and waits until
+// they are acknowledged or the context is done, so the pending counters are sent before the agent stops.
+func (d *DataCollector) Flush(ctx context.Context, ch chan Batch) {
+	var wg sync.WaitGroup
+	for _, sc := range d.collectors {
+		wg.Add(1)
+		if !d.passMetrics(sc.Collector.Name(), ch, wg.Done) {
+			wg.Done()
+		}
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		logger.Log.Warn("final metrics weren't sent", zap.Error(ctx.Err()))
 	}
 }
 
@@ -1,127 +1,305 @@
 package metrics
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rshafikov/alertme/internal/server/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestUpdateDataCollector(t *testing.T) {
-	dc := NewEmptyDataCollector()
+type fakeCollector struct {
+	err     error
+	name    string
+	metrics []*models.Metric
+	calls   int
+}
+
+func (f *fakeCollector) Name() string {
+	return f.name
+}
 
-	t.Run("check PollCounter increments", func(t *testing.T) {
-		initialValue := int64(0)
-		dc.UpdateRuntimeMetrics()
-		assert.Greater(t, *dc.PollCount.Delta, initialValue)
+func (f *fakeCollector) Collect(_ context.Context) ([]*models.Metric, error) {
+	f.calls++
+	return f.metrics, f.err
+}
+
+func gauge(name string, value float64) *models.Metric {
+	return &models.Metric{Name: name, Type: models.GaugeType, Value: float64Ptr(value)}
+}
+
+func TestDataCollector_Collect(t *testing.T) {
+	fake := &fakeCollector{name: "fake", metrics: []*models.Metric{gauge("A", 1)}}
+	dc := NewDataCollector(ScheduledCollector{Collector: fake, Interval: time.Second})
+
+	require.NoError(t, dc.Collect(context.Background(), fake))
+	assert.Equal(t, fake.metrics, dc.Metrics("fake"))
+
+	t.Run("failed collection keeps previous metrics", func(t *testing.T) {
+		previous := fake.metrics
+		fake.metrics, fake.err = nil, errors.New("unavailable")
+
+		assert.Error(t, dc.Collect(context.Background(), fake))
+		assert.Equal(t, previous, dc.Metrics("fake"))
 	})
 
-	t.Run("check RandomValue changes", func(t *testing.T) {
-		getMetricByName := func(name string, arr []*models.Metric) *models.Metric {
-			for _, metric := range dc.Metrics {
-				if metric.Name == name {
-					return metric
-				}
-			}
-			return nil
-		}
-		randValueBefore := getMetricByName("RandomValue", dc.Metrics).Value
-		dc.UpdateRuntimeMetrics()
-		randValueAfter := getMetricByName("RandomValue", dc.Metrics).Value
+	t.Run("partial collection replaces metrics", func(t *testing.T) {
+		fake.metrics = []*models.Metric{gauge("B", 2)}
 
-		assert.NotEqualValues(t, randValueBefore, randValueAfter)
+		assert.Error(t, dc.Collect(context.Background(), fake))
+		assert.Equal(t, fake.metrics, dc.Metrics("fake"))
+	})
+
+	t.Run("unknown collector", func(t *testing.T) {
+		assert.Error(t, dc.Collect(context.Background(), &fakeCollector{name: "unknown"}))
+		assert.Empty(t, dc.Metrics("unknown"))
 	})
 }
 
-func BenchmarkDataCollector_CollectMetrics(b *testing.B) {
-	dc := NewEmptyDataCollector()
-	b.ResetTimer()
-	b.ReportAllocs()
+func TestDataCollector_CollectMetrics(t *testing.T) {
+	fast := &fakeCollector{name: "fast", metrics: []*models.Metric{gauge("A", 1)}}
+	slow := &fakeCollector{name: "slow", metrics: []*models.Metric{gauge("B", 2)}}
+	dc := NewDataCollector(
+		ScheduledCollector{Collector: fast, Interval: 10 * time.Millisecond},
+		ScheduledCollector{Collector: slow, Interval: time.Hour},
+	)
 
-	for i := 0; i < b.N; i++ {
-		dc.UpdateRuntimeMetrics()
-		dc.UpdateRuntimeMetrics()
-	}
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	dc.CollectMetrics(ctx)
 
-func TestUpdatePSUtilMetrics(t *testing.T) {
-	dc := NewEmptyDataCollector()
-	dc.UpdatePSUtilMetrics()
-	
-	if dc.TotalMemory == nil {
-		t.Error("Expected TotalMemory to be initialized")
-	}
-	
-	if dc.FreeMemory == nil {
-		t.Error("Expected FreeMemory to be initialized")
-	}
-	
-	if dc.CPUUtilization == nil {
-		t.Error("Expected CPUUtilization to be initialized")
-	}
+	assert.Greater(t, fast.calls, 1)
+	assert.Equal(t, 0, slow.calls, "collectors run at their own intervals")
+	assert.NotEmpty(t, dc.Metrics("fast"))
+	assert.Empty(t, dc.Metrics("slow"))
 }
 
-func TestPassMetrics(t *testing.T) {
-	dc := NewEmptyDataCollector()
-	dc.UpdateRuntimeMetrics()
-	dc.UpdatePSUtilMetrics()
-	
-	ch := make(chan []*models.Metric, 2)
-	
-	dc.PassMetrics(RuntimeMetrics, ch)
-	
-	select {
-	case metrics := <-ch:
-		if len(metrics) == 0 {
-			t.Error("Expected non-empty metrics for RuntimeMetrics")
-		}
-	default:
-		t.Error("Expected metrics to be sent to channel")
-	}
-	
-	dc.PassMetrics(PSUtilMetrics, ch)
-	
+func TestDataCollector_PassMetrics(t *testing.T) {
+	fake := &fakeCollector{name: "fake", metrics: []*models.Metric{gauge("A", 1)}}
+	dc := NewDataCollector(ScheduledCollector{Collector: fake, Interval: time.Second})
+	ch := make(chan Batch, 1)
+
+	dc.PassMetrics("fake", ch)
+	assert.Empty(t, ch, "nothing is sent before the first collection")
+
+	require.NoError(t, dc.Collect(context.Background(), fake))
+	dc.PassMetrics("fake", ch)
+
 	select {
-	case metrics := <-ch:
-		_ = metrics
+	case batch := <-ch:
+		assert.Equal(t, fake.metrics, batch.Metrics)
 	default:
 		t.Error("Expected metrics to be sent to channel")
 	}
 }
 
-func TestNewEmptyDataCollector(t *testing.T) {
-	dc := NewEmptyDataCollector()
-	
-	if dc.PollCount == nil {
-		t.Error("Expected PollCount to be initialized")
-	}
-	
-	if dc.PollCount.Name != "PollCount" {
-		t.Errorf("Expected PollCount name to be 'PollCount', got '%s'", dc.PollCount.Name)
-	}
-	
-	if dc.PollCount.Type != models.CounterType {
-		t.Errorf("Expected PollCount type to be CounterType, got '%s'", dc.PollCount.Type)
-	}
-	
-	if dc.PollCount.Delta == nil {
-		t.Error("Expected PollCount.Delta to be initialized")
-	}
-	
-	if *dc.PollCount.Delta != 0 {
-		t.Errorf("Expected PollCount.Delta to be 0, got %d", *dc.PollCount.Delta)
-	}
+func TestDataCollector_String(t *testing.T) {
+	fake := &fakeCollector{name: "fake", metrics: []*models.Metric{gauge("A", 1)}}
+	dc := NewDataCollector(ScheduledCollector{Collector: fake, Interval: time.Second})
+	require.NoError(t, dc.Collect(context.Background(), fake))
+
+	assert.Contains(t, dc.String(), fake.metrics[0].String())
 }
 
 func TestFloat64Ptr(t *testing.T) {
 	value := 1.23
 	ptr := float64Ptr(value)
-	
+
 	if ptr == nil {
 		t.Error("Expected pointer to be non-nil")
 	}
-	
+
 	if ptr != nil && *ptr != value {
 		t.Errorf("Expected value %f, got %f", value, *ptr)
 	}
 }
+
+func counter(name string, delta int64) *models.Metric {
+	return &models.Metric{Name: name, Type: models.CounterType, Delta: &delta}
+}
+
+func TestDataCollector_Counters(t *testing.T) {
+	fake := &fakeCollector{name: "fake", metrics: []*models.Metric{gauge("A", 1), counter("C", 2)}}
+	dc := NewDataCollector(ScheduledCollector{Collector: fake, Interval: time.Second})
+
+	require.NoError(t, dc.Collect(context.Background(), fake))
+	fake.metrics = []*models.Metric{gauge("A", 5), counter("C", 3)}
+	require.NoError(t, dc.Collect(context.Background(), fake))
+
+	ch := make(chan Batch, 1)
+	dc.PassMetrics("fake", ch)
+	assert.Equal(t, []*models.Metric{gauge("A", 5), counter("C", 5)}, (<-ch).Metrics, "gauges are replaced and counters summed")
+
+	dc.PassMetrics("fake", ch)
+	assert.Equal(t, []*models.Metric{gauge("A", 5)}, (<-ch).Metrics, "counters are removed once passed")
+
+	t.Run("counters are carried into the next batch after a failed send", func(t *testing.T) {
+		require.NoError(t, dc.Collect(context.Background(), fake))
+		dc.PassMetrics("fake", ch)
+		failed := <-ch
+		assert.Equal(t, []*models.Metric{gauge("A", 5), counter("C", 3)}, failed.Metrics)
+
+		require.NoError(t, dc.Collect(context.Background(), fake))
+		failed.Ack(errors.New("unavailable"))
+		dc.PassMetrics("fake", ch)
+		sent := <-ch
+		assert.Equal(t, []*models.Metric{gauge("A", 5), counter("C", 6)}, sent.Metrics)
+
+		sent.Ack(nil)
+		dc.PassMetrics("fake", ch)
+		assert.Equal(t, []*models.Metric{gauge("A", 5)}, (<-ch).Metrics, "acknowledged counters are not sent again")
+	})
+
+	t.Run("counters are kept on timeout", func(t *testing.T) {
+		require.NoError(t, dc.Collect(context.Background(), fake))
+
+		dc.PassMetrics("fake", make(chan Batch))
+		assert.Equal(t, []*models.Metric{gauge("A", 5), counter("C", 3)}, dc.Metrics("fake"))
+	})
+}
+
+// closingCollector is a fakeCollector holding resources, e.g. a listener, released by Close.
+type closingCollector struct {
+	fakeCollector
+	closed bool
+}
+
+func (c *closingCollector) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDataCollector_CloseAndFlush(t *testing.T) {
+	closing := &closingCollector{fakeCollector: fakeCollector{name: "closing", metrics: []*models.Metric{counter("C", 2)}}}
+	fake := &fakeCollector{name: "fake", metrics: []*models.Metric{gauge("A", 1)}}
+	dc := NewDataCollector(
+		ScheduledCollector{Collector: closing, Interval: time.Second},
+		ScheduledCollector{Collector: fake, Interval: time.Second},
+	)
+	require.NoError(t, dc.Collect(context.Background(), closing))
+	require.NoError(t, dc.Collect(context.Background(), fake))
+
+	require.NoError(t, dc.Close(context.Background()))
+	assert.True(t, closing.closed)
+	assert.Equal(t, 2, closing.calls, "closed collectors are collected one last time")
+	assert.Equal(t, 1, fake.calls, "other collectors are not collected again")
+
+	ch := make(chan Batch)
+	var received []*models.Metric
+	go func() {
+		for batch := range ch {
+			received = append(received, batch.Metrics...)
+			batch.Ack(nil)
+		}
+	}()
+	dc.Flush(context.Background(), ch)
+	close(ch)
+	assert.ElementsMatch(t, []*models.Metric{counter("C", 4), gauge("A", 1)}, received,
+		"every collector is flushed, with the counters of the last collection")
+
+	t.Run("stops waiting once the context is done", func(t *testing.T) {
+		require.NoError(t, dc.Collect(context.Background(), fake))
+		ch := make(chan Batch, 2)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		dc.Flush(ctx, ch)
+		assert.Len(t, ch, 1, "batches are sent even if they are never acknowledged")
+	})
+}
+
+// incrementingCollector reports the number of its collections and a counter incremented by every one of them.
+// Unlike fakeCollector, it is safe for concurrent use.
+type incrementingCollector struct {
+	calls atomic.Int64
+}
+
+func (c *incrementingCollector) Name() string {
+	return "incrementing"
+}
+
+func (c *incrementingCollector) Collect(_ context.Context) ([]*models.Metric, error) {
+	calls := c.calls.Add(1)
+	return []*models.Metric{gauge("Calls", float64(calls)), counter("Increments", 1)}, nil
+}
+
+// TestDataCollector_Concurrency collects, reads and passes metrics concurrently.
+// Run it with -race to detect unsynchronized access.
+func TestDataCollector_Concurrency(t *testing.T) {
+	const collectors, collections, senders = 4, 500, 4
+
+	c := &incrementingCollector{}
+	dc := NewDataCollector(ScheduledCollector{Collector: c, Interval: time.Second})
+	ch := make(chan Batch)
+
+	// Every third batch fails to be sent, its counters are carried into the next batch.
+	var sent atomic.Int64
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		var batches int
+		for batch := range ch {
+			batches++
+			if batches%3 == 0 {
+				batch.Ack(errors.New("unavailable"))
+				continue
+			}
+			// Batches taken between two collections hold no counters.
+			if assert.NotEmpty(t, batch.Metrics) && assert.LessOrEqual(t, len(batch.Metrics), 2) {
+				assert.Equal(t, "Calls", batch.Metrics[0].Name, "a batch holds the metrics of a single collection")
+				if len(batch.Metrics) == 2 {
+					assert.Equal(t, "Increments", batch.Metrics[1].Name)
+					sent.Add(*batch.Metrics[1].Delta)
+				}
+			}
+			batch.Ack(nil)
+		}
+	}()
+
+	var collecting, sending sync.WaitGroup
+	for i := 0; i < collectors; i++ {
+		collecting.Add(1)
+		go func() {
+			defer collecting.Done()
+			for j := 0; j < collections; j++ {
+				assert.NoError(t, dc.Collect(context.Background(), c))
+			}
+		}()
+	}
+	done := make(chan struct{})
+	for i := 0; i < senders; i++ {
+		sending.Add(1)
+		go func() {
+			defer sending.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					dc.PassMetrics(c.Name(), ch)
+					_ = dc.Metrics(c.Name())
+					_ = dc.String()
+				}
+			}
+		}()
+	}
+
+	collecting.Wait()
+	close(done)
+	sending.Wait()
+	// Failed batches carry their counters into the next ones.
+	total := int64(collectors * collections)
+	assert.Eventually(t, func() bool {
+		dc.PassMetrics(c.Name(), ch)
+		return sent.Load() >= total
+	}, 5*time.Second, time.Millisecond)
+	close(ch)
+	<-received
+
+	assert.Equal(t, total, sent.Load(), "every counter increment is sent exactly once")
+}
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/disk"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DiskCollectorName is the name of the DiskCollector.
+const DiskCollectorName = "disk"
+
+// DiskCollector collects the usage of the mounted filesystems and the IO counters of the block devices.
+//
+// Usage metrics are reported per mount point, e.g. "DiskFree_var_log" for /var/log and
+// "DiskFree__" for /. IO counters are reported per device, e.g. "DiskReadBytes_sda",
+// as the totals since boot; devices without any IO are skipped.
+type DiskCollector struct {
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+	include    []string
+	exclude    []string
+}
+
+// NewDiskCollector creates a new DiskCollector reporting the mount points matching any of the
+// include patterns, or all of them if there are none, and none of the exclude patterns.
+// Patterns are matched with path.Match, e.g. "/mnt/*".
+func NewDiskCollector(include, exclude []string) (*DiskCollector, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid mount pattern %q: %w", pattern, err)
+		}
+	}
+	return &DiskCollector{
+		partitions: disk.PartitionsWithContext,
+		usage:      disk.UsageWithContext,
+		ioCounters: disk.IOCountersWithContext,
+		include:    include,
+		exclude:    exclude,
+	}, nil
+}
+
+// Name implements the Collector interface.
+func (c *DiskCollector) Name() string {
+	return DiskCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *DiskCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	var metrics []*models.Metric
+	var errs []error
+
+	partitions, err := c.partitions(ctx, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to list partitions: %w", err))
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Mountpoint < partitions[j].Mountpoint
+	})
+
+	seen := make(map[string]bool)
+	for _, partition := range partitions {
+		mount := partition.Mountpoint
+		if seen[mount] || !c.matches(mount) {
+			continue
+		}
+		seen[mount] = true
+
+		usage, usageErr := c.usage(ctx, mount)
+		if usageErr != nil {
+			errs = append(errs, fmt.Errorf("unable to get usage of %s: %w", mount, usageErr))
+			continue
+		}
+		suffix := "_" + metricSuffix(mount)
+		metrics = append(metrics,
+			&models.Metric{Name: "DiskTotal" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(usage.Total))},
+			&models.Metric{Name: "DiskUsed" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(usage.Used))},
+			&models.Metric{Name: "DiskFree" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(usage.Free))},
+			&models.Metric{Name: "DiskUsedPercent" + suffix, Type: models.GaugeType, Value: float64Ptr(usage.UsedPercent)},
+		)
+		// Some filesystems, e.g. FAT or btrfs, do not report inodes.
+		if usage.InodesTotal > 0 {
+			metrics = append(metrics,
+				&models.Metric{Name: "DiskInodesTotal" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(usage.InodesTotal))},
+				&models.Metric{Name: "DiskInodesUsed" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(usage.InodesUsed))},
+				&models.Metric{Name: "DiskInodesFree" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(usage.InodesFree))},
+				&models.Metric{Name: "DiskInodesUsedPercent" + suffix, Type: models.GaugeType, Value: float64Ptr(usage.InodesUsedPercent)},
+			)
+		}
+	}
+
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get disk io counters: %w", err))
+	}
+	devices := make([]string, 0, len(counters))
+	for device := range counters {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	for _, device := range devices {
+		counter := counters[device]
+		if counter.ReadCount == 0 && counter.WriteCount == 0 {
+			continue
+		}
+		suffix := "_" + metricSuffix(device)
+		metrics = append(metrics,
+			&models.Metric{Name: "DiskReadBytes" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(counter.ReadBytes))},
+			&models.Metric{Name: "DiskWriteBytes" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(counter.WriteBytes))},
+			&models.Metric{Name: "DiskReadCount" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(counter.ReadCount))},
+			&models.Metric{Name: "DiskWriteCount" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(counter.WriteCount))},
+			&models.Metric{Name: "DiskIOTime" + suffix, Type: models.GaugeType, Value: float64Ptr(float64(counter.IoTime))},
+		)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// matches reports whether the mount point passes the include and exclude filters.
+func (c *DiskCollector) matches(mount string) bool {
+	if len(c.include) > 0 && !matchAny(c.include, mount) {
+		return false
+	}
+	return !matchAny(c.exclude, mount)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// metricSuffix turns a mount point, a device or an interface name into a part of a metric name.
+// Letters and digits are kept, slashes become underscores and any other byte is escaped as "-"
+// followed by its hex code, so different names never share a suffix: "/var/log" becomes "var_log"
+// and "/var-log" becomes "var-2Dlog". The leading slash is dropped unless it is the whole name,
+// so the root mount point becomes "_".
+func metricSuffix(name string) string {
+	if len(name) > 1 {
+		name = strings.TrimPrefix(name, "/")
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			b.WriteByte(c)
+		case c == '/':
+			b.WriteByte('_')
+		default:
+			fmt.Fprintf(&b, "-%02X", c)
+		}
+	}
+	return b.String()
+}
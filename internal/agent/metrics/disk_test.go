@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskCollector(t *testing.T, include, exclude []string) *DiskCollector {
+	t.Helper()
+
+	c, err := NewDiskCollector(include, exclude)
+	require.NoError(t, err)
+
+	c.partitions = func(_ context.Context, _ bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/"},
+			{Device: "/dev/sda2", Mountpoint: "/var/log"},
+			{Device: "/dev/sdb1", Mountpoint: "/mnt/backup"},
+			{Device: "/dev/sdb1", Mountpoint: "/mnt/backup"},
+		}, nil
+	}
+	c.usage = func(_ context.Context, path string) (*disk.UsageStat, error) {
+		if path == "/mnt/backup" {
+			return &disk.UsageStat{Path: path, Total: 100, Used: 90, Free: 10, UsedPercent: 90}, nil
+		}
+		return &disk.UsageStat{
+			Path: path, Total: 100, Used: 40, Free: 60, UsedPercent: 40,
+			InodesTotal: 10, InodesUsed: 1, InodesFree: 9, InodesUsedPercent: 10,
+		}, nil
+	}
+	c.ioCounters = func(_ context.Context, _ ...string) (map[string]disk.IOCountersStat, error) {
+		return map[string]disk.IOCountersStat{
+			"sda":   {Name: "sda", ReadCount: 5, WriteCount: 7, ReadBytes: 512, WriteBytes: 1024, IoTime: 3},
+			"loop0": {Name: "loop0"},
+		}, nil
+	}
+	return c
+}
+
+func TestDiskCollector(t *testing.T) {
+	c := newTestDiskCollector(t, nil, nil)
+	assert.Equal(t, DiskCollectorName, c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	expected := map[string]float64{
+		"DiskTotal__":                   100,
+		"DiskUsed__":                    40,
+		"DiskFree__":                    60,
+		"DiskUsedPercent__":             40,
+		"DiskInodesTotal__":             10,
+		"DiskInodesUsed__":              1,
+		"DiskInodesFree__":              9,
+		"DiskInodesUsedPercent__":       10,
+		"DiskTotal_var_log":             100,
+		"DiskUsed_var_log":              40,
+		"DiskFree_var_log":              60,
+		"DiskUsedPercent_var_log":       40,
+		"DiskInodesTotal_var_log":       10,
+		"DiskInodesUsed_var_log":        1,
+		"DiskInodesFree_var_log":        9,
+		"DiskInodesUsedPercent_var_log": 10,
+		"DiskTotal_mnt_backup":          100,
+		"DiskUsed_mnt_backup":           90,
+		"DiskFree_mnt_backup":           10,
+		"DiskUsedPercent_mnt_backup":    90,
+		"DiskReadBytes_sda":             512,
+		"DiskWriteBytes_sda":            1024,
+		"DiskReadCount_sda":             5,
+		"DiskWriteCount_sda":            7,
+		"DiskIOTime_sda":                3,
+	}
+	for name, value := range expected {
+		metric := metricByName(name, metrics)
+		if assert.NotNil(t, metric, "Expected %s to be collected", name) {
+			assert.Equal(t, value, *metric.Value, name)
+		}
+	}
+	assert.Len(t, metrics, len(expected), "filesystems without inodes, idle devices and duplicate mounts are skipped")
+}
+
+func TestDiskCollector_Filters(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{name: "all", expected: []string{"_", "var_log", "mnt_backup"}},
+		{name: "include", include: []string{"/", "/var/*"}, expected: []string{"_", "var_log"}},
+		{name: "exclude", exclude: []string{"/mnt/*"}, expected: []string{"_", "var_log"}},
+		{name: "include and exclude", include: []string{"/var/*", "/mnt/*"}, exclude: []string{"/mnt/backup"}, expected: []string{"var_log"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics, err := newTestDiskCollector(t, test.include, test.exclude).Collect(context.Background())
+			require.NoError(t, err)
+
+			var mounts []string
+			for _, metric := range metrics {
+				if mount, ok := strings.CutPrefix(metric.Name, "DiskTotal_"); ok {
+					mounts = append(mounts, mount)
+				}
+			}
+			assert.ElementsMatch(t, test.expected, mounts)
+		})
+	}
+}
+
+func TestDiskCollector_Errors(t *testing.T) {
+	c := newTestDiskCollector(t, nil, nil)
+	c.usage = func(_ context.Context, path string) (*disk.UsageStat, error) {
+		return nil, errors.New("permission denied")
+	}
+
+	metrics, err := c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.NotNil(t, metricByName("DiskReadBytes_sda", metrics), "other metrics are still collected")
+}
+
+func TestNewDiskCollector_InvalidPattern(t *testing.T) {
+	_, err := NewDiskCollector([]string{"/mnt/["}, nil)
+	assert.Error(t, err)
+}
+
+func TestMetricSuffix(t *testing.T) {
+	tests := map[string]string{
+		"/":               "_",
+		"/root":           "root",
+		"/var/log":        "var_log",
+		"/var-log":        "var-2Dlog",
+		"/var_log":        "var-5Flog",
+		"/var/lib/docker": "var_lib_docker",
+		"C:":              "C-3A",
+		"nvme0n1":         "nvme0n1",
+		"eth0.100":        "eth0-2E100",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, metricSuffix(name), name)
+	}
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/host"
+	"io/fs"
+)
+
+// HostCollectorName is the name of the HostCollector.
+const HostCollectorName = "host"
+
+// HostCollector collects the uptime and the boot time of the host, both in seconds,
+// and the number of logged-in users.
+//
+// Users are counted from the login records, e.g. /var/run/utmp on Linux;
+// hosts without login records, such as most containers, report no users.
+type HostCollector struct {
+	uptime   func(ctx context.Context) (uint64, error)
+	bootTime func(ctx context.Context) (uint64, error)
+	users    func(ctx context.Context) ([]host.UserStat, error)
+}
+
+// NewHostCollector creates a new HostCollector.
+func NewHostCollector() *HostCollector {
+	return &HostCollector{
+		uptime:   host.UptimeWithContext,
+		bootTime: host.BootTimeWithContext,
+		users:    host.UsersWithContext,
+	}
+}
+
+// Name implements the Collector interface.
+func (c *HostCollector) Name() string {
+	return HostCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *HostCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	var metrics []*models.Metric
+	var errs []error
+
+	uptime, err := c.uptime(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get uptime: %w", err))
+	} else {
+		metrics = append(metrics, &models.Metric{Name: "Uptime", Type: models.GaugeType, Value: float64Ptr(float64(uptime))})
+	}
+
+	bootTime, err := c.bootTime(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get boot time: %w", err))
+	} else {
+		metrics = append(metrics, &models.Metric{Name: "BootTime", Type: models.GaugeType, Value: float64Ptr(float64(bootTime))})
+	}
+
+	users, err := c.users(ctx)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, fmt.Errorf("unable to get logged-in users: %w", err))
+	} else {
+		metrics = append(metrics, &models.Metric{Name: "Users", Type: models.GaugeType, Value: float64Ptr(float64(len(users)))})
+	}
+
+	return metrics, errors.Join(errs...)
+}
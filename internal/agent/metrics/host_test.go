@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHostCollector() *HostCollector {
+	c := NewHostCollector()
+	c.uptime = func(_ context.Context) (uint64, error) { return 3600, nil }
+	c.bootTime = func(_ context.Context) (uint64, error) { return 1700000000, nil }
+	c.users = func(_ context.Context) ([]host.UserStat, error) {
+		return []host.UserStat{{User: "root", Terminal: "tty1"}, {User: "alice", Terminal: "pts/0"}}, nil
+	}
+	return c
+}
+
+func TestHostCollector(t *testing.T) {
+	c := newTestHostCollector()
+	assert.Equal(t, HostCollectorName, c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*models.Metric{gauge("Uptime", 3600), gauge("BootTime", 1700000000), gauge("Users", 2)}, metrics)
+}
+
+func TestHostCollector_Errors(t *testing.T) {
+	t.Run("missing login records", func(t *testing.T) {
+		c := newTestHostCollector()
+		c.users = func(_ context.Context) ([]host.UserStat, error) {
+			return nil, fs.ErrNotExist
+		}
+
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, *metricByName("Users", metrics).Value)
+	})
+
+	t.Run("partial collection", func(t *testing.T) {
+		c := newTestHostCollector()
+		c.uptime = func(_ context.Context) (uint64, error) {
+			return 0, errors.New("unavailable")
+		}
+
+		metrics, err := c.Collect(context.Background())
+		assert.Error(t, err)
+		assert.Nil(t, metricByName("Uptime", metrics))
+		assert.NotNil(t, metricByName("BootTime", metrics), "other metrics are still collected")
+	})
+}
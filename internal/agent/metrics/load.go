@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/load"
+)
+
+// LoadCollectorName is the name of the LoadCollector.
+const LoadCollectorName = "load"
+
+// LoadCollector collects the system load averages over 1, 5 and 15 minutes.
+type LoadCollector struct {
+	avg func(ctx context.Context) (*load.AvgStat, error)
+}
+
+// NewLoadCollector creates a new LoadCollector.
+func NewLoadCollector() *LoadCollector {
+	return &LoadCollector{avg: load.AvgWithContext}
+}
+
+// Name implements the Collector interface.
+func (c *LoadCollector) Name() string {
+	return LoadCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *LoadCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	avg, err := c.avg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get load average: %w", err)
+	}
+	return []*models.Metric{
+		{Name: "Load1", Type: models.GaugeType, Value: float64Ptr(avg.Load1)},
+		{Name: "Load5", Type: models.GaugeType, Value: float64Ptr(avg.Load5)},
+		{Name: "Load15", Type: models.GaugeType, Value: float64Ptr(avg.Load15)},
+	}, nil
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCollector(t *testing.T) {
+	c := NewLoadCollector()
+	assert.Equal(t, LoadCollectorName, c.Name())
+
+	c.avg = func(_ context.Context) (*load.AvgStat, error) {
+		return &load.AvgStat{Load1: 0.5, Load5: 1.25, Load15: 2}, nil
+	}
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*models.Metric{gauge("Load1", 0.5), gauge("Load5", 1.25), gauge("Load15", 2)}, metrics)
+
+	t.Run("error", func(t *testing.T) {
+		c.avg = func(_ context.Context) (*load.AvgStat, error) {
+			return nil, errors.New("not implemented")
+		}
+		metrics, err := c.Collect(context.Background())
+		assert.Error(t, err)
+		assert.Empty(t, metrics)
+	})
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/net"
+	"sort"
+	"strings"
+)
+
+// NetworkCollectorName is the name of the NetworkCollector.
+const NetworkCollectorName = "network"
+
+// tcpStates lists the TCP connection states reported by the NetworkCollector.
+var tcpStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+// NetworkCollector collects the traffic of the network interfaces and the number of TCP connections by state.
+//
+// Traffic is reported per interface, e.g. "NetBytesIn_eth0", as counters incremented by the traffic
+// since the previous collection; the first collection only records the totals to count from.
+// TCP connections are reported as gauges per state, e.g. "TCPEstablished" or "TCPTimeWait".
+type NetworkCollector struct {
+	ioCounters  func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+	connections func(ctx context.Context, kind string) ([]net.ConnectionStat, error)
+	previous    map[string]net.IOCountersStat
+}
+
+// NewNetworkCollector creates a new NetworkCollector.
+func NewNetworkCollector() *NetworkCollector {
+	return &NetworkCollector{
+		ioCounters:  net.IOCountersWithContext,
+		connections: net.ConnectionsWithoutUidsWithContext,
+	}
+}
+
+// Name implements the Collector interface.
+func (c *NetworkCollector) Name() string {
+	return NetworkCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *NetworkCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	var metrics []*models.Metric
+	var errs []error
+
+	counters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get network io counters: %w", err))
+	} else {
+		metrics = append(metrics, c.trafficMetrics(counters)...)
+	}
+
+	connections, err := c.connections(ctx, "tcp")
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to list tcp connections: %w", err))
+	} else {
+		byState := make(map[string]int, len(tcpStates))
+		for _, conn := range connections {
+			byState[conn.Status]++
+		}
+		for _, state := range tcpStates {
+			metrics = append(metrics, &models.Metric{
+				Name:  "TCP" + camelCase(state),
+				Type:  models.GaugeType,
+				Value: float64Ptr(float64(byState[state])),
+			})
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// trafficMetrics returns the traffic of every interface since the previous collection
+// and remembers the current totals.
+func (c *NetworkCollector) trafficMetrics(counters []net.IOCountersStat) []*models.Metric {
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Name < counters[j].Name
+	})
+
+	var metrics []*models.Metric
+	current := make(map[string]net.IOCountersStat, len(counters))
+	for _, counter := range counters {
+		current[counter.Name] = counter
+		previous, ok := c.previous[counter.Name]
+		if !ok {
+			continue
+		}
+
+		suffix := "_" + metricSuffix(counter.Name)
+		for _, field := range []struct {
+			name              string
+			current, previous uint64
+		}{
+			{name: "NetBytesIn", current: counter.BytesRecv, previous: previous.BytesRecv},
+			{name: "NetBytesOut", current: counter.BytesSent, previous: previous.BytesSent},
+			{name: "NetPacketsIn", current: counter.PacketsRecv, previous: previous.PacketsRecv},
+			{name: "NetPacketsOut", current: counter.PacketsSent, previous: previous.PacketsSent},
+			{name: "NetErrorsIn", current: counter.Errin, previous: previous.Errin},
+			{name: "NetErrorsOut", current: counter.Errout, previous: previous.Errout},
+			{name: "NetDropsIn", current: counter.Dropin, previous: previous.Dropin},
+			{name: "NetDropsOut", current: counter.Dropout, previous: previous.Dropout},
+		} {
+			delta := counterDelta(field.current, field.previous)
+			metrics = append(metrics, &models.Metric{Name: field.name + suffix, Type: models.CounterType, Delta: &delta})
+		}
+	}
+	c.previous = current
+	return metrics
+}
+
+// counterDelta returns the increment of a total since its previous value.
+// A total lower than before has been reset, e.g. by recreating the interface, so it is counted from zero.
+func counterDelta(current, previous uint64) int64 {
+	if current < previous {
+		return int64(current)
+	}
+	return int64(current - previous)
+}
+
+// camelCase turns an upper-case state name like "TIME_WAIT" into "TimeWait".
+func camelCase(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(strings.ToLower(name), "_") {
+		if word == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
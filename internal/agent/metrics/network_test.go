@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkCollector(t *testing.T) {
+	counters := []net.IOCountersStat{
+		{Name: "eth0", BytesRecv: 1000, BytesSent: 500, PacketsRecv: 10, PacketsSent: 5, Errin: 1, Dropout: 2},
+	}
+	c := NewNetworkCollector()
+	c.ioCounters = func(_ context.Context, _ bool) ([]net.IOCountersStat, error) {
+		return counters, nil
+	}
+	c.connections = func(_ context.Context, _ string) ([]net.ConnectionStat, error) {
+		return []net.ConnectionStat{{Status: "ESTABLISHED"}, {Status: "ESTABLISHED"}, {Status: "TIME_WAIT"}, {Status: "LISTEN"}}, nil
+	}
+	assert.Equal(t, NetworkCollectorName, c.Name())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, metricByName("NetBytesIn_eth0", metrics), "the first collection only records the totals")
+
+	expectedStates := map[string]float64{"TCPEstablished": 2, "TCPTimeWait": 1, "TCPListen": 1, "TCPCloseWait": 0}
+	for name, value := range expectedStates {
+		metric := metricByName(name, metrics)
+		if assert.NotNil(t, metric, "Expected %s to be collected", name) {
+			assert.Equal(t, models.GaugeType, metric.Type)
+			assert.Equal(t, value, *metric.Value, name)
+		}
+	}
+
+	counters = []net.IOCountersStat{
+		{Name: "eth0", BytesRecv: 1500, BytesSent: 800, PacketsRecv: 15, PacketsSent: 8, Errin: 1, Dropout: 3},
+		{Name: "eth1", BytesRecv: 100},
+	}
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+
+	expectedDeltas := map[string]int64{
+		"NetBytesIn_eth0":    500,
+		"NetBytesOut_eth0":   300,
+		"NetPacketsIn_eth0":  5,
+		"NetPacketsOut_eth0": 3,
+		"NetErrorsIn_eth0":   0,
+		"NetErrorsOut_eth0":  0,
+		"NetDropsIn_eth0":    0,
+		"NetDropsOut_eth0":   1,
+	}
+	for name, delta := range expectedDeltas {
+		metric := metricByName(name, metrics)
+		if assert.NotNil(t, metric, "Expected %s to be collected", name) {
+			assert.Equal(t, models.CounterType, metric.Type)
+			assert.Equal(t, delta, *metric.Delta, name)
+		}
+	}
+	assert.Nil(t, metricByName("NetBytesIn_eth1", metrics), "new interfaces are counted from the next collection")
+
+	t.Run("reset totals", func(t *testing.T) {
+		counters = []net.IOCountersStat{{Name: "eth0", BytesRecv: 200}}
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(200), *metricByName("NetBytesIn_eth0", metrics).Delta)
+	})
+
+	t.Run("connections unavailable", func(t *testing.T) {
+		c.connections = func(_ context.Context, _ string) ([]net.ConnectionStat, error) {
+			return nil, errors.New("permission denied")
+		}
+		metrics, err := c.Collect(context.Background())
+		assert.Error(t, err)
+		assert.NotNil(t, metricByName("NetBytesIn_eth0", metrics), "traffic is still collected")
+		assert.Nil(t, metricByName("TCPEstablished", metrics))
+	})
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"ESTABLISHED": "Established",
+		"TIME_WAIT":   "TimeWait",
+		"FIN_WAIT1":   "FinWait1",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, camelCase(name), name)
+	}
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/process"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProcessCollectorName is the name of the ProcessCollector.
+const ProcessCollectorName = "process"
+
+// trackedProcess is a process observed by the ProcessCollector.
+// The process keeps its CPU times between collections, to measure the CPU usage since the previous one.
+type trackedProcess struct {
+	proc       *process.Process
+	createTime int64
+}
+
+// ProcessCollector collects the CPU usage, the resident memory, the open file descriptors and the threads
+// of the processes with the given names or with the PIDs written in the given pidfiles.
+//
+// Metrics are reported per process, named after what matched it: the process name, or the pidfile
+// without its extension, e.g. "ProcessRSS_nginx" for the name "nginx" or the pidfile "/run/nginx.pid".
+// If several processes match the same name, the first one by PID keeps the plain name and the others
+// are numbered, e.g. "ProcessRSS_nginx_1", so the number of metrics is bounded by the number of
+// processes running at once rather than by the PIDs ever seen.
+// ProcessCPUPercent is the CPU usage since the previous collection, 100 per fully used CPU,
+// so it is only reported from the second collection a process is seen in.
+type ProcessCollector struct {
+	tracked  map[int32]*trackedProcess
+	names    map[string]bool
+	pidfiles []string
+}
+
+// NewProcessCollector creates a new ProcessCollector matching the processes by the names and the pidfiles.
+func NewProcessCollector(names, pidfiles []string) *ProcessCollector {
+	byName := make(map[string]bool, len(names))
+	for _, name := range names {
+		byName[name] = true
+	}
+	return &ProcessCollector{
+		tracked:  make(map[int32]*trackedProcess),
+		names:    byName,
+		pidfiles: pidfiles,
+	}
+}
+
+// Name implements the Collector interface.
+func (c *ProcessCollector) Name() string {
+	return ProcessCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *ProcessCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	matched, errs := c.match(ctx)
+
+	tracked := make(map[int32]*trackedProcess, len(matched))
+	var metrics []*models.Metric
+	index := make(map[string]int)
+	for _, m := range matched {
+		proc := m.proc
+		createTime, err := proc.CreateTimeWithContext(ctx)
+		if err != nil {
+			if !errors.Is(err, process.ErrorProcessNotRunning) {
+				errs = append(errs, fmt.Errorf("unable to inspect process %d: %w", proc.Pid, err))
+			}
+			continue
+		}
+
+		label := metricSuffix(m.label)
+		suffix := "_" + label
+		if i := index[label]; i > 0 {
+			suffix += "_" + strconv.Itoa(i)
+		}
+		index[label]++
+
+		// A known PID with another creation time has been reused by a new process.
+		previous, seen := c.tracked[proc.Pid]
+		if seen && previous.createTime == createTime {
+			proc = previous.proc
+		} else {
+			seen = false
+		}
+		tracked[proc.Pid] = &trackedProcess{proc: proc, createTime: createTime}
+
+		procMetrics, err := processMetrics(ctx, proc, suffix, seen)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		metrics = append(metrics, procMetrics...)
+	}
+	c.tracked = tracked
+
+	return metrics, errors.Join(errs...)
+}
+
+// matchedProcess is a process matched by a name or a pidfile, reported under the label of what matched it.
+type matchedProcess struct {
+	proc  *process.Process
+	label string
+}
+
+// match returns the processes matching the pidfiles or the names, ordered by label and PID.
+// A process matching both is reported under its pidfile, which selects it alone.
+func (c *ProcessCollector) match(ctx context.Context) ([]matchedProcess, []error) {
+	var errs []error
+	matched := make(map[int32]matchedProcess)
+
+	for _, pidfile := range c.pidfiles {
+		pid, err := readPidfile(pidfile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		proc, err := process.NewProcessWithContext(ctx, pid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("process %d of pidfile %s: %w", pid, pidfile, err))
+			continue
+		}
+		matched[proc.Pid] = matchedProcess{proc: proc, label: pidfileLabel(pidfile)}
+	}
+
+	if len(c.names) > 0 {
+		procs, err := process.ProcessesWithContext(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to list processes: %w", err))
+		}
+		for _, proc := range procs {
+			if _, ok := matched[proc.Pid]; ok {
+				continue
+			}
+			name, nameErr := proc.NameWithContext(ctx)
+			if nameErr == nil && c.names[name] {
+				matched[proc.Pid] = matchedProcess{proc: proc, label: name}
+			}
+		}
+	}
+
+	procs := make([]matchedProcess, 0, len(matched))
+	for _, m := range matched {
+		procs = append(procs, m)
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		if procs[i].label != procs[j].label {
+			return procs[i].label < procs[j].label
+		}
+		return procs[i].proc.Pid < procs[j].proc.Pid
+	})
+	return procs, errs
+}
+
+// pidfileLabel returns the label of the process of the pidfile: its base name without the extension.
+func pidfileLabel(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// processMetrics returns the metrics of the process, named with the suffix. CPU usage is only reported
+// for processes seen before. Metrics that cannot be read, e.g. the descriptors of another user's process,
+// are skipped and reported in the error.
+func processMetrics(ctx context.Context, proc *process.Process, suffix string, seen bool) ([]*models.Metric, error) {
+	var metrics []*models.Metric
+	var errs []error
+	add := func(metric string, value float64, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to get %s of process %d: %w", metric, proc.Pid, err))
+			return
+		}
+		metrics = append(metrics, &models.Metric{Name: metric + suffix, Type: models.GaugeType, Value: float64Ptr(value)})
+	}
+
+	percent, err := proc.PercentWithContext(ctx, 0)
+	if seen {
+		add("ProcessCPUPercent", percent, err)
+	}
+
+	var rss float64
+	memory, err := proc.MemoryInfoWithContext(ctx)
+	if err == nil {
+		rss = float64(memory.RSS)
+	}
+	add("ProcessRSS", rss, err)
+
+	fds, err := proc.NumFDsWithContext(ctx)
+	add("ProcessFDs", float64(fds), err)
+
+	threads, err := proc.NumThreadsWithContext(ctx)
+	add("ProcessThreads", float64(threads), err)
+
+	return metrics, errors.Join(errs...)
+}
+
+// readPidfile reads the PID written in the pidfile.
+func readPidfile(path string) (int32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read pidfile: %w", err)
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pidfile %s does not hold a valid PID", path)
+	}
+	return int32(pid), nil
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	self, err := process.NewProcess(int32(os.Getpid()))
+	require.NoError(t, err)
+	name, err := self.Name()
+	require.NoError(t, err)
+	pidfile := filepath.Join(t.TempDir(), "test.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600))
+
+	tests := []struct {
+		name     string
+		names    []string
+		pidfiles []string
+		suffix   string
+	}{
+		{name: "by name", names: []string{name}, suffix: "_" + metricSuffix(name)},
+		{name: "by pidfile", pidfiles: []string{pidfile}, suffix: "_test"},
+		{name: "by name and pidfile", names: []string{name}, pidfiles: []string{pidfile}, suffix: "_test"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suffix := test.suffix
+			c := NewProcessCollector(test.names, test.pidfiles)
+			assert.Equal(t, ProcessCollectorName, c.Name())
+
+			metrics, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.Len(t, metrics, 3, "one metric set for the process")
+			assert.Nil(t, metricByName("ProcessCPUPercent"+suffix, metrics), "CPU usage needs a previous collection")
+			for _, metric := range []string{"ProcessRSS", "ProcessFDs", "ProcessThreads"} {
+				m := metricByName(metric+suffix, metrics)
+				if assert.NotNil(t, m, "Expected %s to be collected", metric+suffix) {
+					assert.Positive(t, *m.Value)
+				}
+			}
+
+			metrics, err = c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.NotNil(t, metricByName("ProcessCPUPercent"+suffix, metrics))
+		})
+	}
+}
+
+func TestProcessCollector_SeveralProcesses(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not available")
+	}
+	var pids []int
+	for range 2 {
+		cmd := exec.Command(sleep, "30")
+		require.NoError(t, cmd.Start())
+		t.Cleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+		pids = append(pids, cmd.Process.Pid)
+	}
+
+	metrics, err := NewProcessCollector([]string{"sleep"}, nil).Collect(context.Background())
+	require.NoError(t, err)
+	assert.NotNil(t, metricByName("ProcessRSS_sleep", metrics))
+	assert.NotNil(t, metricByName("ProcessRSS_sleep_1", metrics))
+	for _, m := range metrics {
+		for _, pid := range pids {
+			assert.NotContains(t, m.Name, strconv.Itoa(pid), "metric names do not depend on PIDs")
+		}
+	}
+}
+
+func TestProcessCollector_Errors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.pid")
+	require.NoError(t, os.WriteFile(invalid, []byte("not a pid"), 0o600))
+
+	tests := []struct {
+		name    string
+		pidfile string
+	}{
+		{name: "missing pidfile", pidfile: filepath.Join(dir, "missing.pid")},
+		{name: "invalid pidfile", pidfile: invalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics, err := NewProcessCollector(nil, []string{test.pidfile}).Collect(context.Background())
+			assert.Error(t, err)
+			assert.Empty(t, metrics)
+		})
+	}
+
+	t.Run("no matching process", func(t *testing.T) {
+		metrics, err := NewProcessCollector([]string{"no-such-process-name"}, nil).Collect(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, metrics)
+	})
+}
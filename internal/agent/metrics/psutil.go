@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+	"math"
+	"runtime"
+)
+
+// PSUtilCollectorName is the name of the PSUtilCollector.
+const PSUtilCollectorName = "psutil"
+
+// PSUtilCollector collects memory and CPU utilization metrics of the host using PSUtil.
+//
+// CPU utilization is computed from the CPU times elapsed between two collections, so it does not block
+// the collection and covers the whole poll interval. It is reported from the second collection on:
+// CPUutilization<N> per CPU, CPUTotalPercent for all CPUs, and the share of the user, system, iowait
+// and steal modes in CPUUserPercent, CPUSystemPercent, CPUIowaitPercent and CPUStealPercent.
+// All values are percentages of the elapsed time, from 0 to 100.
+type PSUtilCollector struct {
+	times    func(ctx context.Context, perCPU bool) ([]cpu.TimesStat, error)
+	memory   func(ctx context.Context) (*mem.VirtualMemoryStat, error)
+	previous map[string]cpu.TimesStat
+}
+
+// NewPSUtilCollector creates a new PSUtilCollector.
+func NewPSUtilCollector() *PSUtilCollector {
+	return &PSUtilCollector{
+		times:    cpu.TimesWithContext,
+		memory:   mem.VirtualMemoryWithContext,
+		previous: make(map[string]cpu.TimesStat),
+	}
+}
+
+// Name implements the Collector interface.
+func (c *PSUtilCollector) Name() string {
+	return PSUtilCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *PSUtilCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	var metrics []*models.Metric
+	var errs []error
+
+	perCPU, err := c.times(ctx, true)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get cpu times: %w", err))
+	}
+	for i, current := range perCPU {
+		if previous, ok := c.previous[current.CPU]; ok {
+			metrics = append(metrics, &models.Metric{
+				Name:  fmt.Sprintf("CPUutilization%v", i),
+				Value: float64Ptr(cpuPercent(previous, current, cpuBusy)),
+				Type:  models.GaugeType,
+			})
+		}
+		c.previous[current.CPU] = current
+	}
+
+	total, err := c.times(ctx, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get total cpu times: %w", err))
+	}
+	for _, current := range total {
+		if previous, ok := c.previous[current.CPU]; ok {
+			metrics = append(metrics, cpuModeMetrics(previous, current)...)
+		}
+		c.previous[current.CPU] = current
+	}
+
+	memoryData, err := c.memory(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to get virtual memory info: %w", err))
+	} else {
+		metrics = append(metrics,
+			&models.Metric{Name: "TotalMemory", Value: float64Ptr(float64(memoryData.Total)), Type: models.GaugeType},
+			&models.Metric{Name: "FreeMemory", Value: float64Ptr(float64(memoryData.Free)), Type: models.GaugeType},
+		)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// cpuModeMetrics returns the busy share of all CPUs and the share of the user, system, iowait and steal modes.
+func cpuModeMetrics(previous, current cpu.TimesStat) []*models.Metric {
+	modes := []struct {
+		mode func(cpu.TimesStat) float64
+		name string
+	}{
+		{name: "CPUTotalPercent", mode: cpuBusy},
+		{name: "CPUUserPercent", mode: func(t cpu.TimesStat) float64 { return t.User }},
+		{name: "CPUSystemPercent", mode: func(t cpu.TimesStat) float64 { return t.System }},
+		{name: "CPUIowaitPercent", mode: func(t cpu.TimesStat) float64 { return t.Iowait }},
+		{name: "CPUStealPercent", mode: func(t cpu.TimesStat) float64 { return t.Steal }},
+	}
+	metrics := make([]*models.Metric, 0, len(modes))
+	for _, m := range modes {
+		metrics = append(metrics, &models.Metric{
+			Name:  m.name,
+			Value: float64Ptr(cpuPercent(previous, current, m.mode)),
+			Type:  models.GaugeType,
+		})
+	}
+	return metrics
+}
+
+// cpuPercent returns the share of the CPU time elapsed between the two CPU times spent in the mode, in percent.
+// If the times went backwards, e.g. after a CPU was brought offline and back, or no time elapsed, it is zero.
+func cpuPercent(previous, current cpu.TimesStat, mode func(cpu.TimesStat) float64) float64 {
+	elapsed := cpuTotal(current) - cpuTotal(previous)
+	if elapsed <= 0 {
+		return 0
+	}
+	return math.Min(100, math.Max(0, (mode(current)-mode(previous))/elapsed*100))
+}
+
+// cpuBusy returns the CPU time spent neither idle nor waiting for IO.
+func cpuBusy(t cpu.TimesStat) float64 {
+	return cpuTotal(t) - t.Idle - t.Iowait
+}
+
+// cpuTotal returns the total CPU time. On Linux, guest time is already included in the user time.
+func cpuTotal(t cpu.TimesStat) float64 {
+	total := t.Total()
+	if runtime.GOOS == "linux" {
+		total -= t.Guest + t.GuestNice
+	}
+	return total
+}
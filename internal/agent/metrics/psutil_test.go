@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPSUtilCollector(t *testing.T) {
+	c := NewPSUtilCollector()
+	assert.Equal(t, PSUtilCollectorName, c.Name())
+
+	first, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, metricByName("CPUutilization0", first), "CPU utilization needs two collections")
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	for _, name := range []string{"TotalMemory", "FreeMemory", "CPUutilization0", "CPUTotalPercent", "CPUUserPercent"} {
+		metric := metricByName(name, metrics)
+		if assert.NotNil(t, metric, "Expected %s to be collected", name) {
+			assert.NotNil(t, metric.Value)
+		}
+	}
+}
+
+func TestPSUtilCollector_CPUDeltas(t *testing.T) {
+	c := NewPSUtilCollector()
+	c.memory = func(_ context.Context) (*mem.VirtualMemoryStat, error) {
+		return &mem.VirtualMemoryStat{Total: 100, Free: 40}, nil
+	}
+	samples := [][]cpu.TimesStat{
+		{
+			{CPU: "cpu0", User: 10, System: 5, Idle: 80, Iowait: 5},
+			{CPU: "cpu1", User: 20, System: 10, Idle: 70},
+			{CPU: "cpu-total", User: 30, System: 15, Idle: 150, Iowait: 5},
+		},
+		{
+			{CPU: "cpu0", User: 30, System: 15, Idle: 120, Iowait: 15, Steal: 20},
+			{CPU: "cpu1", User: 20, System: 10, Idle: 170},
+			{CPU: "cpu-total", User: 50, System: 25, Idle: 290, Iowait: 15, Steal: 20},
+		},
+	}
+	sample := 0
+	c.times = func(_ context.Context, perCPU bool) ([]cpu.TimesStat, error) {
+		if perCPU {
+			return samples[sample][:2], nil
+		}
+		return samples[sample][2:], nil
+	}
+
+	first, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, first, 2, "only memory is reported on the first collection")
+
+	sample++
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	expected := map[string]float64{
+		"CPUutilization0":  50, // 50 busy of 100
+		"CPUutilization1":  0,
+		"CPUTotalPercent":  25, // 50 busy of 200
+		"CPUUserPercent":   10,
+		"CPUSystemPercent": 5,
+		"CPUIowaitPercent": 5,
+		"CPUStealPercent":  10,
+		"TotalMemory":      100,
+		"FreeMemory":       40,
+	}
+	for name, value := range expected {
+		metric := metricByName(name, metrics)
+		if assert.NotNil(t, metric, "Expected %s to be collected", name) {
+			assert.InDelta(t, value, *metric.Value, 1e-9, name)
+		}
+	}
+	assert.Len(t, metrics, len(expected))
+
+	t.Run("times going backwards", func(t *testing.T) {
+		samples = append(samples, samples[0])
+		sample++
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, *metricByName("CPUTotalPercent", metrics).Value)
+		assert.Equal(t, 0.0, *metricByName("CPUutilization0", metrics).Value)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		c.times = func(_ context.Context, _ bool) ([]cpu.TimesStat, error) {
+			return nil, errors.New("unavailable")
+		}
+		metrics, err := c.Collect(context.Background())
+		assert.Error(t, err)
+		assert.NotNil(t, metricByName("TotalMemory", metrics), "other metrics are still collected")
+	})
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Factory creates a new instance of a collector.
+type Factory func() (Collector, error)
+
+type registration struct {
+	factory Factory
+	name    string
+	enabled bool
+}
+
+// Registry maps collector names to the factories creating them.
+type Registry struct {
+	registrations []registration
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Options configures the built-in collectors.
+type Options struct {
+	// DiskInclude lists the patterns of mount points reported by the disk collector, all if empty.
+	DiskInclude []string
+	// DiskExclude lists the patterns of mount points not reported by the disk collector.
+	DiskExclude []string
+	// ProcessNames lists the names of the processes reported by the process collector.
+	ProcessNames []string
+	// ProcessPidfiles lists the pidfiles of the processes reported by the process collector.
+	ProcessPidfiles []string
+	// StatsDAddress is the UDP address the statsd collector listens on.
+	StatsDAddress string
+}
+
+// DefaultRegistry creates a registry of the built-in collectors configured with the options.
+func DefaultRegistry(opts Options) *Registry {
+	r := NewRegistry()
+	r.Register(RuntimeCollectorName, func() (Collector, error) {
+		return NewRuntimeCollector(), nil
+	}, true)
+	r.Register(PSUtilCollectorName, func() (Collector, error) {
+		return NewPSUtilCollector(), nil
+	}, true)
+	r.Register(DiskCollectorName, func() (Collector, error) {
+		return NewDiskCollector(opts.DiskInclude, opts.DiskExclude)
+	}, true)
+	r.Register(NetworkCollectorName, func() (Collector, error) {
+		return NewNetworkCollector(), nil
+	}, true)
+	r.Register(LoadCollectorName, func() (Collector, error) {
+		return NewLoadCollector(), nil
+	}, true)
+	r.Register(HostCollectorName, func() (Collector, error) {
+		return NewHostCollector(), nil
+	}, true)
+	r.Register(SwapCollectorName, func() (Collector, error) {
+		return NewSwapCollector(), nil
+	}, true)
+	r.Register(ProcessCollectorName, func() (Collector, error) {
+		return NewProcessCollector(opts.ProcessNames, opts.ProcessPidfiles), nil
+	}, len(opts.ProcessNames) > 0 || len(opts.ProcessPidfiles) > 0)
+	r.Register(StatsDCollectorName, func() (Collector, error) {
+		return NewStatsDCollector(opts.StatsDAddress)
+	}, opts.StatsDAddress != "")
+	return r
+}
+
+// Register adds a collector to the registry.
+// A collector enabled by default runs unless it is disabled in the configuration,
+// any other collector only runs when enabled explicitly.
+// Register panics if a collector with the same name is already registered.
+func (r *Registry) Register(name string, factory Factory, enabled bool) {
+	if _, ok := r.lookup(name); ok {
+		panic(fmt.Sprintf("collector %q is already registered", name))
+	}
+	r.registrations = append(r.registrations, registration{name: name, factory: factory, enabled: enabled})
+}
+
+// Names returns the names of the registered collectors in the order of registration.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.registrations))
+	for _, reg := range r.registrations {
+		names = append(names, reg.name)
+	}
+	return names
+}
+
+func (r *Registry) lookup(name string) (registration, bool) {
+	for _, reg := range r.registrations {
+		if reg.name == name {
+			return reg, true
+		}
+	}
+	return registration{}, false
+}
+
+// Build creates the enabled collectors, in the order of registration.
+// Collectors run at the configured interval, or at defaultInterval if none is configured.
+// It returns an error if the configuration refers to a collector that is not registered,
+// or if an enabled collector cannot be created.
+func (r *Registry) Build(configs []CollectorConfig, defaultInterval time.Duration) ([]ScheduledCollector, error) {
+	overrides := make(map[string]CollectorConfig, len(configs))
+	for _, cfg := range configs {
+		if _, ok := r.lookup(cfg.Name); !ok {
+			return nil, fmt.Errorf("unknown collector %q, available collectors: %s", cfg.Name, strings.Join(r.Names(), ", "))
+		}
+		overrides[cfg.Name] = cfg
+	}
+
+	var collectors []ScheduledCollector
+	for _, reg := range r.registrations {
+		enabled, interval := reg.enabled, defaultInterval
+		if cfg, ok := overrides[reg.name]; ok {
+			enabled = cfg.Enabled
+			if cfg.Interval > 0 {
+				interval = cfg.Interval
+			}
+		}
+		if !enabled {
+			continue
+		}
+		collector, err := reg.factory()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create collector %q: %w", reg.name, err)
+		}
+		collectors = append(collectors, ScheduledCollector{Collector: collector, Interval: interval})
+	}
+	return collectors, nil
+}
+
+// CollectorConfig enables or disables a collector and sets its interval.
+type CollectorConfig struct {
+	Name     string
+	Interval time.Duration
+	Enabled  bool
+}
+
+// ParseCollectorConfigs parses a comma-separated list of collector settings, each of them one of:
+//
+//	name           enable the collector
+//	name=off       disable the collector
+//	name=<seconds> enable the collector and run it at the given interval
+//
+// For example, "runtime=5,psutil=off" collects runtime metrics every five seconds and no PSUtil metrics.
+func ParseCollectorConfigs(spec string) ([]CollectorConfig, error) {
+	var configs []CollectorConfig
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(item, "=")
+		cfg := CollectorConfig{Name: strings.TrimSpace(name), Enabled: true}
+		value = strings.TrimSpace(value)
+		switch {
+		case !hasValue || value == "on":
+		case value == "off":
+			cfg.Enabled = false
+		default:
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return nil, fmt.Errorf("invalid interval of collector %q: %q", cfg.Name, value)
+			}
+			cfg.Interval = time.Duration(seconds) * time.Second
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCollectorConfigs(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected []CollectorConfig
+		wantErr  bool
+	}{
+		{name: "empty", spec: ""},
+		{
+			name: "enable, disable and interval",
+			spec: "runtime=5, psutil=off,disk",
+			expected: []CollectorConfig{
+				{Name: "runtime", Interval: 5 * time.Second, Enabled: true},
+				{Name: "psutil", Enabled: false},
+				{Name: "disk", Enabled: true},
+			},
+		},
+		{name: "explicitly on", spec: "psutil=on", expected: []CollectorConfig{{Name: "psutil", Enabled: true}}},
+		{name: "invalid interval", spec: "runtime=fast", wantErr: true},
+		{name: "non-positive interval", spec: "runtime=0", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configs, err := ParseCollectorConfigs(test.spec)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, configs)
+		})
+	}
+}
+
+func TestRegistry_Build(t *testing.T) {
+	r := NewRegistry()
+	r.Register("a", func() (Collector, error) { return &fakeCollector{name: "a"}, nil }, true)
+	r.Register("b", func() (Collector, error) { return &fakeCollector{name: "b"}, nil }, true)
+	r.Register("c", func() (Collector, error) { return &fakeCollector{name: "c"}, nil }, false)
+
+	names := func(collectors []ScheduledCollector) map[string]time.Duration {
+		result := make(map[string]time.Duration)
+		for _, sc := range collectors {
+			result[sc.Collector.Name()] = sc.Interval
+		}
+		return result
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		collectors, err := r.Build(nil, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]time.Duration{"a": 2 * time.Second, "b": 2 * time.Second}, names(collectors))
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		collectors, err := r.Build([]CollectorConfig{
+			{Name: "a", Interval: 10 * time.Second, Enabled: true},
+			{Name: "b", Enabled: false},
+			{Name: "c", Enabled: true},
+		}, 2*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]time.Duration{"a": 10 * time.Second, "c": 2 * time.Second}, names(collectors))
+	})
+
+	t.Run("unknown collector", func(t *testing.T) {
+		_, err := r.Build([]CollectorConfig{{Name: "x", Enabled: true}}, time.Second)
+		assert.ErrorContains(t, err, `unknown collector "x"`)
+	})
+
+	t.Run("duplicate registration", func(t *testing.T) {
+		assert.Panics(t, func() {
+			r.Register("a", func() (Collector, error) { return &fakeCollector{name: "a"}, nil }, true)
+		})
+	})
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	assert.Equal(t, []string{
+		RuntimeCollectorName, PSUtilCollectorName, DiskCollectorName, NetworkCollectorName,
+		LoadCollectorName, HostCollectorName, SwapCollectorName, ProcessCollectorName, StatsDCollectorName,
+	}, DefaultRegistry(Options{}).Names())
+}
+
+func TestRegistry_BuildFactoryError(t *testing.T) {
+	r := NewRegistry()
+	r.Register("broken", func() (Collector, error) { return nil, errors.New("invalid options") }, false)
+
+	_, err := r.Build(nil, time.Second)
+	assert.NoError(t, err, "disabled collectors are not created")
+
+	_, err = r.Build([]CollectorConfig{{Name: "broken", Enabled: true}}, time.Second)
+	assert.ErrorContains(t, err, "invalid options")
+}
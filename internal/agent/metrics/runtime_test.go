@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func metricByName(name string, metrics []*models.Metric) *models.Metric {
+	for _, metric := range metrics {
+		if metric.Name == name {
+			return metric
+		}
+	}
+	return nil
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	c := NewRuntimeCollector()
+	assert.Equal(t, RuntimeCollectorName, c.Name())
+
+	first, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	second, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	t.Run("check PollCount increments", func(t *testing.T) {
+		pollCount := metricByName("PollCount", second)
+		require.NotNil(t, pollCount)
+		assert.Equal(t, models.CounterType, pollCount.Type)
+		assert.Equal(t, int64(1), *pollCount.Delta)
+		assert.Equal(t, int64(1), *metricByName("PollCount", first).Delta)
+	})
+
+	t.Run("check RandomValue changes", func(t *testing.T) {
+		assert.NotEqualValues(t, metricByName("RandomValue", first).Value, metricByName("RandomValue", second).Value)
+	})
+
+	t.Run("check memory stats", func(t *testing.T) {
+		alloc := metricByName("Alloc", second)
+		require.NotNil(t, alloc)
+		assert.Equal(t, models.GaugeType, alloc.Type)
+		assert.Positive(t, *alloc.Value)
+	})
+}
+
+func BenchmarkRuntimeCollector_Collect(b *testing.B) {
+	c := NewRuntimeCollector()
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c.Collect(context.Background())
+	}
+}
@@ -0,0 +1,297 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"go.uber.org/zap"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsDCollectorName is the name of the StatsDCollector.
+const StatsDCollectorName = "statsd"
+
+const (
+	// StatsDMetricPrefix is prepended to the names of StatsD metrics, so they cannot shadow the agent's own metrics.
+	StatsDMetricPrefix = "StatsD_"
+	// DefaultStatsDMaxNames is the default number of distinct metrics aggregated between collections.
+	DefaultStatsDMaxNames = 1000
+	// DefaultStatsDGaugeTTL is the default time after which a gauge that is not updated is no longer reported.
+	DefaultStatsDGaugeTTL = 10 * time.Minute
+
+	// statsdPacketSize is the size of the largest UDP datagram.
+	statsdPacketSize = 65535
+	// statsdMaxNameLength is the length of the longest accepted metric name.
+	statsdMaxNameLength = 200
+)
+
+// statsdMaxIncrement is the largest counter increment reported by a collection, the largest float64 below 2^63,
+// so it converts to an int64. Larger increments are carried into the next collections.
+var statsdMaxIncrement = math.Nextafter(math.MaxInt64, 0)
+
+// StatsDCollector listens for metrics pushed by applications over UDP in the StatsD format
+// and aggregates them until they are collected.
+//
+// Every line of a packet holds a metric, "<name>:<value>|<type>[|@<sample rate>][|#<tags>]":
+//   - counters ("c") are summed and reported as the increments since the previous collection;
+//     a value sampled at a rate is counted as value/rate, fractions are carried into the next collection;
+//   - gauges ("g") keep their latest value, a value with a sign, e.g. "+3" or "-3", changes the current one.
+//     Gauges that are not updated for the gauge TTL are no longer reported.
+//
+// Other types and tags are not supported and ignored. Names may hold letters, digits, "_", "-" and ".",
+// and metrics are reported under their name prefixed with StatsDMetricPrefix. Metrics with new names
+// are dropped while the maximum number of distinct metrics is aggregated.
+type StatsDCollector struct {
+	now      func() time.Time
+	conn     net.PacketConn
+	served   chan struct{}      // closed once the packets received before Close are aggregated
+	counters map[string]float64 // increments not collected yet, including fractions left by previous collections
+	gauges   map[string]statsdGauge
+	maxNames int
+	gaugeTTL time.Duration
+	dropped  int // samples dropped since the previous collection because of maxNames
+	mu       sync.Mutex
+}
+
+// statsdGauge is the latest value of a gauge and the time it was updated at.
+type statsdGauge struct {
+	updated time.Time
+	value   float64
+}
+
+// statsdSample is a metric parsed from a StatsD line.
+type statsdSample struct {
+	name     string
+	kind     models.MetricType
+	value    float64
+	rate     float64
+	relative bool
+}
+
+// NewStatsDCollector creates a new StatsDCollector listening on the UDP address, e.g. "127.0.0.1:8125".
+// Any host can push metrics to an address that is not a loopback one, such as ":8125", so a warning is logged.
+func NewStatsDCollector(address string) (*StatsDCollector, error) {
+	if address == "" {
+		return nil, errors.New("statsd collector requires a listen address")
+	}
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for StatsD metrics: %w", err)
+	}
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && !addr.IP.IsLoopback() {
+		logger.Log.Warn("StatsD metrics are accepted from other hosts", zap.String("address", addr.String()))
+	}
+
+	c := &StatsDCollector{
+		now:      time.Now,
+		conn:     conn,
+		served:   make(chan struct{}),
+		counters: make(map[string]float64),
+		gauges:   make(map[string]statsdGauge),
+		maxNames: DefaultStatsDMaxNames,
+		gaugeTTL: DefaultStatsDGaugeTTL,
+	}
+	go c.serve()
+	return c, nil
+}
+
+// Addr returns the address the collector listens on.
+func (c *StatsDCollector) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Close stops listening. It returns once the packet being read, if any, is aggregated,
+// so the next collection reports every packet read.
+func (c *StatsDCollector) Close() error {
+	err := c.conn.Close()
+	<-c.served
+	return err
+}
+
+// Name implements the Collector interface.
+func (c *StatsDCollector) Name() string {
+	return StatsDCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *StatsDCollector) Collect(_ context.Context) ([]*models.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dropped > 0 {
+		logger.Log.Warn("StatsD metrics dropped, too many distinct names",
+			zap.Int("dropped", c.dropped),
+			zap.Int("max_names", c.maxNames),
+		)
+		c.dropped = 0
+	}
+
+	now := c.now()
+	metrics := make([]*models.Metric, 0, len(c.gauges)+len(c.counters))
+	for _, name := range sortedKeys(c.gauges) {
+		gauge := c.gauges[name]
+		if now.Sub(gauge.updated) > c.gaugeTTL {
+			delete(c.gauges, name)
+			continue
+		}
+		metrics = append(metrics, &models.Metric{Name: StatsDMetricPrefix + name, Type: models.GaugeType, Value: float64Ptr(gauge.value)})
+	}
+	for _, name := range sortedKeys(c.counters) {
+		increment := math.Max(-statsdMaxIncrement, math.Min(statsdMaxIncrement, math.Trunc(c.counters[name])))
+		if remainder := c.counters[name] - increment; remainder != 0 {
+			c.counters[name] = remainder
+		} else {
+			delete(c.counters, name)
+		}
+		if increment != 0 {
+			delta := int64(increment)
+			metrics = append(metrics, &models.Metric{Name: StatsDMetricPrefix + name, Type: models.CounterType, Delta: &delta})
+		}
+	}
+	return metrics, nil
+}
+
+// serve reads packets until the connection is closed.
+func (c *StatsDCollector) serve() {
+	defer close(c.served)
+	buf := make([]byte, statsdPacketSize)
+	for {
+		n, _, err := c.conn.ReadFrom(buf)
+		if n > 0 {
+			c.handlePacket(string(buf[:n]))
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Log.Warn("unable to read StatsD packet", zap.Error(err))
+		}
+	}
+}
+
+// handlePacket aggregates the metrics of the packet. Invalid lines are logged and skipped.
+func (c *StatsDCollector) handlePacket(packet string) {
+	var samples []statsdSample
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sample, err := parseStatsD(line)
+		if err != nil {
+			logger.Log.Debug("invalid StatsD metric", zap.String("line", line), zap.Error(err))
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, sample := range samples {
+		if !c.tracks(sample) && len(c.counters)+len(c.gauges) >= c.maxNames {
+			c.dropped++
+			continue
+		}
+		switch {
+		case sample.kind == models.CounterType:
+			c.counters[sample.name] += sample.value / sample.rate
+		case sample.relative:
+			c.gauges[sample.name] = statsdGauge{updated: now, value: c.gauges[sample.name].value + sample.value}
+		default:
+			c.gauges[sample.name] = statsdGauge{updated: now, value: sample.value}
+		}
+	}
+}
+
+// tracks reports whether the metric of the sample is already aggregated.
+func (c *StatsDCollector) tracks(sample statsdSample) bool {
+	if sample.kind == models.CounterType {
+		_, ok := c.counters[sample.name]
+		return ok
+	}
+	_, ok := c.gauges[sample.name]
+	return ok
+}
+
+// parseStatsD parses a StatsD line, "<name>:<value>|<type>[|@<sample rate>][|#<tags>]".
+func parseStatsD(line string) (statsdSample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return statsdSample{}, errors.New("missing metric name")
+	}
+	if !validStatsDName(name) {
+		return statsdSample{}, fmt.Errorf("invalid metric name %q", name)
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return statsdSample{}, errors.New("missing metric type")
+	}
+
+	sample := statsdSample{name: name, rate: 1}
+	switch fields[1] {
+	case "c":
+		sample.kind = models.CounterType
+	case "g":
+		sample.kind = models.GaugeType
+		sample.relative = strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-")
+	default:
+		return statsdSample{}, fmt.Errorf("unsupported metric type %q", fields[1])
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return statsdSample{}, fmt.Errorf("invalid metric value %q", fields[0])
+	}
+	sample.value = value
+
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, rateErr := strconv.ParseFloat(field[1:], 64)
+			if rateErr != nil || rate <= 0 || rate > 1 {
+				return statsdSample{}, fmt.Errorf("invalid sample rate %q", field[1:])
+			}
+			sample.rate = rate
+		case strings.HasPrefix(field, "#"):
+			// Tags are not supported.
+		default:
+			return statsdSample{}, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	if sample.kind == models.CounterType && math.Abs(sample.value/sample.rate) > statsdMaxIncrement {
+		return statsdSample{}, fmt.Errorf("counter value %q out of range", fields[0])
+	}
+	return sample, nil
+}
+
+// validStatsDName reports whether the name is not too long and only holds letters, digits, "_", "-" and ".".
+func validStatsDName(name string) bool {
+	if len(name) > statsdMaxNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
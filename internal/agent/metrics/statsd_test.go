@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsD(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected statsdSample
+		wantErr  bool
+	}{
+		{line: "api.requests:1|c", expected: statsdSample{name: "api.requests", kind: models.CounterType, value: 1, rate: 1}},
+		{line: "api.requests:2|c|@0.1", expected: statsdSample{name: "api.requests", kind: models.CounterType, value: 2, rate: 0.1}},
+		{line: "queue.size:42.5|g", expected: statsdSample{name: "queue.size", kind: models.GaugeType, value: 42.5, rate: 1}},
+		{line: "queue.size:-3|g", expected: statsdSample{name: "queue.size", kind: models.GaugeType, value: -3, rate: 1, relative: true}},
+		{line: "queue.size:+3|g|#env:prod", expected: statsdSample{name: "queue.size", kind: models.GaugeType, value: 3, rate: 1, relative: true}},
+		{line: "api.latency:320|ms", wantErr: true},
+		{line: "api.requests|c", wantErr: true},
+		{line: ":1|c", wantErr: true},
+		{line: "api.requests:1", wantErr: true},
+		{line: "api.requests:one|c", wantErr: true},
+		{line: "api.requests:NaN|c", wantErr: true},
+		{line: "api.requests:1|c|@0", wantErr: true},
+		{line: "api.requests:1|c|@2", wantErr: true},
+		{line: "api.requests:1|c|x", wantErr: true},
+		{line: "api requests:1|c", wantErr: true},
+		{line: "api/requests:1|c", wantErr: true},
+		{line: "api.requests:1e19|c", wantErr: true},
+		{line: "api.requests:-1e19|c", wantErr: true},
+		{line: "api.requests:1e18|c|@0.01", wantErr: true},
+		{line: "api.requests:1e18|c", expected: statsdSample{name: "api.requests", kind: models.CounterType, value: 1e18, rate: 1}},
+		{line: "queue.size:1e19|g", expected: statsdSample{name: "queue.size", kind: models.GaugeType, value: 1e19, rate: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			sample, err := parseStatsD(test.line)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, sample)
+		})
+	}
+}
+
+func TestStatsDCollector(t *testing.T) {
+	c, err := NewStatsDCollector("127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, StatsDCollectorName, c.Name())
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	send := func(packet string) {
+		_, err := conn.Write([]byte(packet))
+		require.NoError(t, err)
+	}
+	// collect waits until the collector has received the expected number of metrics.
+	collect := func(count int) []*models.Metric {
+		var metrics []*models.Metric
+		require.Eventually(t, func() bool {
+			c.mu.Lock()
+			received := len(c.gauges) + len(c.counters)
+			c.mu.Unlock()
+			if received < count {
+				return false
+			}
+			metrics, err = c.Collect(context.Background())
+			return err == nil
+		}, time.Second, time.Millisecond)
+		return metrics
+	}
+
+	send("api.requests:1|c\napi.requests:2|c\nqueue.size:10|g\nbroken line\napi.latency:5|ms")
+	send("queue.size:-3|g\napi.errors:1|c|@0.5\nqueue.size:+1|g")
+	assert.Equal(t, []*models.Metric{
+		gauge("StatsD_queue.size", 8),
+		counter("StatsD_api.errors", 2),
+		counter("StatsD_api.requests", 3),
+	}, collect(3), "counters are summed and scaled by the sample rate, gauges changed by signed values")
+
+	t.Run("next collection", func(t *testing.T) {
+		send("api.requests:1|c|@0.3")
+		assert.Equal(t, []*models.Metric{gauge("StatsD_queue.size", 8), counter("StatsD_api.requests", 3)}, collect(2),
+			"gauges keep their value and counter fractions are carried over")
+
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []*models.Metric{gauge("StatsD_queue.size", 8)}, metrics)
+	})
+}
+
+func TestStatsDCollector_Close(t *testing.T) {
+	c, err := NewStatsDCollector("127.0.0.1:0")
+	require.NoError(t, err)
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("api.requests:2|c"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.counters) == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, c.Close())
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*models.Metric{counter("StatsD_api.requests", 2)}, metrics, "counters received before Close are collected")
+
+	listener, err := net.ListenPacket("udp", c.Addr().String())
+	require.NoError(t, err, "the address is released")
+	listener.Close()
+}
+
+// newTestStatsDCollector returns a collector that is not listening, with a fake clock.
+func newTestStatsDCollector(now *time.Time) *StatsDCollector {
+	return &StatsDCollector{
+		now:      func() time.Time { return *now },
+		counters: make(map[string]float64),
+		gauges:   make(map[string]statsdGauge),
+		maxNames: DefaultStatsDMaxNames,
+		gaugeTTL: DefaultStatsDGaugeTTL,
+	}
+}
+
+func TestStatsDCollector_Limits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	t.Run("gauges expire", func(t *testing.T) {
+		c := newTestStatsDCollector(&now)
+		c.handlePacket("stale:1|g\nfresh:1|g")
+		now = now.Add(DefaultStatsDGaugeTTL)
+		c.handlePacket("fresh:2|g")
+		now = now.Add(time.Second)
+
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []*models.Metric{gauge("StatsD_fresh", 2)}, metrics)
+		assert.NotContains(t, c.gauges, "stale")
+	})
+
+	t.Run("distinct names are capped", func(t *testing.T) {
+		c := newTestStatsDCollector(&now)
+		c.maxNames = 2
+		c.handlePacket("a:1|c\nb:1|g\nc:1|c\na:2|c\nb:3|g")
+		assert.Equal(t, 1, c.dropped)
+
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []*models.Metric{gauge("StatsD_b", 3), counter("StatsD_a", 3)}, metrics,
+			"metrics already aggregated are still updated")
+		assert.Zero(t, c.dropped, "dropped metrics are reported by the collection")
+	})
+
+	t.Run("large increments are carried over", func(t *testing.T) {
+		c := newTestStatsDCollector(&now)
+		c.handlePacket("big:9e18|c\nbig:9e18|c")
+
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, int64(statsdMaxIncrement), *metrics[0].Delta)
+
+		metrics, err = c.Collect(context.Background())
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, int64(18e18-statsdMaxIncrement), *metrics[0].Delta)
+	})
+}
+
+func TestNewStatsDCollector_Errors(t *testing.T) {
+	_, err := NewStatsDCollector("")
+	assert.Error(t, err, "an address is required")
+
+	c, err := NewStatsDCollector("127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = NewStatsDCollector(c.Addr().String())
+	assert.Error(t, err, "the address is already in use")
+}
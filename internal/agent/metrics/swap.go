@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+// SwapCollectorName is the name of the SwapCollector.
+const SwapCollectorName = "swap"
+
+// SwapCollector collects the usage of the swap space. All values are zero on hosts without swap.
+type SwapCollector struct {
+	swap func(ctx context.Context) (*mem.SwapMemoryStat, error)
+}
+
+// NewSwapCollector creates a new SwapCollector.
+func NewSwapCollector() *SwapCollector {
+	return &SwapCollector{swap: mem.SwapMemoryWithContext}
+}
+
+// Name implements the Collector interface.
+func (c *SwapCollector) Name() string {
+	return SwapCollectorName
+}
+
+// Collect implements the Collector interface.
+func (c *SwapCollector) Collect(ctx context.Context) ([]*models.Metric, error) {
+	swap, err := c.swap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get swap usage: %w", err)
+	}
+	return []*models.Metric{
+		{Name: "SwapTotal", Type: models.GaugeType, Value: float64Ptr(float64(swap.Total))},
+		{Name: "SwapUsed", Type: models.GaugeType, Value: float64Ptr(float64(swap.Used))},
+		{Name: "SwapFree", Type: models.GaugeType, Value: float64Ptr(float64(swap.Free))},
+		{Name: "SwapUsedPercent", Type: models.GaugeType, Value: float64Ptr(swap.UsedPercent)},
+	}, nil
+}
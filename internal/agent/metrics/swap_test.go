@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapCollector(t *testing.T) {
+	c := NewSwapCollector()
+	assert.Equal(t, SwapCollectorName, c.Name())
+
+	c.swap = func(_ context.Context) (*mem.SwapMemoryStat, error) {
+		return &mem.SwapMemoryStat{Total: 400, Used: 100, Free: 300, UsedPercent: 25}, nil
+	}
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*models.Metric{
+		gauge("SwapTotal", 400), gauge("SwapUsed", 100), gauge("SwapFree", 300), gauge("SwapUsedPercent", 25),
+	}, metrics)
+
+	t.Run("error", func(t *testing.T) {
+		c.swap = func(_ context.Context) (*mem.SwapMemoryStat, error) {
+			return nil, errors.New("permission denied")
+		}
+		metrics, err := c.Collect(context.Background())
+		assert.Error(t, err)
+		assert.Empty(t, metrics)
+	})
+}
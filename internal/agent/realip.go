@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"errors"
+	"net"
+)
+
+// realIPHeader is the header carrying the agent address, checked by the server against its trusted subnet.
+// It is sent as "x-real-ip" metadata over gRPC.
+const realIPHeader = "X-Real-IP"
+
+// OutboundIP returns the address of the local interface used to reach the server at the given host:port.
+// No packets are sent: connecting a UDP socket only selects the route.
+func OutboundIP(serverAddr string) (net.IP, error) {
+	conn, err := net.Dial("udp", serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, errors.New("unexpected local address type")
+	}
+	return addr.IP, nil
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+)
+
+func TestOutboundIP(t *testing.T) {
+	ip, err := OutboundIP("127.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !ip.IsLoopback() {
+		t.Errorf("Expected loopback address, got %s", ip)
+	}
+
+	if _, err = OutboundIP("not an address"); err == nil {
+		t.Error("Expected error for invalid address, got nil")
+	}
+}
+
+func TestClient_SendDataRealIP(t *testing.T) {
+	var realIP string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realIP = r.Header.Get("X-Real-IP")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testURL, _ := url.Parse(server.URL)
+	client := NewClient(testURL)
+
+	metricValue := 1.0
+	err := client.SendData([]*models.Metric{{Name: "test", Type: models.GaugeType, Value: &metricValue}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if ip := net.ParseIP(realIP); ip == nil || !ip.IsLoopback() {
+		t.Errorf("Expected X-Real-IP to be a loopback address, got %q", realIP)
+	}
+}
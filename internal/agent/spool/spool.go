@@ -0,0 +1,358 @@
+// Package spool keeps the batches of metrics the agent failed to send on disk,
+// so they are sent once the server is reachable again, even after the agent restarts.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxSize is the default total size of the segments in bytes.
+	DefaultMaxSize = 64 << 20
+	// DefaultMaxAge is the default age after which a segment is dropped.
+	DefaultMaxAge = 24 * time.Hour
+	// DefaultSegmentDuration is the default period of time whose batches are merged into a segment.
+	DefaultSegmentDuration = time.Minute
+
+	segmentExt = ".json"
+	tmpExt     = ".tmp"
+)
+
+// ErrRejected marks the errors of segments whose content the server refused, e.g. with 400 Bad Request.
+// Replay drops such segments instead of keeping them to send again; segments refused for any other reason,
+// e.g. a revoked key, are kept.
+var ErrRejected = errors.New("spooled metrics rejected")
+
+// Options configures the bounds of a spool. Zero values fall back to the defaults.
+type Options struct {
+	// MaxSize is the total size of the segments in bytes; the oldest segments are dropped beyond it.
+	MaxSize int64
+	// MaxAge is the age after which a segment is dropped, its metrics being too old to be of use.
+	MaxAge time.Duration
+	// SegmentDuration is the period of time whose batches are merged into the same segment.
+	SegmentDuration time.Duration
+}
+
+// segment is a file holding the merged metrics of the batches stored within a period of time.
+type segment struct {
+	created time.Time
+	path    string
+	size    int64
+}
+
+// Spool stores batches of metrics in segment files in a directory and replays them in the order they were stored.
+//
+// Batches stored within the same period of time are merged into a single segment to keep the spool compact:
+// gauges keep their latest value and counter increments are summed. Segments are dropped once they are
+// older than the maximum age, and the oldest ones once the spool exceeds its maximum size.
+// It is safe for concurrent use.
+type Spool struct {
+	now      func() time.Time
+	dir      string
+	segments []*segment       // ordered from the oldest, the last one being written to
+	tail     []*models.Metric // merged metrics of the last segment, nil if not read yet
+	taken    *segment         // segment taken out by Replay while it is sent, nil if none
+	opts     Options
+	mu       sync.Mutex
+	replay   sync.Mutex // serializes replays, so segments are sent in order
+}
+
+// Open opens the spool in the directory, creating it if needed.
+// Segments left by a previous run are kept and replayed first.
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.SegmentDuration <= 0 {
+		opts.SegmentDuration = DefaultSegmentDuration
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create spool directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, opts: opts, now: time.Now}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, tmpExt) {
+			// Left by an interrupted write, the segment it replaced is intact.
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		nanos, parseErr := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) || parseErr != nil {
+			continue
+		}
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			return nil, fmt.Errorf("unable to read spool segment: %w", infoErr)
+		}
+		s.segments = append(s.segments, &segment{
+			created: time.Unix(0, nanos),
+			path:    filepath.Join(dir, name),
+			size:    info.Size(),
+		})
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].created.Before(s.segments[j].created)
+	})
+	return s, nil
+}
+
+// Len returns the number of segments waiting to be replayed.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+// Store adds the batch to the spool, merging it into the current segment.
+func (s *Spool) Store(metrics []*models.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.expire(now)
+
+	last := len(s.segments) - 1
+	rotate := last < 0 || now.Sub(s.segments[last].created) >= s.opts.SegmentDuration
+	if !rotate && s.tail == nil {
+		// The segment was left by a previous run.
+		tail, err := readSegment(s.segments[last].path)
+		if err != nil {
+			logger.Log.Error("dropping unreadable spool segment", zap.String("segment", s.segments[last].path), zap.Error(err))
+			s.remove(last)
+			rotate = true
+		}
+		s.tail = tail
+	}
+	if rotate {
+		created := now
+		if s.taken != nil && !created.After(s.taken.created) {
+			// The new segment must follow the one being sent and must not replace its file.
+			created = s.taken.created.Add(time.Nanosecond)
+		}
+		s.segments = append(s.segments, &segment{
+			created: created,
+			path:    filepath.Join(s.dir, fmt.Sprintf("%020d%s", created.UnixNano(), segmentExt)),
+		})
+		s.tail = nil
+	}
+
+	merged := merge(s.tail, metrics)
+	current := s.segments[len(s.segments)-1]
+	size, err := writeSegment(current.path, merged)
+	if err != nil {
+		return err
+	}
+	current.size = size
+	s.tail = merged
+
+	s.shrink()
+	return nil
+}
+
+// Replay sends the segments with send, from the oldest one, removing every segment once it is sent.
+// It stops at the first segment that cannot be sent and returns the error, the segment being kept,
+// unless the error wraps ErrRejected: such a segment would never be accepted, so it is dropped.
+// Segments that cannot be read are dropped.
+//
+// A segment is taken out of the spool while it is sent, so batches stored meanwhile go to a new segment
+// and Store is not blocked by the network.
+func (s *Spool) Replay(send func(metrics []*models.Metric) error) error {
+	s.replay.Lock()
+	defer s.replay.Unlock()
+
+	for {
+		oldest, metrics, ok := s.take()
+		if !ok {
+			return nil
+		}
+
+		err := send(metrics)
+		if errors.Is(err, ErrRejected) {
+			logger.Log.Error("dropping rejected spooled metrics", zap.String("segment", oldest.path), zap.Int("metrics", len(metrics)), zap.Error(err))
+			s.release(oldest)
+			continue
+		}
+		if err != nil {
+			s.putBack(oldest)
+			return err
+		}
+		logger.Log.Info("spooled metrics sent", zap.String("segment", oldest.path), zap.Int("metrics", len(metrics)))
+		s.release(oldest)
+	}
+}
+
+// take removes the oldest segment from the spool and returns it with its metrics, leaving its file
+// to be removed once it is sent. Expired and unreadable segments are dropped.
+func (s *Spool) take() (*segment, []*models.Metric, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(s.now())
+	for len(s.segments) > 0 {
+		oldest := s.segments[0]
+		metrics := s.tail
+		if len(s.segments) > 1 || metrics == nil {
+			var err error
+			metrics, err = readSegment(oldest.path)
+			if err != nil {
+				logger.Log.Error("dropping unreadable spool segment", zap.String("segment", oldest.path), zap.Error(err))
+				s.drop()
+				continue
+			}
+		}
+		if len(s.segments) == 1 {
+			s.tail = nil
+		}
+		s.segments = s.segments[1:]
+		s.taken = oldest
+		return oldest, metrics, true
+	}
+	return nil, nil, false
+}
+
+// putBack returns the segment taken out of the spool to its front, to be sent again.
+// Its metrics are read again from its file, so batches are not merged into it in memory.
+func (s *Spool) putBack(seg *segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.taken = nil
+	s.segments = append([]*segment{seg}, s.segments...)
+	s.shrink()
+}
+
+// release removes the file of the segment taken out of the spool once it is handled.
+func (s *Spool) release(seg *segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.taken = nil
+	removeSegment(seg)
+}
+
+// expire drops the segments older than the maximum age.
+func (s *Spool) expire(now time.Time) {
+	for len(s.segments) > 0 && now.Sub(s.segments[0].created) > s.opts.MaxAge {
+		logger.Log.Warn("dropping spooled metrics", zap.String("segment", s.segments[0].path), zap.String("reason", "max age"))
+		s.drop()
+	}
+}
+
+// shrink drops the oldest segments while the spool exceeds its maximum size.
+// The segment being written to is kept.
+func (s *Spool) shrink() {
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	for len(s.segments) > 1 && size > s.opts.MaxSize {
+		logger.Log.Warn("dropping spooled metrics", zap.String("segment", s.segments[0].path), zap.String("reason", "max size"))
+		size -= s.segments[0].size
+		s.drop()
+	}
+}
+
+// drop removes the oldest segment.
+func (s *Spool) drop() {
+	s.remove(0)
+}
+
+// remove removes the i-th segment and its file.
+func (s *Spool) remove(i int) {
+	removeSegment(s.segments[i])
+	if i == len(s.segments)-1 {
+		s.tail = nil
+	}
+	s.segments = append(s.segments[:i], s.segments[i+1:]...)
+}
+
+// removeSegment removes the file of the segment.
+func removeSegment(seg *segment) {
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Log.Error("unable to remove spool segment", zap.String("segment", seg.path), zap.Error(err))
+	}
+}
+
+// merge returns the merged metrics with the batch merged in: gauges replace their previous value
+// and counter increments are added to the previous ones. The metrics keep the order they were first stored in.
+// Neither the merged metrics nor the batch are modified.
+func merge(merged, batch []*models.Metric) []*models.Metric {
+	result := make([]*models.Metric, 0, len(merged)+len(batch))
+	index := make(map[string]int, len(merged)+len(batch))
+	for _, metrics := range [][]*models.Metric{merged, batch} {
+		for _, metric := range metrics {
+			key := string(metric.Type) + "/" + metric.Name
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(result)
+				result = append(result, metric)
+				continue
+			}
+			if metric.Type == models.CounterType {
+				var delta int64
+				if result[i].Delta != nil {
+					delta = *result[i].Delta
+				}
+				if metric.Delta != nil {
+					delta += *metric.Delta
+				}
+				result[i] = &models.Metric{Name: metric.Name, Type: metric.Type, Delta: &delta}
+				continue
+			}
+			result[i] = metric
+		}
+	}
+	return result
+}
+
+func readSegment(path string) ([]*models.Metric, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read spool segment: %w", err)
+	}
+	var metrics []*models.Metric
+	if err = json.Unmarshal(data, &metrics); err != nil {
+		return nil, fmt.Errorf("unable to decode spool segment %s: %w", path, err)
+	}
+	return metrics, nil
+}
+
+// writeSegment replaces the segment with the metrics and returns its size.
+// The segment is written to a temporary file first, so an interrupted write leaves the previous one intact.
+func writeSegment(path string, metrics []*models.Metric) (int64, error) {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return 0, fmt.Errorf("unable to encode spool segment: %w", err)
+	}
+	tmp := path + tmpExt
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return 0, fmt.Errorf("unable to write spool segment: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("unable to write spool segment: %w", err)
+	}
+	return int64(len(data)), nil
+}
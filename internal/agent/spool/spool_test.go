@@ -0,0 +1,206 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(name string, value float64) *models.Metric {
+	return &models.Metric{Name: name, Type: models.GaugeType, Value: &value}
+}
+
+func counter(name string, delta int64) *models.Metric {
+	return &models.Metric{Name: name, Type: models.CounterType, Delta: &delta}
+}
+
+// clock is a fake time source advanced by the tests.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func openTestSpool(t *testing.T, dir string, opts Options) (*Spool, *clock) {
+	t.Helper()
+
+	s, err := Open(dir, opts)
+	require.NoError(t, err)
+	c := &clock{now: time.Unix(1700000000, 0)}
+	s.now = c.Now
+	return s, c
+}
+
+// replayAll replays the spool and returns the replayed batches.
+func replayAll(t *testing.T, s *Spool) [][]*models.Metric {
+	t.Helper()
+
+	var batches [][]*models.Metric
+	require.NoError(t, s.Replay(func(metrics []*models.Metric) error {
+		batches = append(batches, metrics)
+		return nil
+	}))
+	return batches
+}
+
+func TestSpool_MergesBatchesOfSegment(t *testing.T) {
+	s, c := openTestSpool(t, t.TempDir(), Options{SegmentDuration: time.Minute})
+
+	require.NoError(t, s.Store([]*models.Metric{gauge("A", 1), counter("C", 2)}))
+	c.now = c.now.Add(30 * time.Second)
+	require.NoError(t, s.Store([]*models.Metric{gauge("A", 5), counter("C", 3), gauge("B", 7)}))
+	assert.Equal(t, 1, s.Len())
+
+	assert.Equal(t, [][]*models.Metric{
+		{gauge("A", 5), counter("C", 5), gauge("B", 7)},
+	}, replayAll(t, s), "gauges keep their latest value and counters are summed")
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSpool_ReplaysSegmentsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, c := openTestSpool(t, dir, Options{SegmentDuration: time.Minute})
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, s.Store([]*models.Metric{gauge("A", float64(i))}))
+		c.now = c.now.Add(time.Minute)
+	}
+	require.Equal(t, 3, s.Len())
+
+	t.Run("failed replay keeps the segments", func(t *testing.T) {
+		var sent int
+		err := s.Replay(func(metrics []*models.Metric) error {
+			if sent == 1 {
+				return errors.New("unavailable")
+			}
+			sent++
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 2, s.Len(), "segments sent before the failure are removed")
+	})
+
+	t.Run("segments are kept across restarts", func(t *testing.T) {
+		reopened, _ := openTestSpool(t, dir, Options{})
+		assert.Equal(t, [][]*models.Metric{{gauge("A", 2)}, {gauge("A", 3)}}, replayAll(t, reopened))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestSpool_DropsRejectedSegments(t *testing.T) {
+	s, c := openTestSpool(t, t.TempDir(), Options{SegmentDuration: time.Minute})
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, s.Store([]*models.Metric{gauge("A", float64(i))}))
+		c.now = c.now.Add(time.Minute)
+	}
+
+	var sent [][]*models.Metric
+	err := s.Replay(func(metrics []*models.Metric) error {
+		if *metrics[0].Value == 2 {
+			return fmt.Errorf("%w: 400 Bad Request", ErrRejected)
+		}
+		sent = append(sent, metrics)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]*models.Metric{{gauge("A", 1)}, {gauge("A", 3)}}, sent)
+	assert.Equal(t, 0, s.Len(), "rejected segments are dropped")
+}
+
+func TestSpool_StoresWhileReplaying(t *testing.T) {
+	s, c := openTestSpool(t, t.TempDir(), Options{SegmentDuration: time.Minute})
+	require.NoError(t, s.Store([]*models.Metric{gauge("A", 1)}))
+
+	t.Run("stored batches go to a new segment", func(t *testing.T) {
+		err := s.Replay(func(metrics []*models.Metric) error {
+			if *metrics[0].Value == 1 {
+				require.NoError(t, s.Store([]*models.Metric{gauge("A", 2)}))
+			}
+			return errors.New("unavailable")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 2, s.Len(), "the segment being sent is put back in front")
+	})
+
+	t.Run("segments are replayed in order", func(t *testing.T) {
+		c.now = c.now.Add(30 * time.Second)
+		require.NoError(t, s.Store([]*models.Metric{counter("C", 1)}))
+		assert.Equal(t, [][]*models.Metric{{gauge("A", 1)}, {gauge("A", 2), counter("C", 1)}}, replayAll(t, s))
+	})
+}
+
+func TestSpool_AppendsToSegmentOfPreviousRun(t *testing.T) {
+	dir := t.TempDir()
+	s, c := openTestSpool(t, dir, Options{SegmentDuration: time.Minute})
+	require.NoError(t, s.Store([]*models.Metric{counter("C", 2)}))
+
+	reopened, _ := openTestSpool(t, dir, Options{SegmentDuration: time.Minute})
+	reopened.now = func() time.Time { return c.now.Add(time.Second) }
+	require.NoError(t, reopened.Store([]*models.Metric{counter("C", 3)}))
+
+	assert.Equal(t, [][]*models.Metric{{counter("C", 5)}}, replayAll(t, reopened))
+}
+
+func TestSpool_MaxAge(t *testing.T) {
+	s, c := openTestSpool(t, t.TempDir(), Options{SegmentDuration: time.Minute, MaxAge: time.Hour})
+
+	require.NoError(t, s.Store([]*models.Metric{gauge("A", 1)}))
+	c.now = c.now.Add(30 * time.Minute)
+	require.NoError(t, s.Store([]*models.Metric{gauge("A", 2)}))
+	c.now = c.now.Add(45 * time.Minute)
+
+	assert.Equal(t, [][]*models.Metric{{gauge("A", 2)}}, replayAll(t, s), "segments older than the max age are dropped")
+}
+
+func TestSpool_MaxSize(t *testing.T) {
+	s, c := openTestSpool(t, t.TempDir(), Options{SegmentDuration: time.Minute, MaxSize: 100})
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, s.Store([]*models.Metric{gauge("A", float64(i))}))
+		c.now = c.now.Add(time.Minute)
+	}
+
+	batches := replayAll(t, s)
+	require.NotEmpty(t, batches)
+	assert.Less(t, len(batches), 4, "the oldest segments are dropped beyond the max size")
+	assert.Equal(t, []*models.Metric{gauge("A", 4)}, batches[len(batches)-1], "the latest segment is kept")
+}
+
+func TestSpool_UnreadableSegments(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001.json"), []byte("{broken"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000002.json.tmp"), []byte("[]"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("kept"), 0o600))
+
+	s, c := openTestSpool(t, dir, Options{MaxAge: 100 * 365 * 24 * time.Hour})
+	assert.Equal(t, 1, s.Len(), "temporary and unrelated files are not segments")
+	_, err := os.Stat(filepath.Join(dir, "00000000000000000002.json.tmp"))
+	assert.ErrorIs(t, err, os.ErrNotExist, "leftovers of interrupted writes are removed")
+
+	c.now = time.Unix(0, 2)
+	require.NoError(t, s.Store([]*models.Metric{gauge("A", 1)}))
+	assert.Equal(t, [][]*models.Metric{{gauge("A", 1)}}, replayAll(t, s), "unreadable segments are dropped")
+}
+
+func TestMerge(t *testing.T) {
+	merged := []*models.Metric{gauge("A", 1), counter("C", 2)}
+	batch := []*models.Metric{counter("C", 3), gauge("A", 4), counter("D", 1)}
+
+	result := merge(merged, batch)
+	assert.Equal(t, []*models.Metric{gauge("A", 4), counter("C", 5), counter("D", 1)}, result)
+	assert.Equal(t, int64(2), *merged[1].Delta, "merged metrics are not modified")
+	assert.Equal(t, int64(3), *batch[0].Delta, "the batch is not modified")
+}
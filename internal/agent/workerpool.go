@@ -1,11 +1,20 @@
 package agent
 
 import (
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/agent/metrics"
+	"github.com/rshafikov/alertme/internal/agent/spool"
 	"github.com/rshafikov/alertme/internal/server/logger"
 	"github.com/rshafikov/alertme/internal/server/models"
 	"go.uber.org/zap"
 )
 
+// Sender sends a batch of metrics to the server.
+type Sender interface {
+	SendData(metrics []*models.Metric) error
+}
+
 // Result represents the result of a worker's job.
 type Result struct {
 	Value    any
@@ -16,16 +25,19 @@ type Result struct {
 // WorkerPool represents a pool of workers that process jobs concurrently.
 type WorkerPool struct {
 	DoneCh   chan struct{}
-	JobsCh   chan []*models.Metric
+	JobsCh   chan metrics.Batch
 	ResultCh chan Result
-	Workers  int
+	// Spool stores the batches that cannot be sent, to send them once the server is reachable again.
+	// Such batches are dropped if it is nil.
+	Spool   *spool.Spool
+	Workers int
 }
 
 // NewWorkerPool creates a new worker pool with the specified number of workers.
 func NewWorkerPool(workers int) *WorkerPool {
 	return &WorkerPool{
 		Workers:  workers,
-		JobsCh:   make(chan []*models.Metric),
+		JobsCh:   make(chan metrics.Batch),
 		ResultCh: make(chan Result),
 		DoneCh:   make(chan struct{}),
 	}
@@ -37,8 +49,10 @@ func (wp *WorkerPool) Stop() {
 }
 
 // RunWorker starts a worker with the specified ID that processes jobs from the JobsCh.
-// The worker sends metrics to the server using the provided client and reports results to ResultCh.
-func (wp *WorkerPool) RunWorker(id int, client *Client) {
+// The worker sends metrics to the server using the provided client, acknowledges every batch with the result
+// of its send and reports results to ResultCh. Batches whose content the server rejected are dropped,
+// the counters of other failed batches are carried into the next ones.
+func (wp *WorkerPool) RunWorker(id int, client Sender) {
 	logger.Log.Debug("worker starting", zap.Int("worker_id", id))
 
 	for {
@@ -55,7 +69,18 @@ func (wp *WorkerPool) RunWorker(id int, client *Client) {
 			}
 			logger.Log.Debug("worker received job", zap.Int("worker_id", id))
 
-			err := client.SendData(v)
+			err := wp.send(client, v.Metrics)
+			if errors.Is(err, ErrMetricsRejected) {
+				// The server refused the content of the batch, its counters would be refused again with the next one.
+				logger.Log.Error("dropping metrics rejected by the server",
+					zap.Int("metrics", len(v.Metrics)),
+					zap.Any("counters", counterTotals(v.Metrics)),
+					zap.Error(err),
+				)
+				v.Ack(nil)
+			} else {
+				v.Ack(err)
+			}
 
 			if err != nil {
 				logger.Log.Debug("an error occurred while processing job", zap.Error(err))
@@ -65,3 +90,51 @@ func (wp *WorkerPool) RunWorker(id int, client *Client) {
 		}
 	}
 }
+
+// send sends the batch to the server. With a spool, the spooled batches are sent first, so the server
+// receives the metrics in order, and a batch that cannot be sent is spooled instead of failing.
+// Batches whose content the server rejected are not spooled, they would be rejected again;
+// batches refused for any other reason, e.g. a revoked key, are spooled until the server accepts them.
+func (wp *WorkerPool) send(client Sender, batch []*models.Metric) error {
+	if wp.Spool == nil {
+		return client.SendData(batch)
+	}
+
+	replayErr := wp.Spool.Replay(func(metrics []*models.Metric) error {
+		err := client.SendData(metrics)
+		if errors.Is(err, ErrMetricsRejected) {
+			return fmt.Errorf("%w: %w", spool.ErrRejected, err)
+		}
+		return err
+	})
+	if replayErr != nil {
+		return wp.spool(batch, replayErr)
+	}
+	err := client.SendData(batch)
+	if err != nil && !errors.Is(err, ErrMetricsRejected) {
+		return wp.spool(batch, err)
+	}
+	return err
+}
+
+// spool stores the batch that could not be sent because of sendErr.
+// A spooled batch is handled, so nil is returned unless it cannot be stored.
+func (wp *WorkerPool) spool(batch []*models.Metric, sendErr error) error {
+	if err := wp.Spool.Store(batch); err != nil {
+		logger.Log.Error("unable to spool metrics", zap.Error(err))
+		return errors.Join(sendErr, err)
+	}
+	logger.Log.Warn("metrics spooled until the server is reachable", zap.Error(sendErr))
+	return nil
+}
+
+// counterTotals returns the increments of the counters of the batch by name.
+func counterTotals(batch []*models.Metric) map[string]int64 {
+	totals := make(map[string]int64)
+	for _, m := range batch {
+		if m.Type == models.CounterType && m.Delta != nil {
+			totals[m.Name] += *m.Delta
+		}
+	}
+	return totals
+}
@@ -1,6 +1,10 @@
 package agent
 
 import (
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/agent/metrics"
+	"github.com/rshafikov/alertme/internal/agent/spool"
 	"github.com/rshafikov/alertme/internal/server/models"
 	"net/http"
 	"net/http/httptest"
@@ -98,7 +102,7 @@ func TestWorkerPool_RunWorkerJobProcessing(t *testing.T) {
 		},
 	}
 	
-	wp.JobsCh <- job
+	wp.JobsCh <- metrics.Batch{Metrics: job}
 	
 	// Wait for result
 	select {
@@ -140,4 +144,180 @@ func TestWorkerPool_RunWorkerJobsChannelClosed(t *testing.T) {
 	
 	// Give the worker time to process the close signal
 	time.Sleep(100 * time.Millisecond)
-}
\ No newline at end of file
+}
+type failingSender struct {
+	err error
+}
+
+func (s *failingSender) SendData(_ []*models.Metric) error {
+	return s.err
+}
+
+func TestWorkerPool_RunWorkerAcknowledgesBatches(t *testing.T) {
+	sender := &failingSender{}
+	wp := NewWorkerPool(1)
+	go wp.RunWorker(1, sender)
+	defer wp.Stop()
+
+	acks := make(chan error, 1)
+	batch := metrics.Batch{Done: func(err error) { acks <- err }}
+
+	wp.JobsCh <- batch
+	<-wp.ResultCh
+	if err := <-acks; err != nil {
+		t.Errorf("Expected batch to be acknowledged as sent, got %v", err)
+	}
+
+	sender.err = errors.New("unavailable")
+	wp.JobsCh <- batch
+	<-wp.ResultCh
+	if err := <-acks; err == nil {
+		t.Error("Expected batch to be acknowledged with the send error, got nil")
+	}
+
+	sender.err = fmt.Errorf("%w: 400 Bad Request", ErrMetricsRejected)
+	wp.JobsCh <- batch
+	if result := <-wp.ResultCh; !errors.Is(result.Err, ErrMetricsRejected) {
+		t.Errorf("Expected the rejection to be reported, got %v", result.Err)
+	}
+	if err := <-acks; err != nil {
+		t.Errorf("Expected rejected batch to be acknowledged as handled, got %v", err)
+	}
+
+	sender.err = fmt.Errorf("%w: 401 Unauthorized", ErrUnableToSendMetrics)
+	wp.JobsCh <- batch
+	<-wp.ResultCh
+	if err := <-acks; err == nil {
+		t.Error("Expected unauthorized batch to be acknowledged with the error, so its counters are kept")
+	}
+}
+
+func TestCounterTotals(t *testing.T) {
+	value, first, second := 1.0, int64(2), int64(3)
+	batch := []*models.Metric{
+		{Name: "g", Type: models.GaugeType, Value: &value},
+		{Name: "c", Type: models.CounterType, Delta: &first},
+		{Name: "c", Type: models.CounterType, Delta: &second},
+	}
+	if totals := counterTotals(batch); len(totals) != 1 || totals["c"] != 5 {
+		t.Errorf("Expected counter totals map[c:5], got %v", totals)
+	}
+}
+
+// flakySender fails while the server is down and records the batches it sends.
+type flakySender struct {
+	sent         [][]*models.Metric
+	down         bool
+	unauthorized bool
+	rejected     bool
+}
+
+func (s *flakySender) SendData(metrics []*models.Metric) error {
+	if s.down {
+		return ErrUnableToSendMetrics
+	}
+	if s.unauthorized {
+		return fmt.Errorf("%w: 401 Unauthorized", ErrUnableToSendMetrics)
+	}
+	if s.rejected {
+		return fmt.Errorf("%w: 400 Bad Request", ErrMetricsRejected)
+	}
+	s.sent = append(s.sent, metrics)
+	return nil
+}
+
+func TestWorkerPool_Spool(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	sender := &flakySender{down: true}
+	wp := NewWorkerPool(1)
+	wp.Spool = sp
+
+	value, delta := 1.0, int64(2)
+	batch := []*models.Metric{
+		{Name: "g", Type: models.GaugeType, Value: &value},
+		{Name: "c", Type: models.CounterType, Delta: &delta},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = wp.send(sender, batch); err != nil {
+			t.Fatalf("Expected failed batch to be spooled, got %v", err)
+		}
+	}
+	if sp.Len() == 0 {
+		t.Fatal("Expected failed batches to be spooled")
+	}
+
+	sender.down = false
+	if err = wp.send(sender, batch); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sp.Len() != 0 {
+		t.Errorf("Expected spool to be empty after replay, got %d segments", sp.Len())
+	}
+	if len(sender.sent) != 2 {
+		t.Fatalf("Expected spooled and new batches to be sent, got %d batches", len(sender.sent))
+	}
+	if spooled := sender.sent[0]; len(spooled) != 2 || *spooled[1].Delta != 4 {
+		t.Errorf("Expected spooled batches to be merged with counters summed, got %v", spooled)
+	}
+}
+
+func TestWorkerPool_SpoolSkipsRejectedBatches(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	sender := &flakySender{down: true}
+	wp := NewWorkerPool(1)
+	wp.Spool = sp
+
+	value := 1.0
+	batch := []*models.Metric{{Name: "g", Type: models.GaugeType, Value: &value}}
+	if err = wp.send(sender, batch); err != nil {
+		t.Fatalf("Expected failed batch to be spooled, got %v", err)
+	}
+
+	sender.down, sender.rejected = false, true
+	if err = wp.send(sender, batch); !errors.Is(err, ErrMetricsRejected) {
+		t.Fatalf("Expected the rejection to be returned, got %v", err)
+	}
+	if sp.Len() != 0 {
+		t.Errorf("Expected rejected batches to be dropped, got %d segments", sp.Len())
+	}
+}
+
+func TestWorkerPool_SpoolKeepsUnauthorizedBatches(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), spool.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+	sender := &flakySender{down: true}
+	wp := NewWorkerPool(1)
+	wp.Spool = sp
+
+	value := 1.0
+	batch := []*models.Metric{{Name: "g", Type: models.GaugeType, Value: &value}}
+	if err = wp.send(sender, batch); err != nil {
+		t.Fatalf("Expected failed batch to be spooled, got %v", err)
+	}
+
+	// The server enabled strict signatures before the agent got its key.
+	sender.down, sender.unauthorized = false, true
+	if err = wp.send(sender, batch); err != nil {
+		t.Fatalf("Expected unauthorized batch to be spooled, got %v", err)
+	}
+	if sp.Len() == 0 {
+		t.Fatal("Expected spooled batches to be kept while unauthorized")
+	}
+
+	sender.unauthorized = false
+	if err = wp.send(sender, batch); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sp.Len() != 0 || len(sender.sent) == 0 {
+		t.Errorf("Expected spooled batches to be replayed once authorized, got %d segments left", sp.Len())
+	}
+}
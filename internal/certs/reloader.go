@@ -0,0 +1,152 @@
+// Package certs provides TLS configurations for the server and the agent
+// whose certificates can be reloaded from disk without a restart.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/rshafikov/alertme/internal/reload"
+)
+
+// ErrNoCertificate is returned by the server configuration when no certificate is configured.
+var ErrNoCertificate = errors.New("no certificate configured")
+
+// state is an immutable set of loaded certificates, swapped as a whole on reload.
+type state struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// Reloader holds a certificate key pair and a CA bundle loaded from files
+// and reloads them on demand. All files are optional:
+//   - the key pair is the server certificate, or the client certificate of the agent;
+//   - the CA bundle verifies client certificates on the server (mutual TLS),
+//     or the server certificate on the agent instead of the system roots.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	state    atomic.Pointer[state]
+}
+
+// NewReloader creates a reloader for the given files and loads them.
+// Returns an error if any of the configured files cannot be loaded.
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both certificate and key must be set")
+	}
+
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files again. On error the previously loaded certificates are kept.
+func (r *Reloader) Reload() error {
+	s := &state{}
+
+	if r.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load key pair: %w", err)
+		}
+		s.cert = &cert
+	}
+
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		s.pool = x509.NewCertPool()
+		if !s.pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.state.Store(s)
+	return nil
+}
+
+// WatchSignals reloads the certificates every time one of the signals is received,
+// until the context is done. Reload errors are logged and the old certificates are kept.
+func (r *Reloader) WatchSignals(ctx context.Context, signals ...os.Signal) {
+	reload.OnSignal(ctx, "certificates", r.Reload, signals...)
+}
+
+// ServerConfig returns a TLS configuration for the server.
+// If a CA bundle is configured, clients must present a certificate signed by it.
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: r.getCertificate,
+			}
+			if pool := r.state.Load().pool; pool != nil {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig returns a TLS configuration for the agent.
+// The client certificate, if configured, is presented to servers requesting one.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.state.Load().cert; cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+		// The server certificate is verified in VerifyConnection instead,
+		// so that a reloaded CA bundle applies to new connections.
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyServer,
+	}
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := r.state.Load().cert
+	if cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return cert, nil
+}
+
+// verifyServer verifies the server certificate chain and host name against
+// the current CA bundle, or the system roots if no bundle is configured.
+func (r *Reloader) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         r.state.Load().pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,210 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA is a self-signed certificate authority issuing test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "alertme test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue writes a certificate for the given host signed by the CA and its key to dir.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func (ca *testCA) writePEM(t *testing.T, path string) string {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, ca.pem, 0o600))
+	return path
+}
+
+// startTLSServer serves a handler responding 200 over TLS with the given configuration.
+func startTLSServer(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		TLSConfig:         cfg,
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() {
+		_ = srv.ServeTLS(lis, "", "")
+	}()
+	t.Cleanup(func() { srv.Close() })
+
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+	return "https://localhost:" + port
+}
+
+func get(url string, cfg *tls.Config) error {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestReloader_TLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := ca.writePEM(t, filepath.Join(dir, "ca.pem"))
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	server, err := NewReloader(serverCert, serverKey, "")
+	require.NoError(t, err)
+	url := startTLSServer(t, server.ServerConfig())
+
+	t.Run("trusted CA", func(t *testing.T) {
+		client, err := NewReloader("", "", caFile)
+		require.NoError(t, err)
+		assert.NoError(t, get(url, client.ClientConfig()))
+	})
+
+	t.Run("untrusted CA", func(t *testing.T) {
+		other := newTestCA(t)
+		client, err := NewReloader("", "", other.writePEM(t, filepath.Join(t.TempDir(), "ca.pem")))
+		require.NoError(t, err)
+		assert.Error(t, get(url, client.ClientConfig()))
+	})
+}
+
+func TestReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := ca.writePEM(t, filepath.Join(dir, "ca.pem"))
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "client", x509.ExtKeyUsageClientAuth)
+
+	server, err := NewReloader(serverCert, serverKey, caFile)
+	require.NoError(t, err)
+	url := startTLSServer(t, server.ServerConfig())
+
+	t.Run("with client certificate", func(t *testing.T) {
+		client, err := NewReloader(clientCert, clientKey, caFile)
+		require.NoError(t, err)
+		assert.NoError(t, get(url, client.ClientConfig()))
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		client, err := NewReloader("", "", caFile)
+		require.NoError(t, err)
+		assert.Error(t, get(url, client.ClientConfig()))
+	})
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := newTestCA(t)
+	caFile := oldCA.writePEM(t, filepath.Join(dir, "ca.pem"))
+	serverCert, serverKey := oldCA.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	server, err := NewReloader(serverCert, serverKey, "")
+	require.NoError(t, err)
+	url := startTLSServer(t, server.ServerConfig())
+
+	client, err := NewReloader("", "", caFile)
+	require.NoError(t, err)
+	require.NoError(t, get(url, client.ClientConfig()))
+
+	// Rotate the server certificate to one issued by a new CA.
+	newCA := newTestCA(t)
+	newCA.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	require.NoError(t, server.Reload())
+	assert.Error(t, get(url, client.ClientConfig()), "client must not trust the new certificate yet")
+
+	newCA.writePEM(t, caFile)
+	require.NoError(t, client.Reload())
+	assert.NoError(t, get(url, client.ClientConfig()))
+
+	t.Run("failed reload keeps certificates", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(serverKey, []byte("garbage"), 0o600))
+		assert.Error(t, server.Reload())
+		assert.NoError(t, get(url, client.ClientConfig()))
+	})
+}
+
+func TestNewReloader(t *testing.T) {
+	_, err := NewReloader("cert.pem", "", "")
+	assert.Error(t, err)
+
+	_, err = NewReloader("", "", filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+}
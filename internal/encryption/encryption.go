@@ -0,0 +1,98 @@
+// Package encryption implements hybrid RSA encryption of agent payloads.
+//
+// A payload is encrypted with a random AES-256-GCM key, and the key itself is
+// encrypted with the server's RSA public key using OAEP with SHA-256, so that
+// payloads of any size can be encrypted. The encrypted message is laid out as
+//
+//	RSA-OAEP(aes key) | GCM nonce | AES-GCM(payload)
+//
+// where the length of the first part equals the size of the RSA modulus.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// Header is the request header marking an encrypted body.
+	Header = "X-Encryption"
+	// Scheme is the value of Header for bodies encrypted by this package.
+	Scheme = "rsa-oaep-aes-gcm"
+	// DefaultKeyBits is the default size of generated RSA keys.
+	DefaultKeyBits = 4096
+
+	aesKeySize = 32
+)
+
+// ErrDecrypt is returned when a message cannot be decrypted.
+var ErrDecrypt = errors.New("unable to decrypt message")
+
+// Encrypt encrypts the data with the public key.
+func Encrypt(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+	aesKey := make([]byte, aesKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, aesKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, encryptedKey...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, nil), nil
+}
+
+// Decrypt decrypts a message produced by Encrypt with the private key.
+// Returns ErrDecrypt if the message is malformed or was not encrypted for this key.
+func Decrypt(priv *rsa.PrivateKey, msg []byte) ([]byte, error) {
+	keySize := priv.Size()
+	if len(msg) < keySize {
+		return nil, fmt.Errorf("%w: message too short", ErrDecrypt)
+	}
+
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), nil, priv, msg[:keySize], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	rest := msg[keySize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: message too short", ErrDecrypt)
+	}
+
+	data, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
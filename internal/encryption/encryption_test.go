@@ -0,0 +1,108 @@
+package encryption
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyBits = 2048
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	privPath, pubPath := writeTestKeys(t, dir)
+
+	priv, err := LoadPrivateKey(privPath)
+	require.NoError(t, err)
+	pub, err := LoadPublicKey(pubPath)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty payload", data: []byte{}},
+		{name: "small payload", data: []byte(`[{"id":"g","type":"gauge","value":1}]`)},
+		{name: "payload larger than the key", data: bytes.Repeat([]byte("metric"), 10000)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encrypted, err := Encrypt(pub, test.data)
+			require.NoError(t, err)
+			assert.NotEqual(t, test.data, encrypted)
+
+			decrypted, err := Decrypt(priv, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, string(test.data), string(decrypted))
+		})
+	}
+
+	t.Run("tampered message", func(t *testing.T) {
+		encrypted, err := Encrypt(pub, []byte("payload"))
+		require.NoError(t, err)
+		encrypted[len(encrypted)-1] ^= 0xff
+
+		_, err = Decrypt(priv, encrypted)
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("truncated message", func(t *testing.T) {
+		_, err := Decrypt(priv, []byte("short"))
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		otherPriv, _ := writeTestKeys(t, t.TempDir())
+		other, err := LoadPrivateKey(otherPriv)
+		require.NoError(t, err)
+
+		encrypted, err := Encrypt(pub, []byte("payload"))
+		require.NoError(t, err)
+		_, err = Decrypt(other, encrypted)
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	privPath, pubPath := writeTestKeys(t, dir)
+
+	t.Run("private key as public key", func(t *testing.T) {
+		_, err := LoadPublicKey(privPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("public key as private key", func(t *testing.T) {
+		_, err := LoadPrivateKey(pubPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadPrivateKey(filepath.Join(dir, "missing.pem"))
+		assert.Error(t, err)
+	})
+
+	t.Run("not a PEM file", func(t *testing.T) {
+		path := filepath.Join(dir, "garbage.pem")
+		require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+		_, err := LoadPublicKey(path)
+		assert.Error(t, err)
+	})
+}
+
+func writeTestKeys(t *testing.T, dir string) (privPath, pubPath string) {
+	t.Helper()
+
+	privPEM, pubPEM, err := GenerateKeys(testKeyBits)
+	require.NoError(t, err)
+
+	privPath = filepath.Join(dir, "private.pem")
+	pubPath = filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privPath, privPEM, 0o600))
+	require.NoError(t, os.WriteFile(pubPath, pubPEM, 0o644))
+	return privPath, pubPath
+}
@@ -0,0 +1,70 @@
+package proto
+
+import (
+	"errors"
+
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/models"
+)
+
+// FromModel converts a metric model to its protobuf representation.
+func FromModel(m *models.Metric) *Metric {
+	pm := &Metric{Id: m.Name}
+	switch m.Type {
+	case models.CounterType:
+		pm.Type = Metric_COUNTER
+		if m.Delta != nil {
+			pm.Delta = *m.Delta
+		}
+	default:
+		pm.Type = Metric_GAUGE
+		if m.Value != nil {
+			pm.Value = *m.Value
+		}
+	}
+	return pm
+}
+
+// FromModels converts a list of metric models to their protobuf representation.
+func FromModels(metrics []*models.Metric) []*Metric {
+	pms := make([]*Metric, 0, len(metrics))
+	for _, m := range metrics {
+		pms = append(pms, FromModel(m))
+	}
+	return pms
+}
+
+// ModelType converts a protobuf metric type to the model type.
+func ModelType(t Metric_Type) (models.MetricType, error) {
+	switch t {
+	case Metric_GAUGE:
+		return models.GaugeType, nil
+	case Metric_COUNTER:
+		return models.CounterType, nil
+	default:
+		return "", errors.New(errmsg.InvalidMetricType)
+	}
+}
+
+// ToModel converts the protobuf metric to a metric model.
+// Returns an error if the metric has no name or an unknown type.
+func (x *Metric) ToModel() (*models.Metric, error) {
+	if x.GetId() == "" {
+		return nil, errors.New(errmsg.MetricNameRequired)
+	}
+
+	metricType, err := ModelType(x.GetType())
+	if err != nil {
+		return nil, err
+	}
+
+	m := &models.Metric{Name: x.GetId(), Type: metricType}
+	if metricType == models.CounterType {
+		delta := x.GetDelta()
+		m.Delta = &delta
+	} else {
+		value := x.GetValue()
+		m.Value = &value
+	}
+	return m, nil
+}
@@ -0,0 +1,92 @@
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/rshafikov/alertme/internal/signature"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// HashMessage returns the hex-encoded HMAC-SHA256 of the message serialized
+// deterministically, so both sides of a connection compute the same value.
+func HashMessage(key string, msg protobuf.Message) (string, error) {
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashMessageAt returns the hex-encoded HMAC-SHA256 of the message with the sequence number of a stream
+// signed at the timestamp with the nonce of the stream, over the signed material of the message
+// serialized deterministically, see signature.Material and signature.MessageNonce.
+func HashMessageAt(key, timestamp, nonce string, seq uint64, msg protobuf.Message) (string, error) {
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(signature.Material(timestamp, signature.MessageNonce(nonce, seq), data))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SignAt sets the hash of the request with the sequence number of a stream signed at the timestamp
+// with the nonce of the stream, see HashMessageAt.
+func (x *UpdateMetricsRequest) SignAt(key, timestamp, nonce string, seq uint64) error {
+	x.Hash = ""
+	hash, err := HashMessageAt(key, timestamp, nonce, seq, x)
+	if err != nil {
+		return err
+	}
+	x.Hash = hash
+	return nil
+}
+
+// VerifyAt reports whether the hash of the request with the sequence number of a stream signed at the timestamp
+// with the nonce of the stream matches the given key. The request is left unchanged.
+func (x *UpdateMetricsRequest) VerifyAt(key, timestamp, nonce string, seq uint64) bool {
+	received, err := hex.DecodeString(x.GetHash())
+	if err != nil || len(received) == 0 {
+		return false
+	}
+
+	unsigned := &UpdateMetricsRequest{Metrics: x.GetMetrics()}
+	expected, err := HashMessageAt(key, timestamp, nonce, seq, unsigned)
+	if err != nil {
+		return false
+	}
+	expectedBytes, _ := hex.DecodeString(expected)
+	return hmac.Equal(received, expectedBytes)
+}
+
+// Sign sets the hash of the request computed with the given key.
+func (x *UpdateMetricsRequest) Sign(key string) error {
+	x.Hash = ""
+	hash, err := HashMessage(key, x)
+	if err != nil {
+		return err
+	}
+	x.Hash = hash
+	return nil
+}
+
+// Verify reports whether the hash of the request matches the given key.
+// The request is left unchanged.
+func (x *UpdateMetricsRequest) Verify(key string) bool {
+	received, err := hex.DecodeString(x.GetHash())
+	if err != nil || len(received) == 0 {
+		return false
+	}
+
+	unsigned := &UpdateMetricsRequest{Metrics: x.GetMetrics()}
+	expected, err := HashMessage(key, unsigned)
+	if err != nil {
+		return false
+	}
+	expectedBytes, _ := hex.DecodeString(expected)
+	return hmac.Equal(received, expectedBytes)
+}
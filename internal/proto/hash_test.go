@@ -0,0 +1,68 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMetricsRequest_SignVerify(t *testing.T) {
+	req := &UpdateMetricsRequest{Metrics: []*Metric{
+		{Id: "g", Type: Metric_GAUGE, Value: 1.5},
+		{Id: "c", Type: Metric_COUNTER, Delta: 3},
+	}}
+
+	assert.False(t, req.Verify("key"), "unsigned request must not verify")
+
+	require.NoError(t, req.Sign("key"))
+	assert.NotEmpty(t, req.GetHash())
+	assert.True(t, req.Verify("key"))
+	assert.False(t, req.Verify("other"))
+
+	req.Metrics[0].Value = 2
+	assert.False(t, req.Verify("key"), "tampered request must not verify")
+}
+
+func TestUpdateMetricsRequest_SignVerifyAt(t *testing.T) {
+	req := &UpdateMetricsRequest{Metrics: []*Metric{{Id: "g", Type: Metric_GAUGE, Value: 1.5}}}
+
+	require.NoError(t, req.SignAt("key", "1700000000", "nonce-1", 0))
+	assert.True(t, req.VerifyAt("key", "1700000000", "nonce-1", 0))
+	assert.False(t, req.VerifyAt("key", "1700000001", "nonce-1", 0), "the timestamp is signed")
+	assert.False(t, req.VerifyAt("key", "1700000000", "nonce-2", 0), "the nonce is signed")
+	assert.False(t, req.VerifyAt("key", "1700000000", "nonce-1", 1), "the sequence number is signed")
+	assert.False(t, req.Verify("key"), "timestamped signature must not pass for a plain one")
+}
+
+func TestMetric_ToModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  *Metric
+		wantErr bool
+	}{
+		{name: "gauge", metric: &Metric{Id: "g", Type: Metric_GAUGE, Value: 1.5}},
+		{name: "counter", metric: &Metric{Id: "c", Type: Metric_COUNTER, Delta: 3}},
+		{name: "missing name", metric: &Metric{Type: Metric_GAUGE}, wantErr: true},
+		{name: "invalid type", metric: &Metric{Id: "x", Type: Metric_Type(42)}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.metric.ToModel()
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.metric, FromModel(m))
+		})
+	}
+
+	t.Run("model type", func(t *testing.T) {
+		m, err := (&Metric{Id: "c", Type: Metric_COUNTER, Delta: 3}).ToModel()
+		require.NoError(t, err)
+		assert.Equal(t, models.CounterType, m.Type)
+		assert.Equal(t, int64(3), *m.Delta)
+	})
+}
@@ -0,0 +1,24 @@
+package proto
+
+// Metadata keys of the MetricsService calls, the gRPC counterparts of the HTTP headers
+// sent by the agent and checked by the server.
+const (
+	// HashMetadataKey is the metadata key carrying the HMAC-SHA256 hash of a message,
+	// the gRPC counterpart of the HashSHA256 HTTP header.
+	HashMetadataKey = "hashsha256"
+	// RealIPMetadataKey is the metadata key carrying the address of the agent,
+	// the gRPC counterpart of the X-Real-IP HTTP header.
+	RealIPMetadataKey = "x-real-ip"
+	// AuthorizationMetadataKey is the metadata key carrying the bearer token,
+	// the gRPC counterpart of the Authorization HTTP header.
+	AuthorizationMetadataKey = "authorization"
+	// KeyIDMetadataKey is the metadata key carrying the ID of the agent key messages are signed with,
+	// the gRPC counterpart of the KeyID HTTP header.
+	KeyIDMetadataKey = "keyid"
+	// TimestampMetadataKey is the metadata key carrying the Unix time in seconds the messages of a stream
+	// were signed at, the gRPC counterpart of the Timestamp HTTP header.
+	TimestampMetadataKey = "timestamp"
+	// NonceMetadataKey is the metadata key carrying a random value unique to the stream,
+	// the gRPC counterpart of the Nonce HTTP header.
+	NonceMetadataKey = "nonce"
+)
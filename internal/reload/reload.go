@@ -0,0 +1,33 @@
+// Package reload reloads configuration from its files when the process receives a signal.
+package reload
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+)
+
+// OnSignal calls fn every time one of the signals is received, until the context is done.
+// The name of what fn reloads is logged with the outcome. On errors, fn is expected to keep
+// the previous configuration, so a broken file does not take down a running process.
+func OnSignal(ctx context.Context, name string, fn func() error, signals ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-ch:
+			if err := fn(); err != nil {
+				logger.Log.Error("unable to reload "+name, zap.String("signal", sig.String()), zap.Error(err))
+				continue
+			}
+			logger.Log.Info(name+" reloaded", zap.String("signal", sig.String()))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnSignal(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	var calls atomic.Int32
+	fn := func() error {
+		if calls.Add(1) == 1 {
+			return errors.New("broken file")
+		}
+		return nil
+	}
+
+	// Keep SIGUSR1 from terminating the test if it is sent before OnSignal subscribes to it.
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR1)
+	defer signal.Stop(guard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		OnSignal(ctx, "test", fn, syscall.SIGUSR1)
+		close(done)
+	}()
+
+	// Signals sent before OnSignal subscribes are missed, so keep sending until one arrives.
+	for _, expected := range []int32{1, 2} {
+		require.Eventually(t, func() bool {
+			if calls.Load() < expected {
+				_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			}
+			return calls.Load() >= expected
+		}, 5*time.Second, 50*time.Millisecond, "a reload error does not stop watching")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnSignal did not return once the context was done")
+	}
+	assert.GreaterOrEqual(t, calls.Load(), int32(2))
+}
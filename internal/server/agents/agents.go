@@ -0,0 +1,113 @@
+// Package agents keeps the host metadata reported by the agents sending metrics,
+// such as their hostname, operating system and kernel.
+package agents
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metadata keys carrying the host metadata on gRPC streams, the counterpart of the JSON fields.
+const (
+	HostnameMetadataKey        = "agent-hostname"
+	OSMetadataKey              = "agent-os"
+	PlatformMetadataKey        = "agent-platform"
+	PlatformVersionMetadataKey = "agent-platform-version"
+	KernelVersionMetadataKey   = "agent-kernel-version"
+	KernelArchMetadataKey      = "agent-kernel-arch"
+)
+
+// ErrHostnameRequired is returned when the reported metadata has no hostname.
+var ErrHostnameRequired = errors.New("hostname is required")
+
+// Info is the host metadata reported by an agent.
+type Info struct {
+	Hostname        string `json:"hostname"`
+	OS              string `json:"os"`
+	Platform        string `json:"platform,omitempty"`
+	PlatformVersion string `json:"platform_version,omitempty"`
+	KernelVersion   string `json:"kernel_version,omitempty"`
+	KernelArch      string `json:"kernel_arch,omitempty"`
+	// Address and SeenAt are set by the server when the metadata is reported.
+	Address string    `json:"address,omitempty"`
+	SeenAt  time.Time `json:"seen_at"`
+}
+
+// Pairs returns the metadata as key-value pairs for gRPC metadata.
+// Empty values are skipped.
+func (i Info) Pairs() []string {
+	var pairs []string
+	for _, kv := range [][2]string{
+		{HostnameMetadataKey, i.Hostname},
+		{OSMetadataKey, i.OS},
+		{PlatformMetadataKey, i.Platform},
+		{PlatformVersionMetadataKey, i.PlatformVersion},
+		{KernelVersionMetadataKey, i.KernelVersion},
+		{KernelArchMetadataKey, i.KernelArch},
+	} {
+		if kv[1] != "" {
+			pairs = append(pairs, kv[0], kv[1])
+		}
+	}
+	return pairs
+}
+
+// FromMetadata returns the metadata read with the get function, which returns the value of a key,
+// e.g. the first value of the incoming gRPC metadata.
+func FromMetadata(get func(key string) string) Info {
+	return Info{
+		Hostname:        get(HostnameMetadataKey),
+		OS:              get(OSMetadataKey),
+		Platform:        get(PlatformMetadataKey),
+		PlatformVersion: get(PlatformVersionMetadataKey),
+		KernelVersion:   get(KernelVersionMetadataKey),
+		KernelArch:      get(KernelArchMetadataKey),
+	}
+}
+
+// Registry keeps the latest metadata reported by every agent, identified by its hostname.
+type Registry struct {
+	agents map[string]Info
+	now    func() time.Time
+	mu     sync.RWMutex
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		agents: make(map[string]Info),
+		now:    time.Now,
+	}
+}
+
+// Update records the metadata reported by the agent from the address,
+// replacing the metadata it reported before.
+func (r *Registry) Update(info Info, address string) error {
+	if info.Hostname == "" {
+		return ErrHostnameRequired
+	}
+	info.Address = address
+	info.SeenAt = r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agents[info.Hostname] = info
+	return nil
+}
+
+// List returns the metadata of every agent, ordered by hostname.
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Info, 0, len(r.agents))
+	for _, info := range r.agents {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Hostname < list[j].Hostname
+	})
+	return list
+}
@@ -0,0 +1,46 @@
+package agents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := NewRegistry()
+	r.now = func() time.Time { return now }
+
+	assert.ErrorIs(t, r.Update(Info{OS: "linux"}, "10.0.0.1"), ErrHostnameRequired)
+	assert.Empty(t, r.List())
+
+	require.NoError(t, r.Update(Info{Hostname: "web", OS: "linux", KernelVersion: "6.1.0"}, "10.0.0.2"))
+	require.NoError(t, r.Update(Info{Hostname: "db", OS: "linux"}, "10.0.0.3"))
+	now = now.Add(time.Minute)
+	require.NoError(t, r.Update(Info{Hostname: "web", OS: "linux", KernelVersion: "6.2.0"}, "10.0.0.4"))
+
+	assert.Equal(t, []Info{
+		{Hostname: "db", OS: "linux", Address: "10.0.0.3", SeenAt: time.Unix(1700000000, 0)},
+		{Hostname: "web", OS: "linux", KernelVersion: "6.2.0", Address: "10.0.0.4", SeenAt: now},
+	}, r.List(), "agents are ordered by hostname and keep their latest metadata")
+}
+
+func TestInfo_Pairs(t *testing.T) {
+	info := Info{Hostname: "web", OS: "linux", KernelVersion: "6.1.0", KernelArch: "x86_64"}
+
+	pairs := info.Pairs()
+	assert.Equal(t, []string{
+		HostnameMetadataKey, "web",
+		OSMetadataKey, "linux",
+		KernelVersionMetadataKey, "6.1.0",
+		KernelArchMetadataKey, "x86_64",
+	}, pairs, "empty values are skipped")
+
+	values := make(map[string]string)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+	assert.Equal(t, info, FromMetadata(func(key string) string { return values[key] }))
+}
@@ -0,0 +1,132 @@
+// Package audit records accepted metric writes: which client changed which metrics and when.
+//
+// The Auditor receives an Event for every accepted write and delivers it to each Sink
+// asynchronously. Every sink has its own bounded queue, so a slow or failing sink
+// delays neither ingestion nor the other sinks: when its queue is full, the event
+// is dropped for that sink and counted.
+package audit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultQueueSize is the default number of events queued for each sink.
+const DefaultQueueSize = 1024
+
+// Actions recorded in events.
+const (
+	// ActionUpdate records metrics written by a client.
+	ActionUpdate = "update"
+	// ActionClear records the removal of all stored metrics.
+	ActionClear = "clear"
+)
+
+// Event describes an accepted metric write.
+type Event struct {
+	// Action is the kind of the write, ActionUpdate or ActionClear.
+	Action string `json:"action"`
+	// Metrics holds the names of the written metrics. It is empty when all metrics are cleared.
+	Metrics []string `json:"metrics,omitempty"`
+	// IPAddress is the address of the connection the write was received on.
+	IPAddress string `json:"ip_address"`
+	// RealIP is the address the client reported in the X-Real-IP header, if any.
+	// It is set by the client and only checked against the trusted subnet, if one is configured.
+	RealIP string `json:"x_real_ip,omitempty"`
+	// KeyID is the ID of the per-agent key the request was signed with, if any.
+	KeyID string `json:"key_id,omitempty"`
+	// Client is the name of the bearer token the request was authenticated with, if any.
+	Client string `json:"client,omitempty"`
+	// Timestamp is the Unix time in seconds the write was accepted at.
+	Timestamp int64 `json:"ts"`
+}
+
+// Sink delivers audit events to their destination.
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+type queue struct {
+	sink   Sink
+	events chan Event
+}
+
+// Auditor distributes audit events to sinks without blocking the caller.
+type Auditor struct {
+	queues  []*queue
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	dropped atomic.Int64
+	closed  bool
+}
+
+// NewAuditor creates an auditor delivering events to the sinks and starts a delivery goroutine per sink.
+// A non-positive queue size falls back to DefaultQueueSize.
+func NewAuditor(queueSize int, sinks ...Sink) *Auditor {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	a := &Auditor{}
+	for _, sink := range sinks {
+		q := &queue{sink: sink, events: make(chan Event, queueSize)}
+		a.queues = append(a.queues, q)
+		a.wg.Add(1)
+		go a.deliver(q)
+	}
+	return a
+}
+
+// Notify queues the event for every sink without blocking.
+// Events that do not fit into the queue of a sink are dropped for it.
+// Events are ignored after the auditor is closed.
+func (a *Auditor) Notify(event Event) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+
+	for _, q := range a.queues {
+		select {
+		case q.events <- event:
+		default:
+			a.dropped.Add(1)
+			logger.Log.Warn("audit queue is full, dropping event", zap.Strings("metrics", event.Metrics))
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because a sink could not keep up.
+func (a *Auditor) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Close stops accepting events and waits until the queued events are delivered.
+// It is safe to call Close more than once.
+func (a *Auditor) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	for _, q := range a.queues {
+		close(q.events)
+	}
+	a.mu.Unlock()
+
+	a.wg.Wait()
+}
+
+func (a *Auditor) deliver(q *queue) {
+	defer a.wg.Done()
+	for event := range q.events {
+		if err := q.sink.Write(context.Background(), event); err != nil {
+			logger.Log.Error("unable to deliver audit event", zap.Error(err))
+		}
+	}
+}
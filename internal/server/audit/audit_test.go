@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	events []Event
+	mu     sync.Mutex
+}
+
+func (s *memorySink) Write(_ context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// blockingSink blocks every write until released.
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) Write(context.Context, Event) error {
+	<-s.release
+	return nil
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(context.Context, Event) error {
+	return errors.New("sink unavailable")
+}
+
+func TestAuditor_Notify(t *testing.T) {
+	sink := &memorySink{}
+	a := NewAuditor(10, sink, failingSink{})
+
+	a.Notify(Event{Metrics: []string{"m1"}, IPAddress: "10.0.0.1", Timestamp: 1})
+	a.Notify(Event{Metrics: []string{"m2", "m3"}, IPAddress: "10.0.0.2", Timestamp: 2})
+	a.Close()
+
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, []string{"m2", "m3"}, sink.events[1].Metrics)
+	assert.Zero(t, a.Dropped())
+
+	a.Notify(Event{Metrics: []string{"m4"}})
+	assert.Len(t, sink.events, 2, "events after close are ignored")
+	a.Close()
+}
+
+func TestAuditor_SlowSinkDoesNotBlock(t *testing.T) {
+	slow := &blockingSink{release: make(chan struct{})}
+	fast := &memorySink{}
+	a := NewAuditor(1, slow, fast)
+
+	for i := 0; i < 5; i++ {
+		a.Notify(Event{Metrics: []string{"m"}})
+	}
+	assert.Positive(t, a.Dropped())
+
+	close(slow.release)
+	a.Close()
+	assert.NotEmpty(t, fast.events)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte(`{"metrics":["old"],"ip_address":"","ts":0}`+"\n"), 0o600))
+
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(context.Background(), Event{Metrics: []string{"m1"}, IPAddress: "10.0.0.1", KeyID: "agent-1", Timestamp: 42}))
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 2, "existing events are kept")
+	assert.Equal(t, Event{Metrics: []string{"m1"}, IPAddress: "10.0.0.1", KeyID: "agent-1", Timestamp: 42}, events[1])
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if json.Unmarshal(body, &received) != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	event := Event{Metrics: []string{"m1"}, IPAddress: "10.0.0.1", Timestamp: 42}
+	require.NoError(t, NewHTTPSink(server.URL, nil).Write(context.Background(), event))
+	assert.Equal(t, event, received)
+
+	t.Run("error response", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+
+		assert.Error(t, NewHTTPSink(failing.URL, nil).Write(context.Background(), event))
+	})
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultHTTPTimeout limits the time spent delivering a single event to an HTTP endpoint.
+const DefaultHTTPTimeout = 5 * time.Second
+
+// HTTPSink posts every event in JSON to an HTTP endpoint.
+type HTTPSink struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPSink creates a sink posting events to the URL.
+// If the client is nil, a client with DefaultHTTPTimeout is used.
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	return &HTTPSink{client: client, url: url}
+}
+
+// Write posts the event to the endpoint. Responses other than 2xx are reported as errors.
+func (s *HTTPSink) Write(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit endpoint %s responded with %s", s.url, resp.Status)
+	}
+	return nil
+}
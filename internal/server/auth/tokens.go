@@ -0,0 +1,140 @@
+// Package auth authenticates clients by bearer tokens and authorizes them by role.
+//
+// Roles are ordered: an admin may do everything a writer may, and a writer
+// everything a reader may. Readers only read metrics, writers (agents) also update them,
+// and admins may additionally use the administrative routes.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rshafikov/alertme/internal/reload"
+)
+
+// Role is the access level granted to a token.
+type Role string
+
+const (
+	// RoleReader may read metrics.
+	RoleReader Role = "reader"
+	// RoleWriter may read and update metrics.
+	RoleWriter Role = "writer"
+	// RoleAdmin may read and update metrics and use the administrative routes.
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) level() int {
+	switch r {
+	case RoleReader:
+		return 1
+	case RoleWriter:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether the role grants access to routes requiring the given role.
+func (r Role) Allows(required Role) bool {
+	return r.level() > 0 && r.level() >= required.level()
+}
+
+// Token is a bearer token of a client. Name identifies the client in logs.
+type Token struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  Role   `json:"role"`
+}
+
+// Tokens is a set of tokens backed by a JSON file holding a list of tokens:
+//
+//	[{"name": "dashboard", "token": "secret", "role": "reader"}, {"name": "agent-1", "token": "secret", "role": "writer"}]
+//
+// Tokens are indexed by their SHA-256 hash, so lookups do not depend on how much of a token matches.
+type Tokens struct {
+	path   string
+	tokens atomic.Pointer[map[[sha256.Size]byte]Token]
+}
+
+// NewFileTokens creates a token set and loads the tokens from the file.
+func NewFileTokens(path string) (*Tokens, error) {
+	t := &Tokens{path: path}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload loads the tokens from the file again. On error the previously loaded tokens are kept.
+func (t *Tokens) Reload() error {
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return err
+	}
+
+	var list []Token
+	if err = json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("unable to parse tokens %s: %w", t.path, err)
+	}
+
+	tokens := make(map[[sha256.Size]byte]Token, len(list))
+	for _, tok := range list {
+		if tok.Token == "" {
+			return fmt.Errorf("tokens %s: token of %q must not be empty", t.path, tok.Name)
+		}
+		if tok.Role.level() == 0 {
+			return fmt.Errorf("tokens %s: unknown role %q of %q", t.path, tok.Role, tok.Name)
+		}
+		sum := sha256.Sum256([]byte(tok.Token))
+		if _, ok := tokens[sum]; ok {
+			return fmt.Errorf("tokens %s: duplicate token of %q", t.path, tok.Name)
+		}
+		tokens[sum] = tok
+	}
+
+	t.tokens.Store(&tokens)
+	return nil
+}
+
+// Lookup returns the token with the given value.
+func (t *Tokens) Lookup(token string) (Token, bool) {
+	tok, ok := (*t.tokens.Load())[sha256.Sum256([]byte(token))]
+	return tok, ok
+}
+
+// WatchSignals reloads the tokens every time one of the signals is received,
+// until the context is done. Reload errors are logged and the old tokens are kept.
+func (t *Tokens) WatchSignals(ctx context.Context, signals ...os.Signal) {
+	reload.OnSignal(ctx, "tokens", t.Reload, signals...)
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header value.
+func BearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+type tokenKey struct{}
+
+// WithToken returns a copy of the context carrying the authenticated token.
+func WithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// FromContext returns the authenticated token carried by the context, if any.
+func FromContext(ctx context.Context) (Token, bool) {
+	token, ok := ctx.Value(tokenKey{}).(Token)
+	return token, ok
+}
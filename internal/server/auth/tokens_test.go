@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTokens(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		expected bool
+	}{
+		{role: RoleReader, required: RoleReader, expected: true},
+		{role: RoleReader, required: RoleWriter, expected: false},
+		{role: RoleWriter, required: RoleReader, expected: true},
+		{role: RoleWriter, required: RoleAdmin, expected: false},
+		{role: RoleAdmin, required: RoleWriter, expected: true},
+		{role: Role("root"), required: RoleReader, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(string(test.role)+"/"+string(test.required), func(t *testing.T) {
+			assert.Equal(t, test.expected, test.role.Allows(test.required))
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeTokens(t, path, `[
+		{"name": "dashboard", "token": "read-token", "role": "reader"},
+		{"name": "agent-1", "token": "write-token", "role": "writer"}
+	]`)
+
+	tokens, err := NewFileTokens(path)
+	require.NoError(t, err)
+
+	tok, ok := tokens.Lookup("write-token")
+	require.True(t, ok)
+	assert.Equal(t, Token{Name: "agent-1", Token: "write-token", Role: RoleWriter}, tok)
+
+	_, ok = tokens.Lookup("unknown-token")
+	assert.False(t, ok)
+
+	t.Run("reload", func(t *testing.T) {
+		writeTokens(t, path, `[{"name": "admin", "token": "admin-token", "role": "admin"}]`)
+		require.NoError(t, tokens.Reload())
+
+		_, ok := tokens.Lookup("read-token")
+		assert.False(t, ok, "removed token is rejected")
+		tok, ok := tokens.Lookup("admin-token")
+		require.True(t, ok)
+		assert.Equal(t, RoleAdmin, tok.Role)
+	})
+
+	t.Run("failed reload keeps tokens", func(t *testing.T) {
+		writeTokens(t, path, `[{"name": "x", "token": "t", "role": "root"}]`)
+		assert.Error(t, tokens.Reload())
+
+		_, ok := tokens.Lookup("admin-token")
+		assert.True(t, ok)
+	})
+}
+
+func TestNewFileTokens(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid json", content: `{`},
+		{name: "empty token", content: `[{"name": "a", "token": "", "role": "reader"}]`},
+		{name: "unknown role", content: `[{"name": "a", "token": "t", "role": "root"}]`},
+		{name: "duplicate token", content: `[{"name": "a", "token": "t", "role": "reader"}, {"name": "b", "token": "t", "role": "admin"}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "tokens.json")
+			writeTokens(t, path, test.content)
+			_, err := NewFileTokens(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+		ok       bool
+	}{
+		{header: "Bearer abc", expected: "abc", ok: true},
+		{header: "bearer abc", expected: "abc", ok: true},
+		{header: "Basic abc"},
+		{header: "Bearer "},
+		{header: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			token, ok := BearerToken(test.header)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, token)
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	tok := Token{Name: "agent-1", Role: RoleWriter}
+	got, ok := FromContext(WithToken(context.Background(), tok))
+	require.True(t, ok)
+	assert.Equal(t, tok, got)
+}
@@ -218,30 +218,44 @@ func (db *DB) Clear(ctx context.Context) {
 }
 
 func (db *DB) AddBatch(ctx context.Context, metrics []*models.Metric) error {
+	_, err := db.AddBatchTotals(ctx, metrics)
+	return err
+}
+
+// AddBatchTotals adds metrics to the database in a single transaction, like AddBatch,
+// and returns the stored metrics, counters carrying their total after the write.
+// It implements the storage.TotalsAdder interface.
+func (db *DB) AddBatchTotals(ctx context.Context, metrics []*models.Metric) ([]*models.Metric, error) {
+	var stored []*models.Metric
 	if err := retry.OnErr(
 		ctx,
 		[]error{ErrConnToDB, ErrDB},
 		DBConnErrRetryIntervals,
 		func(args ...any) error {
-			rawErr := db.batchTx(ctx, metrics)
+			var rawErr error
+			stored, rawErr = db.batchTx(ctx, metrics)
 			return handlePGErr(rawErr, "connection failed", pgerrcode.ConnectionException)
 		},
 	); err != nil {
 		logger.Log.Error("failed to add metrics", zap.Error(err))
-		return err
+		return nil, err
 	}
 
-	return nil
+	return stored, nil
 }
 
-func (db *DB) batchTx(ctx context.Context, metrics []*models.Metric) error {
+// batchTx writes the metrics in a transaction and returns the stored metrics.
+// The received metrics are left untouched, so the transaction can be retried.
+func (db *DB) batchTx(ctx context.Context, metrics []*models.Metric) ([]*models.Metric, error) {
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
+	stored := make([]*models.Metric, 0, len(metrics))
 	for _, metric := range metrics {
+		metric = metric.Clone()
 		if metric.Type == models.CounterType {
 			var oldDelta sql.NullInt64
 			err = tx.QueryRow(
@@ -257,17 +271,18 @@ func (db *DB) batchTx(ctx context.Context, metrics []*models.Metric) error {
 		_, err = tx.Exec(ctx, updateQuery, metric.Name, metric.Value, metric.Delta, metric.Type)
 		if err != nil {
 			logger.Log.Error(errmsg.UnableToAddMetric, zap.Error(err))
-			return err
+			return nil, err
 		}
+		stored = append(stored, metric)
 	}
 	err = tx.Commit(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	logger.Log.Debug("metrics were added successfully")
 
-	return nil
+	return stored, nil
 }
 
 func (db *DB) Ping(ctx context.Context) error {
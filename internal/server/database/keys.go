@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/rshafikov/alertme/internal/server/keys"
+	"github.com/rshafikov/alertme/internal/server/retry"
+)
+
+const getKeyQuery = `
+	SELECT id, secret, revoked_at IS NOT NULL
+	FROM agent_keys
+	WHERE id = $1;
+`
+
+// LookupKey returns the agent key with the given ID from the agent_keys table.
+// It implements the keys.Registry interface and uses retry logic to handle database connection errors.
+// Returns keys.ErrUnknownKey if the key doesn't exist.
+//
+// Keys are not cached, so keys added, revoked or restored in the table with SQL, as described
+// in the README, apply to the next request.
+func (db *DB) LookupKey(ctx context.Context, id string) (keys.Key, error) {
+	var key keys.Key
+	if err := retry.OnErr(
+		ctx,
+		[]error{ErrConnToDB, ErrDB},
+		DBConnErrRetryIntervals,
+		func(args ...any) error {
+			rawErr := db.Pool.QueryRow(ctx, getKeyQuery, id).Scan(&key.ID, &key.Secret, &key.Revoked)
+
+			return handlePGErr(rawErr, "connection failed", pgerrcode.ConnectionException)
+		},
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return keys.Key{}, keys.ErrUnknownKey
+		}
+		return keys.Key{}, err
+	}
+
+	return key, nil
+}
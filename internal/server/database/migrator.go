@@ -21,7 +21,7 @@ func NewMigrator(pool *pgxpool.Pool) *Migrator {
 }
 
 // MakeMigrations applies all migrations to the database.
-// It creates the metric type enum and the metrics table.
+// It creates the metric type enum, the metrics table and the agent keys table.
 // Returns an error if any migration fails.
 func (m *Migrator) MakeMigrations(ctx context.Context) error {
 	_, err := m.Pool.Exec(ctx, migrations.CreateMetricsType)
@@ -35,5 +35,11 @@ func (m *Migrator) MakeMigrations(ctx context.Context) error {
 		logger.Log.Error("unable to make migrations", zap.Error(err))
 		return err
 	}
+
+	_, err = m.Pool.Exec(ctx, migrations.CreateAgentKeysTable)
+	if err != nil {
+		logger.Log.Error("unable to create agent keys table", zap.Error(err))
+		return err
+	}
 	return nil
 }
@@ -5,10 +5,14 @@ const (
 	InvalidMetricValue    = "invalid metric value"
 	MetricNameRequired    = "metric name is required"
 	MetricNotFound        = "metric not found"
+	QueryRequired         = "query expression is required"
+	RequestTooLarge       = "request body too large"
+	TooManyMetrics        = "too many metrics in batch"
 	UnableToDecodeJSON    = "invalid request body, cannot decode JSON"
 	UnableToEncodeJSON    = "cannot encode JSON body"
 	UnableToParseInt      = "unable to parse int"
 	UnableToParseFloat    = "unable to parse float"
+	UnableToReadBody      = "cannot read request body"
 	UnableToParseTemplate = "cannot parse template"
 	UnableToWriteTemplate = "cannot write template"
 	UnableToWriteResponse = "cannot write response body"
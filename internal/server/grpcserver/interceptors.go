@@ -0,0 +1,473 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/proto"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/keys"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+	"github.com/rshafikov/alertme/internal/server/settings"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// LoggerUnaryInterceptor logs the method, status code and duration of unary calls,
+// like the Logger HTTP middleware.
+func LoggerUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+// LoggerStreamInterceptor logs the method, status code and duration of streaming calls,
+// like the Logger HTTP middleware.
+func LoggerStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+func logCall(method string, start time.Time, err error) {
+	code := status.Code(err)
+	logger.Log.Info("-",
+		zap.String("method", method),
+		zap.Uint32("code", uint32(code)),
+		zap.String("status_text", code.String()),
+		zap.String("duration", time.Since(start).String()),
+	)
+}
+
+// HasherUnaryInterceptor verifies and generates HMAC SHA-256 hashes for unary calls with the shared key,
+// see NewHasherUnaryInterceptor.
+func HasherUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return NewHasherUnaryInterceptor(middlewares.HasherConfig{})(ctx, req, info, handler)
+}
+
+// NewHasherUnaryInterceptor returns an interceptor that verifies and generates HMAC SHA-256 hashes for unary calls,
+// like the Hasher HTTP middleware. The request hash is read from the "hashsha256"
+// metadata and the response hash is sent in the header metadata under the same key.
+// Calls with the "keyid" metadata use the key of that ID from the registry, other calls the shared key.
+// If no key applies to the call, the interceptor is effectively disabled.
+func NewHasherUnaryInterceptor(cfg middlewares.HasherConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		key, err := resolveKey(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		if received := metadata.ValueFromIncomingContext(ctx, proto.HashMetadataKey); len(received) > 0 && received[0] != "" {
+			msg, ok := req.(protobuf.Message)
+			if !ok || !hashMatches(key, msg, received[0]) {
+				logger.Log.Debug("hash mismatch")
+				return nil, status.Error(codes.InvalidArgument, "hash mismatch")
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		md, err := responseHash(key, resp)
+		if err != nil {
+			return nil, err
+		}
+		if err = grpc.SetHeader(ctx, md); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// HasherStreamInterceptor verifies the hash of every signed message received on a stream with the shared key,
+// see NewHasherStreamInterceptor.
+func HasherStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return NewHasherStreamInterceptor(middlewares.HasherConfig{})(srv, ss, info, handler)
+}
+
+// NewHasherStreamInterceptor returns an interceptor that verifies the hash of every message received
+// on a stream and adds the hash of the response to the header metadata, like the Hasher
+// and RequireSignature HTTP middlewares. Streams with the "keyid" metadata use the key of that ID
+// from the registry and are rejected with Unauthenticated if it is unknown or revoked,
+// other streams use the shared key. With a registry, streams without a key ID and no shared key are unsigned.
+//
+// Messages that do not match their hash are rejected with InvalidArgument, or Unauthenticated in strict mode.
+// Unsigned messages are reported to the RejectionRecorder and, in strict mode, rejected with Unauthenticated.
+// If no key applies to the stream and there is no registry, the interceptor is effectively disabled.
+//
+// Streams with the "timestamp" and "nonce" metadata have their messages signed together with them
+// and their sequence number in the stream, see proto.HashMessageAt, so a message cannot be replayed
+// within the stream. The stream is rejected with Unauthenticated if it is stale or replayed according
+// to the nonce cache, checked once the first message is verified. Messages signed without
+// this metadata are reported as RejectLegacy and accepted; if nonces are required, they are rejected
+// with Unauthenticated instead.
+func NewHasherStreamInterceptor(cfg middlewares.HasherConfig) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		key, err := resolveKey(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		if key == "" && cfg.Keys == nil {
+			return handler(srv, ss)
+		}
+		return handler(srv, &hashStream{
+			ServerStream: ss,
+			key:          key,
+			cfg:          cfg,
+			timestamp:    metadataValue(ctx, proto.TimestampMetadataKey),
+			nonce:        metadataValue(ctx, proto.NonceMetadataKey),
+		})
+	}
+}
+
+// resolveKey returns the key of the ID in the "keyid" metadata from the registry, or the shared key
+// if there is no key ID. Unknown and revoked keys are rejected with Unauthenticated.
+func resolveKey(ctx context.Context, cfg middlewares.HasherConfig) (string, error) {
+	keyID := metadataValue(ctx, proto.KeyIDMetadataKey)
+	if keyID == "" {
+		return settings.CONF.Key, nil
+	}
+	if cfg.Keys == nil {
+		return "", reject(ctx, cfg, middlewares.RejectUnknownKey, codes.Unauthenticated, keys.ErrUnknownKey.Error())
+	}
+	secret, err := keys.Secret(ctx, cfg.Keys, keyID)
+	if err != nil {
+		logger.Log.Debug("unable to resolve key", zap.String("key_id", keyID), zap.Error(err))
+		if errors.Is(err, keys.ErrUnknownKey) || errors.Is(err, keys.ErrRevokedKey) {
+			return "", reject(ctx, cfg, middlewares.RejectUnknownKey, codes.Unauthenticated, err.Error())
+		}
+		return "", status.Error(codes.Internal, "unable to resolve key")
+	}
+	return secret, nil
+}
+
+// reject reports the rejection to the RejectionRecorder and returns the error to reject the call with.
+func reject(ctx context.Context, cfg middlewares.HasherConfig, reason string, code codes.Code, msg string) error {
+	if cfg.Rejections != nil {
+		cfg.Rejections(ctx, reason)
+	}
+	return status.Error(code, msg)
+}
+
+// metadataValue returns the first value of the incoming metadata key, or an empty string.
+func metadataValue(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// signedMessage is a stream message carrying its own hash.
+type signedMessage interface {
+	GetHash() string
+	Verify(key string) bool
+	VerifyAt(key, timestamp, nonce string, seq uint64) bool
+}
+
+// hashStream wraps a grpc.ServerStream to verify received messages and sign sent ones.
+// The key is empty if no key applies to the stream.
+type hashStream struct {
+	grpc.ServerStream
+	cfg       middlewares.HasherConfig
+	key       string
+	timestamp string
+	nonce     string
+	// seq is the sequence number of the next message received on the stream.
+	seq uint64
+	// fresh is set once the timestamp and the nonce have passed the nonce cache.
+	fresh bool
+}
+
+// RecvMsg receives a message and verifies its hash.
+func (s *hashStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	sm, ok := m.(signedMessage)
+	if !ok {
+		return nil
+	}
+	seq := s.seq
+	s.seq++
+
+	ctx := s.Context()
+	if s.key == "" || sm.GetHash() == "" {
+		logger.Log.Debug("unsigned message", zap.Bool("strict", s.cfg.Strict))
+		if !s.cfg.Strict {
+			if s.cfg.Rejections != nil {
+				s.cfg.Rejections(ctx, middlewares.RejectMissing)
+			}
+			return nil
+		}
+		return reject(ctx, s.cfg, middlewares.RejectMissing, codes.Unauthenticated, "signature required")
+	}
+
+	signed := s.timestamp != "" || s.nonce != ""
+	if !signed && s.cfg.RequireNonce {
+		logger.Log.Debug("missing timestamp and nonce")
+		return reject(ctx, s.cfg, middlewares.RejectLegacy, codes.Unauthenticated, "timestamp and nonce required")
+	}
+	var signedAt time.Time
+	var verified bool
+	if signed {
+		seconds, err := strconv.ParseInt(s.timestamp, 10, 64)
+		if err != nil || s.nonce == "" {
+			logger.Log.Debug("invalid timestamp or nonce", zap.String("timestamp", s.timestamp), zap.Error(err))
+			return reject(ctx, s.cfg, middlewares.RejectMalformed, codes.InvalidArgument, "invalid timestamp or nonce")
+		}
+		signedAt = time.Unix(seconds, 0)
+		verified = sm.VerifyAt(s.key, s.timestamp, s.nonce, seq)
+	} else {
+		verified = sm.Verify(s.key)
+	}
+	if !verified {
+		logger.Log.Debug("hash mismatch")
+		code := codes.InvalidArgument
+		if s.cfg.Strict {
+			code = codes.Unauthenticated
+		}
+		return reject(ctx, s.cfg, middlewares.RejectInvalid, code, "hash mismatch")
+	}
+
+	if signed && s.cfg.Nonces != nil && !s.fresh {
+		if err := s.cfg.Nonces.Check(signedAt, s.nonce); err != nil {
+			logger.Log.Debug("replay check failed", zap.String("nonce", s.nonce), zap.Error(err))
+			return reject(ctx, s.cfg, middlewares.RejectReplayed, codes.Unauthenticated, err.Error())
+		}
+		s.fresh = true
+	}
+	if !signed && s.cfg.Rejections != nil {
+		s.cfg.Rejections(ctx, middlewares.RejectLegacy)
+	}
+	return nil
+}
+
+// SendMsg adds the hash of the message to the header metadata, if a key applies to the stream, and sends it.
+func (s *hashStream) SendMsg(m any) error {
+	if s.key == "" {
+		return s.ServerStream.SendMsg(m)
+	}
+	md, err := responseHash(s.key, m)
+	if err != nil {
+		return err
+	}
+	if err = s.ServerStream.SetHeader(md); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func hashMatches(key string, msg protobuf.Message, receivedHex string) bool {
+	received, err := hex.DecodeString(receivedHex)
+	if err != nil {
+		return false
+	}
+	expectedHex, err := proto.HashMessage(key, msg)
+	if err != nil {
+		return false
+	}
+	expected, _ := hex.DecodeString(expectedHex)
+	return hmac.Equal(received, expected)
+}
+
+// responseHash returns the header metadata carrying the hash of the response.
+func responseHash(key string, resp any) (metadata.MD, error) {
+	msg, ok := resp.(protobuf.Message)
+	if !ok {
+		return metadata.MD{}, nil
+	}
+	hash, err := proto.HashMessage(key, msg)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return metadata.Pairs(proto.HashMetadataKey, hash), nil
+}
+
+// RateLimitStreamInterceptor returns an interceptor that limits the rate of messages received on client streams,
+// which update metrics, per client address, like the RateLimit HTTP middleware limits requests.
+// Messages exceeding the limit are rejected with ResourceExhausted. A nil limiter disables the check.
+func RateLimitStreamInterceptor(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if limiter == nil || !info.IsClientStream {
+			return handler(srv, ss)
+		}
+		return handler(srv, &rateLimitStream{ServerStream: ss, limiter: limiter, client: peerAddress(ss.Context())})
+	}
+}
+
+// rateLimitStream wraps a grpc.ServerStream to take a token from the client's bucket for every received message.
+type rateLimitStream struct {
+	grpc.ServerStream
+	limiter *ratelimit.Limiter
+	client  string
+}
+
+// RecvMsg receives a message and rejects it if the rate limit does not allow it.
+func (s *rateLimitStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if ok, wait := s.limiter.Allow(s.client); !ok {
+		logger.Log.Debug("rate limit exceeded", zap.String("client", s.client), zap.Duration("retry_after", wait))
+		return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s", wait.Round(time.Second))
+	}
+	return nil
+}
+
+// peerAddress returns the host the call was received from.
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// TrustedSubnetStreamInterceptor returns an interceptor that only lets through client streams,
+// which update metrics, if the "x-real-ip" metadata holds an address within the trusted subnet.
+// Other streams are rejected with PermissionDenied. Unary calls are read-only and not checked.
+// A nil subnet disables the check.
+func TrustedSubnetStreamInterceptor(subnet *net.IPNet) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if subnet == nil || !info.IsClientStream {
+			return handler(srv, ss)
+		}
+
+		var realIP string
+		if values := metadata.ValueFromIncomingContext(ss.Context(), proto.RealIPMetadataKey); len(values) > 0 {
+			realIP = values[0]
+		}
+		ip := net.ParseIP(realIP)
+		if ip == nil || !subnet.Contains(ip) {
+			logger.Log.Debug("request from untrusted address", zap.String("real_ip", realIP))
+			return status.Error(codes.PermissionDenied, "forbidden")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// AuthUnaryInterceptor returns an interceptor that requires a bearer token granting the reader role
+// on unary calls, which are read-only, like the RequireRole HTTP middleware.
+// Calls without a known token are rejected with Unauthenticated, calls whose token
+// grants a lower role with PermissionDenied. Nil tokens disable the check.
+func AuthUnaryInterceptor(tokens *auth.Tokens) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if tokens == nil {
+			return handler(ctx, req)
+		}
+		token, err := authorize(ctx, tokens, auth.RoleReader)
+		if err != nil {
+			return nil, err
+		}
+		return handler(auth.WithToken(ctx, token), req)
+	}
+}
+
+// AuthStreamInterceptor returns an interceptor that requires a bearer token granting the writer role
+// on client streams, which update metrics, and the reader role on other streams.
+// Nil tokens disable the check.
+func AuthStreamInterceptor(tokens *auth.Tokens) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if tokens == nil {
+			return handler(srv, ss)
+		}
+		role := auth.RoleReader
+		if info.IsClientStream {
+			role = auth.RoleWriter
+		}
+		token, err := authorize(ss.Context(), tokens, role)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tokenStream{ServerStream: ss, ctx: auth.WithToken(ss.Context(), token)})
+	}
+}
+
+// tokenStream carries the token the stream was authorized with in its context.
+type tokenStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context holding the token.
+func (s *tokenStream) Context() context.Context {
+	return s.ctx
+}
+
+func authorize(ctx context.Context, tokens *auth.Tokens, role auth.Role) (auth.Token, error) {
+	var value string
+	if values := metadata.ValueFromIncomingContext(ctx, proto.AuthorizationMetadataKey); len(values) > 0 {
+		value, _ = auth.BearerToken(values[0])
+	}
+	token, ok := tokens.Lookup(value)
+	if value == "" || !ok {
+		logger.Log.Debug("unauthenticated call")
+		return auth.Token{}, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	if !token.Role.Allows(role) {
+		logger.Log.Debug("insufficient role", zap.String("token", token.Name), zap.String("required", string(role)))
+		return auth.Token{}, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return token, nil
+}
+
+// AgentInfoStreamInterceptor returns an interceptor that records the host metadata carried by
+// the "agent-*" metadata of client streams in the registry, the counterpart of the /agents/info HTTP route.
+// Agents send the metadata on the first stream of a connection, streams without it are let through as is.
+// A nil registry disables the interceptor.
+func AgentInfoStreamInterceptor(registry *agents.Registry) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if registry == nil || !info.IsClientStream {
+			return handler(srv, ss)
+		}
+
+		ctx := ss.Context()
+		get := func(key string) string {
+			if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+		agentInfo := agents.FromMetadata(get)
+		if agentInfo.Hostname != "" {
+			address := get(proto.RealIPMetadataKey)
+			if p, ok := peer.FromContext(ctx); ok && address == "" {
+				address, _, _ = net.SplitHostPort(p.Addr.String())
+			}
+			if err := registry.Update(agentInfo, address); err != nil {
+				logger.Log.Debug("unable to record agent info", zap.Error(err))
+			} else {
+				logger.Log.Info("agent connected",
+					zap.String("hostname", agentInfo.Hostname),
+					zap.String("os", agentInfo.OS),
+					zap.String("kernel", agentInfo.KernelVersion),
+				)
+			}
+		}
+		return handler(srv, ss)
+	}
+}
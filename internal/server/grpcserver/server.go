@@ -0,0 +1,162 @@
+// Package grpcserver implements the gRPC metrics service on top of the metric storage.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/proto"
+	"github.com/rshafikov/alertme/internal/server/audit"
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/database"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsServer implements the Metrics gRPC service.
+type MetricsServer struct {
+	proto.UnimplementedMetricsServer
+	store    storage.BaseMetricStorage
+	auditor  *audit.Auditor
+	maxBatch int
+}
+
+// NewMetricsServer creates a new gRPC metrics service backed by the provided storage.
+func NewMetricsServer(store storage.BaseMetricStorage) *MetricsServer {
+	return &MetricsServer{store: store}
+}
+
+// Config configures the checks of the gRPC server shared with the HTTP routes.
+type Config struct {
+	// Signatures configures the hashing interceptors like the Hasher and RequireSignature HTTP middlewares.
+	Signatures middlewares.HasherConfig
+	// Limiter limits the rate of UpdateMetrics messages per client address. If nil, the rate is not limited.
+	Limiter *ratelimit.Limiter
+	// MaxMessageSize limits the size of received messages in bytes. Zero means the gRPC default of 4 MiB.
+	MaxMessageSize int
+	// MaxBatchSize limits the number of metrics in a single UpdateMetrics message. Zero means no limit.
+	MaxBatchSize int
+	// Auditor receives an event for every batch stored by UpdateMetrics. If nil, writes are not audited.
+	Auditor *audit.Auditor
+}
+
+// NewServer creates a gRPC server with the logging, rate limiting and hashing interceptors
+// and registers the metrics service on it. Interceptors passed in opts run after them.
+func NewServer(store storage.BaseMetricStorage, cfg Config, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(LoggerUnaryInterceptor, NewHasherUnaryInterceptor(cfg.Signatures)),
+		grpc.ChainStreamInterceptor(
+			LoggerStreamInterceptor,
+			RateLimitStreamInterceptor(cfg.Limiter),
+			NewHasherStreamInterceptor(cfg.Signatures),
+		),
+	}, opts...)
+	if cfg.MaxMessageSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxMessageSize))
+	}
+	s := grpc.NewServer(opts...)
+	metricsServer := NewMetricsServer(store)
+	metricsServer.maxBatch = cfg.MaxBatchSize
+	metricsServer.auditor = cfg.Auditor
+	proto.RegisterMetricsServer(s, metricsServer)
+	return s
+}
+
+// UpdateMetrics stores every batch received on the stream.
+// A batch is validated as a whole and rejected with InvalidArgument if any metric is invalid,
+// or if it holds more metrics than allowed.
+func (s *MetricsServer) UpdateMetrics(stream grpc.ClientStreamingServer[proto.UpdateMetricsRequest, proto.UpdateMetricsResponse]) error {
+	ctx := stream.Context()
+
+	var accepted int64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&proto.UpdateMetricsResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.maxBatch > 0 && len(req.GetMetrics()) > s.maxBatch {
+			logger.Log.Debug("batch too large", zap.Int("size", len(req.GetMetrics())), zap.Int("max", s.maxBatch))
+			return status.Errorf(codes.InvalidArgument, "batch of more than %d metrics", s.maxBatch)
+		}
+
+		batch := make([]*models.Metric, 0, len(req.GetMetrics()))
+		for _, pm := range req.GetMetrics() {
+			m, convErr := pm.ToModel()
+			if convErr != nil {
+				logger.Log.Debug("invalid metric", zap.Error(convErr))
+				return status.Error(codes.InvalidArgument, convErr.Error())
+			}
+			batch = append(batch, m)
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		if saveErr := s.store.AddBatch(ctx, batch); saveErr != nil {
+			logger.Log.Debug(saveErr.Error())
+			return status.Error(codes.Internal, saveErr.Error())
+		}
+		accepted += int64(len(batch))
+		s.audit(ctx, batch)
+	}
+}
+
+// audit reports the stored batch to the auditor, if any.
+func (s *MetricsServer) audit(ctx context.Context, batch []*models.Metric) {
+	if s.auditor == nil {
+		return
+	}
+
+	event := audit.Event{
+		Action:    audit.ActionUpdate,
+		Timestamp: time.Now().Unix(),
+		Metrics:   make([]string, 0, len(batch)),
+		IPAddress: peerAddress(ctx),
+		RealIP:    metadataValue(ctx, proto.RealIPMetadataKey),
+		KeyID:     metadataValue(ctx, proto.KeyIDMetadataKey),
+	}
+	if token, ok := auth.FromContext(ctx); ok {
+		event.Client = token.Name
+	}
+	for _, m := range batch {
+		event.Metrics = append(event.Metrics, m.Name)
+	}
+	s.auditor.Notify(event)
+}
+
+// GetMetric returns a single stored metric or NotFound if it does not exist.
+func (s *MetricsServer) GetMetric(ctx context.Context, req *proto.GetMetricRequest) (*proto.GetMetricResponse, error) {
+	metricType, err := proto.ModelType(req.GetType())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	m, err := s.store.Get(ctx, metricType, req.GetId())
+	if err != nil {
+		logger.Log.Debug("an error happened during request", zap.Error(err))
+		if errors.Is(err, database.ErrDB) || errors.Is(err, database.ErrConnToDB) {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &proto.GetMetricResponse{Metric: proto.FromModel(m)}, nil
+}
+
+// ListMetrics returns all stored metrics.
+func (s *MetricsServer) ListMetrics(ctx context.Context, _ *proto.ListMetricsRequest) (*proto.ListMetricsResponse, error) {
+	return &proto.ListMetricsResponse{Metrics: proto.FromModels(s.store.List(ctx))}, nil
+}
@@ -0,0 +1,574 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/proto"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/audit"
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/keys"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+	"github.com/rshafikov/alertme/internal/server/replay"
+	"github.com/rshafikov/alertme/internal/server/settings"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, store storage.BaseMetricStorage) proto.MetricsClient {
+	t.Helper()
+	return serve(t, NewServer(store, Config{}))
+}
+
+// serve starts the server on an in-memory listener and returns a client connected to it.
+func serve(t *testing.T, srv *grpc.Server) proto.MetricsClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return proto.NewMetricsClient(conn)
+}
+
+func TestMetricsServer_UpdateMetrics(t *testing.T) {
+	store := storage.NewMemStorage()
+	client := newTestClient(t, store)
+	ctx := context.Background()
+
+	stream, err := client.UpdateMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "grpc_g", Type: proto.Metric_GAUGE, Value: 1.5},
+		{Id: "grpc_c", Type: proto.Metric_COUNTER, Delta: 2},
+	}}))
+	require.NoError(t, stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "grpc_c", Type: proto.Metric_COUNTER, Delta: 3},
+	}}))
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.GetAccepted())
+
+	m, err := store.Get(ctx, models.CounterType, "grpc_c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *m.Delta)
+
+	t.Run("invalid metric", func(t *testing.T) {
+		stream, err := client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+			{Type: proto.Metric_GAUGE, Value: 1},
+		}}))
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestMetricsServer_GetMetric(t *testing.T) {
+	store := storage.NewMemStorage()
+	value := 42.5
+	require.NoError(t, store.Add(context.Background(), &models.Metric{Name: "grpc_get", Type: models.GaugeType, Value: &value}))
+	client := newTestClient(t, store)
+
+	tests := []struct {
+		name         string
+		req          *proto.GetMetricRequest
+		expectedCode codes.Code
+	}{
+		{
+			name:         "existing metric",
+			req:          &proto.GetMetricRequest{Id: "grpc_get", Type: proto.Metric_GAUGE},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "missing metric",
+			req:          &proto.GetMetricRequest{Id: "grpc_missing", Type: proto.Metric_GAUGE},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "invalid type",
+			req:          &proto.GetMetricRequest{Id: "grpc_get", Type: proto.Metric_Type(42)},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := client.GetMetric(context.Background(), test.req)
+			require.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedCode == codes.OK {
+				assert.Equal(t, value, resp.GetMetric().GetValue())
+			}
+		})
+	}
+}
+
+func TestMetricsServer_ListMetrics(t *testing.T) {
+	store := storage.NewMemStorage()
+	value := 1.0
+	delta := int64(1)
+	require.NoError(t, store.AddBatch(context.Background(), []*models.Metric{
+		{Name: "grpc_list_g", Type: models.GaugeType, Value: &value},
+		{Name: "grpc_list_c", Type: models.CounterType, Delta: &delta},
+	}))
+	client := newTestClient(t, store)
+
+	resp, err := client.ListMetrics(context.Background(), &proto.ListMetricsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetMetrics(), 2)
+}
+
+func TestHasherInterceptors(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = "testkey"
+
+	store := storage.NewMemStorage()
+	client := newTestClient(t, store)
+	ctx := context.Background()
+
+	t.Run("signed stream message", func(t *testing.T) {
+		req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "hash_g", Type: proto.Metric_GAUGE, Value: 1}}}
+		require.NoError(t, req.Sign("testkey"))
+
+		stream, err := client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(req))
+		_, err = stream.CloseAndRecv()
+		require.NoError(t, err)
+
+		header, err := stream.Header()
+		require.NoError(t, err)
+		assert.NotEmpty(t, header.Get(proto.HashMetadataKey))
+	})
+
+	t.Run("wrongly signed stream message", func(t *testing.T) {
+		req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "hash_g", Type: proto.Metric_GAUGE, Value: 1}}}
+		require.NoError(t, req.Sign("wrongkey"))
+
+		stream, err := client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(req))
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("unary call with valid hash", func(t *testing.T) {
+		req := &proto.ListMetricsRequest{}
+		hash, err := proto.HashMessage("testkey", req)
+		require.NoError(t, err)
+
+		var header metadata.MD
+		md := metadata.Pairs(proto.HashMetadataKey, hash)
+		_, err = client.ListMetrics(metadata.NewOutgoingContext(ctx, md), req, grpc.Header(&header))
+		require.NoError(t, err)
+		assert.NotEmpty(t, header.Get(proto.HashMetadataKey))
+	})
+
+	t.Run("unary call with invalid hash", func(t *testing.T) {
+		md := metadata.Pairs(proto.HashMetadataKey, "deadbeef")
+		_, err := client.ListMetrics(metadata.NewOutgoingContext(ctx, md), &proto.ListMetricsRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestHasherStreamInterceptor_Signatures(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = ""
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"id": "agent-1", "key": "agentkey"}, {"id": "agent-0", "key": "oldkey", "revoked": true}]`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	registry, err := keys.NewFileRegistry(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		keyID          string
+		signKey        string
+		strict         bool
+		expectedCode   codes.Code
+		expectedReason string
+	}{
+		{name: "registry key", keyID: "agent-1", signKey: "agentkey", strict: true, expectedCode: codes.OK, expectedReason: middlewares.RejectLegacy},
+		{name: "unsigned message", keyID: "agent-1", strict: true, expectedCode: codes.Unauthenticated, expectedReason: middlewares.RejectMissing},
+		{name: "signed without key ID", signKey: "agentkey", strict: true, expectedCode: codes.Unauthenticated, expectedReason: middlewares.RejectMissing},
+		{name: "wrong key", keyID: "agent-1", signKey: "otherkey", strict: true, expectedCode: codes.Unauthenticated, expectedReason: middlewares.RejectInvalid},
+		{name: "revoked key", keyID: "agent-0", signKey: "oldkey", strict: true, expectedCode: codes.Unauthenticated, expectedReason: middlewares.RejectUnknownKey},
+		{name: "unsigned message without strict mode", expectedCode: codes.OK, expectedReason: middlewares.RejectMissing},
+		{name: "wrong key without strict mode", keyID: "agent-1", signKey: "otherkey", expectedCode: codes.InvalidArgument, expectedReason: middlewares.RejectInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var reasons []string
+			client := serve(t, NewServer(storage.NewMemStorage(), Config{Signatures: middlewares.HasherConfig{
+				Keys:   registry,
+				Strict: test.strict,
+				Rejections: func(_ context.Context, reason string) {
+					reasons = append(reasons, reason)
+				},
+			}}))
+
+			req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "sig_g", Type: proto.Metric_GAUGE, Value: 1}}}
+			if test.signKey != "" {
+				require.NoError(t, req.Sign(test.signKey))
+			}
+			ctx := context.Background()
+			if test.keyID != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, proto.KeyIDMetadataKey, test.keyID)
+			}
+
+			stream, err := client.UpdateMetrics(ctx)
+			require.NoError(t, err)
+			_ = stream.Send(req)
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, test.expectedCode, status.Code(err))
+			if test.expectedReason == "" {
+				assert.Empty(t, reasons)
+			} else {
+				assert.Equal(t, []string{test.expectedReason}, reasons)
+			}
+		})
+	}
+}
+
+func TestHasherStreamInterceptor_Replay(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = "secret"
+
+	nonces := replay.NewNonceCache(time.Minute, replay.DefaultCacheSize)
+	client := serve(t, NewServer(storage.NewMemStorage(), Config{Signatures: middlewares.HasherConfig{
+		Nonces: nonces,
+	}}))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	sendTo := func(client proto.MetricsClient, ctx context.Context, req *proto.UpdateMetricsRequest) error {
+		stream, err := client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		_ = stream.Send(req)
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	send := func(ctx context.Context, req *proto.UpdateMetricsRequest) error {
+		return sendTo(client, ctx, req)
+	}
+	signed := func(nonce string) (context.Context, *proto.UpdateMetricsRequest) {
+		req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "replay_g", Type: proto.Metric_GAUGE, Value: 1}}}
+		require.NoError(t, req.SignAt("secret", timestamp, nonce, 0))
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			proto.TimestampMetadataKey, timestamp, proto.NonceMetadataKey, nonce)
+		return ctx, req
+	}
+
+	ctx, req := signed("nonce-1")
+	assert.NoError(t, send(ctx, req))
+
+	t.Run("reused nonce", func(t *testing.T) {
+		ctx, req := signed("nonce-1")
+		assert.Equal(t, codes.Unauthenticated, status.Code(send(ctx, req)))
+	})
+
+	t.Run("messages of a stream", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			proto.TimestampMetadataKey, timestamp, proto.NonceMetadataKey, "nonce-4")
+		first := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "replay_c", Type: proto.Metric_COUNTER, Delta: 1}}}
+		require.NoError(t, first.SignAt("secret", timestamp, "nonce-4", 0))
+		second := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "replay_c", Type: proto.Metric_COUNTER, Delta: 2}}}
+		require.NoError(t, second.SignAt("secret", timestamp, "nonce-4", 1))
+
+		stream, err := client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(first))
+		require.NoError(t, stream.Send(second))
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), resp.GetAccepted())
+
+		ctx = metadata.AppendToOutgoingContext(context.Background(),
+			proto.TimestampMetadataKey, timestamp, proto.NonceMetadataKey, "nonce-5")
+		require.NoError(t, first.SignAt("secret", timestamp, "nonce-5", 0))
+		stream, err = client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(first))
+		_ = stream.Send(first)
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "a message replayed within the stream does not match its hash")
+	})
+
+	t.Run("missing timestamp and nonce", func(t *testing.T) {
+		req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "replay_g", Type: proto.Metric_GAUGE, Value: 1}}}
+		require.NoError(t, req.Sign("secret"))
+		assert.NoError(t, send(context.Background(), req))
+
+		strict := serve(t, NewServer(storage.NewMemStorage(), Config{Signatures: middlewares.HasherConfig{
+			Nonces:       nonces,
+			RequireNonce: true,
+		}}))
+		assert.Equal(t, codes.Unauthenticated, status.Code(sendTo(strict, context.Background(), req)))
+	})
+
+	t.Run("metadata not covered by the signature", func(t *testing.T) {
+		_, req := signed("nonce-2")
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			proto.TimestampMetadataKey, timestamp, proto.NonceMetadataKey, "nonce-3")
+		assert.Equal(t, codes.InvalidArgument, status.Code(send(ctx, req)))
+	})
+}
+
+func TestRateLimitStreamInterceptor(t *testing.T) {
+	client := serve(t, NewServer(storage.NewMemStorage(), Config{Limiter: ratelimit.NewLimiter(0.001, 1)}))
+	req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "limited_g", Type: proto.Metric_GAUGE, Value: 1}}}
+
+	stream, err := client.UpdateMetrics(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(req))
+	_ = stream.Send(req)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestMetricsServer_MaxBatchSize(t *testing.T) {
+	client := serve(t, NewServer(storage.NewMemStorage(), Config{MaxBatchSize: 1}))
+
+	stream, err := client.UpdateMetrics(context.Background())
+	require.NoError(t, err)
+	_ = stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "batch_g", Type: proto.Metric_GAUGE, Value: 1},
+		{Id: "batch_c", Type: proto.Metric_COUNTER, Delta: 1},
+	}})
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTrustedSubnetStreamInterceptor(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.10.0.0/16")
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := NewServer(storage.NewMemStorage(), Config{}, grpc.ChainStreamInterceptor(TrustedSubnetStreamInterceptor(subnet)))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMetricsClient(conn)
+
+	tests := []struct {
+		name         string
+		realIP       string
+		expectedCode codes.Code
+	}{
+		{name: "trusted address", realIP: "10.10.0.5", expectedCode: codes.OK},
+		{name: "untrusted address", realIP: "192.168.0.5", expectedCode: codes.PermissionDenied},
+		{name: "missing address", expectedCode: codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.realIP != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, proto.RealIPMetadataKey, test.realIP)
+			}
+
+			stream, err := client.UpdateMetrics(ctx)
+			require.NoError(t, err)
+			_ = stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "g", Type: proto.Metric_GAUGE, Value: 1}}})
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+
+	t.Run("unary calls are not checked", func(t *testing.T) {
+		_, err := client.ListMetrics(context.Background(), &proto.ListMetricsRequest{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	content := `[{"name": "dashboard", "token": "read-token", "role": "reader"}, {"name": "agent", "token": "write-token", "role": "writer"}]`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	tokens, err := auth.NewFileTokens(path)
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := NewServer(storage.NewMemStorage(), Config{},
+		grpc.ChainUnaryInterceptor(AuthUnaryInterceptor(tokens)),
+		grpc.ChainStreamInterceptor(AuthStreamInterceptor(tokens)),
+	)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMetricsClient(conn)
+
+	withToken := func(token string) context.Context {
+		ctx := context.Background()
+		if token == "" {
+			return ctx
+		}
+		return metadata.AppendToOutgoingContext(ctx, proto.AuthorizationMetadataKey, "Bearer "+token)
+	}
+
+	tests := []struct {
+		name               string
+		token              string
+		expectedUpdateCode codes.Code
+		expectedListCode   codes.Code
+	}{
+		{name: "writer", token: "write-token", expectedUpdateCode: codes.OK, expectedListCode: codes.OK},
+		{name: "reader", token: "read-token", expectedUpdateCode: codes.PermissionDenied, expectedListCode: codes.OK},
+		{name: "unknown token", token: "other", expectedUpdateCode: codes.Unauthenticated, expectedListCode: codes.Unauthenticated},
+		{name: "missing token", expectedUpdateCode: codes.Unauthenticated, expectedListCode: codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream, err := client.UpdateMetrics(withToken(test.token))
+			require.NoError(t, err)
+			_ = stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "g", Type: proto.Metric_GAUGE, Value: 1}}})
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, test.expectedUpdateCode, status.Code(err))
+
+			_, err = client.ListMetrics(withToken(test.token), &proto.ListMetricsRequest{})
+			assert.Equal(t, test.expectedListCode, status.Code(err))
+		})
+	}
+}
+
+func TestAgentInfoStreamInterceptor(t *testing.T) {
+	registry := agents.NewRegistry()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := NewServer(storage.NewMemStorage(), Config{}, grpc.ChainStreamInterceptor(AgentInfoStreamInterceptor(registry)))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMetricsClient(conn)
+
+	send := func(ctx context.Context) {
+		stream, err := client.UpdateMetrics(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "g", Type: proto.Metric_GAUGE, Value: 1}}}))
+		_, err = stream.CloseAndRecv()
+		require.NoError(t, err)
+	}
+
+	send(context.Background())
+	assert.Empty(t, registry.List(), "streams without metadata are not recorded")
+
+	info := agents.Info{Hostname: "web", OS: "linux", KernelVersion: "6.1.0"}
+	pairs := append(info.Pairs(), proto.RealIPMetadataKey, "10.10.0.5")
+	send(metadata.AppendToOutgoingContext(context.Background(), pairs...))
+
+	listed := registry.List()
+	require.Len(t, listed, 1)
+	assert.Equal(t, "web", listed[0].Hostname)
+	assert.Equal(t, "6.1.0", listed[0].KernelVersion)
+	assert.Equal(t, "10.10.0.5", listed[0].Address)
+}
+
+type recordingSink struct {
+	events []audit.Event
+	mu     sync.Mutex
+}
+
+func (s *recordingSink) Write(_ context.Context, event audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestMetricsServer_Audit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "agent", "token": "write-token", "role": "writer"}]`), 0o600))
+	tokens, err := auth.NewFileTokens(path)
+	require.NoError(t, err)
+
+	sink := &recordingSink{}
+	auditor := audit.NewAuditor(10, sink)
+	client := serve(t, NewServer(storage.NewMemStorage(), Config{Auditor: auditor},
+		grpc.ChainStreamInterceptor(AuthStreamInterceptor(tokens)),
+	))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		proto.AuthorizationMetadataKey, "Bearer write-token",
+		proto.RealIPMetadataKey, "10.0.0.1",
+	)
+	stream, err := client.UpdateMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "audit_g", Type: proto.Metric_GAUGE, Value: 1},
+		{Id: "audit_c", Type: proto.Metric_COUNTER, Delta: 1},
+	}}))
+	_, err = stream.CloseAndRecv()
+	require.NoError(t, err)
+	auditor.Close()
+
+	require.Len(t, sink.events, 1)
+	event := sink.events[0]
+	assert.Equal(t, audit.ActionUpdate, event.Action)
+	assert.Equal(t, []string{"audit_g", "audit_c"}, event.Metrics)
+	assert.Equal(t, "bufconn", event.IPAddress, "connection address is used despite x-real-ip")
+	assert.Equal(t, "10.0.0.1", event.RealIP)
+	assert.Equal(t, "agent", event.Client)
+}
@@ -0,0 +1,90 @@
+// Package history keeps a short in-memory history of recent metric values,
+// used to draw sparklines on the dashboard.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+)
+
+// DefaultSize is the default number of points kept for each metric.
+const DefaultSize = 60
+
+// Point is a single recorded metric value.
+type Point struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"v"`
+}
+
+// History records the most recent values of every published metric.
+// It implements storage.Publisher, so it can be fed from the storage write path.
+type History struct {
+	points map[string][]Point
+	now    func() time.Time
+	size   int
+	mu     sync.RWMutex
+}
+
+// NewHistory creates a history keeping up to size points per metric.
+// A non-positive size falls back to DefaultSize.
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &History{
+		points: make(map[string][]Point),
+		now:    time.Now,
+		size:   size,
+	}
+}
+
+// Publish records the current value of each metric, evicting the oldest points
+// once a metric reaches the history size.
+func (h *History) Publish(metrics ...*models.Metric) {
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, m := range metrics {
+		value, ok := pointValue(m)
+		if !ok {
+			continue
+		}
+		key := historyKey(m.Type, m.Name)
+		pts := h.points[key]
+		if len(pts) >= h.size {
+			pts = append(pts[:0:0], pts[len(pts)-h.size+1:]...)
+		}
+		h.points[key] = append(pts, Point{Time: now, Value: value})
+	}
+}
+
+// Get returns a copy of the recorded points of the metric, oldest first.
+func (h *History) Get(metricType models.MetricType, name string) []Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pts := h.points[historyKey(metricType, name)]
+	if len(pts) == 0 {
+		return nil
+	}
+	return append([]Point(nil), pts...)
+}
+
+func historyKey(metricType models.MetricType, name string) string {
+	return string(metricType) + "-" + name
+}
+
+func pointValue(m *models.Metric) (float64, bool) {
+	switch {
+	case m.Type == models.GaugeType && m.Value != nil:
+		return *m.Value, true
+	case m.Type == models.CounterType && m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
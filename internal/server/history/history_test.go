@@ -0,0 +1,57 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_Publish(t *testing.T) {
+	h := NewHistory(3)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tick := 0
+	h.now = func() time.Time {
+		tick++
+		return start.Add(time.Duration(tick) * time.Second)
+	}
+
+	for i := 1; i <= 5; i++ {
+		value := float64(i)
+		delta := int64(i * 10)
+		h.Publish(
+			&models.Metric{Name: "g", Type: models.GaugeType, Value: &value},
+			&models.Metric{Name: "c", Type: models.CounterType, Delta: &delta},
+		)
+	}
+
+	t.Run("keeps last points of gauge", func(t *testing.T) {
+		pts := h.Get(models.GaugeType, "g")
+		require.Len(t, pts, 3)
+		assert.Equal(t, []float64{3, 4, 5}, []float64{pts[0].Value, pts[1].Value, pts[2].Value})
+		assert.True(t, pts[0].Time.Before(pts[2].Time))
+	})
+
+	t.Run("records counter totals", func(t *testing.T) {
+		pts := h.Get(models.CounterType, "c")
+		require.Len(t, pts, 3)
+		assert.Equal(t, float64(50), pts[2].Value)
+	})
+
+	t.Run("unknown metric", func(t *testing.T) {
+		assert.Nil(t, h.Get(models.GaugeType, "unknown"))
+	})
+
+	t.Run("returned points are a copy", func(t *testing.T) {
+		pts := h.Get(models.GaugeType, "g")
+		pts[0].Value = 100
+		assert.Equal(t, float64(3), h.Get(models.GaugeType, "g")[0].Value)
+	})
+
+	t.Run("metrics without value are skipped", func(t *testing.T) {
+		h.Publish(&models.Metric{Name: "empty", Type: models.GaugeType})
+		assert.Nil(t, h.Get(models.GaugeType, "empty"))
+	})
+}
@@ -0,0 +1,109 @@
+// Package keys provides registries of per-agent keys used to sign transmitted data.
+//
+// Every agent signs its requests with its own key and sends the key ID along,
+// so keys can be rotated agent by agent: a new key is added to the registry,
+// agents switch to it, and the old key is revoked.
+package keys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/rshafikov/alertme/internal/reload"
+)
+
+// ErrUnknownKey is returned when the registry has no key with the given ID.
+var ErrUnknownKey = errors.New("unknown key")
+
+// ErrRevokedKey is returned when the key with the given ID has been revoked.
+var ErrRevokedKey = errors.New("revoked key")
+
+// Key is a signing key of an agent.
+type Key struct {
+	ID      string `json:"id"`
+	Secret  string `json:"key"`
+	Revoked bool   `json:"revoked,omitempty"`
+}
+
+// Registry looks up agent keys by ID.
+type Registry interface {
+	// LookupKey returns the key with the given ID or ErrUnknownKey if there is none.
+	// Revoked keys are returned with Revoked set.
+	LookupKey(ctx context.Context, id string) (Key, error)
+}
+
+// Secret returns the secret of the active key with the given ID.
+// Returns ErrUnknownKey or ErrRevokedKey if the key cannot be used.
+func Secret(ctx context.Context, registry Registry, id string) (string, error) {
+	key, err := registry.LookupKey(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if key.Revoked {
+		return "", ErrRevokedKey
+	}
+	return key.Secret, nil
+}
+
+// FileRegistry is a registry backed by a JSON file holding a list of keys:
+//
+//	[{"id": "agent-1", "key": "secret"}, {"id": "agent-0", "key": "old secret", "revoked": true}]
+type FileRegistry struct {
+	path string
+	keys atomic.Pointer[map[string]Key]
+}
+
+// NewFileRegistry creates a registry and loads the keys from the file.
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	r := &FileRegistry{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the keys from the file again. On error the previously loaded keys are kept.
+func (r *FileRegistry) Reload() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	var list []Key
+	if err = json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("unable to parse key registry %s: %w", r.path, err)
+	}
+
+	keys := make(map[string]Key, len(list))
+	for _, k := range list {
+		if k.ID == "" || k.Secret == "" {
+			return fmt.Errorf("key registry %s: key ID and key must not be empty", r.path)
+		}
+		if _, ok := keys[k.ID]; ok {
+			return fmt.Errorf("key registry %s: duplicate key ID %q", r.path, k.ID)
+		}
+		keys[k.ID] = k
+	}
+
+	r.keys.Store(&keys)
+	return nil
+}
+
+// LookupKey returns the key with the given ID.
+func (r *FileRegistry) LookupKey(_ context.Context, id string) (Key, error) {
+	key, ok := (*r.keys.Load())[id]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// WatchSignals reloads the keys every time one of the signals is received,
+// until the context is done. Reload errors are logged and the old keys are kept.
+func (r *FileRegistry) WatchSignals(ctx context.Context, signals ...os.Signal) {
+	reload.OnSignal(ctx, "key registry", r.Reload, signals...)
+}
@@ -0,0 +1,101 @@
+package keys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRegistry(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestFileRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeRegistry(t, path, `[
+		{"id": "agent-1", "key": "secret-1"},
+		{"id": "agent-0", "key": "secret-0", "revoked": true}
+	]`)
+
+	registry, err := NewFileRegistry(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedSecret string
+		expectedErr    error
+	}{
+		{name: "active key", id: "agent-1", expectedSecret: "secret-1"},
+		{name: "revoked key", id: "agent-0", expectedErr: ErrRevokedKey},
+		{name: "unknown key", id: "agent-2", expectedErr: ErrUnknownKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret, err := Secret(ctx, registry, test.id)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedSecret, secret)
+		})
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		writeRegistry(t, path, `[
+			{"id": "agent-1", "key": "secret-1", "revoked": true},
+			{"id": "agent-2", "key": "secret-2"}
+		]`)
+		require.NoError(t, registry.Reload())
+
+		_, err := Secret(ctx, registry, "agent-1")
+		assert.ErrorIs(t, err, ErrRevokedKey)
+
+		secret, err := Secret(ctx, registry, "agent-2")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-2", secret)
+	})
+
+	t.Run("failed reload keeps keys", func(t *testing.T) {
+		writeRegistry(t, path, `not a json`)
+		assert.Error(t, registry.Reload())
+
+		secret, err := Secret(ctx, registry, "agent-2")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-2", secret)
+	})
+}
+
+func TestNewFileRegistry(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid json", content: `{`},
+		{name: "empty key", content: `[{"id": "agent-1", "key": ""}]`},
+		{name: "empty id", content: `[{"id": "", "key": "secret"}]`},
+		{name: "duplicate id", content: `[{"id": "agent-1", "key": "a"}, {"id": "agent-1", "key": "b"}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "keys.json")
+			writeRegistry(t, path, test.content)
+			_, err := NewFileRegistry(path)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := NewFileRegistry(filepath.Join(dir, "missing.json"))
+		assert.Error(t, err)
+	})
+}
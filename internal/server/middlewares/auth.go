@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+)
+
+// AccessTokenParam is the query parameter carrying the bearer token of clients that cannot set
+// the "Authorization" header, such as browsers opening the dashboard or its WebSocket.
+const AccessTokenParam = "access_token"
+
+// RequireRole returns a middleware that only lets through requests carrying a bearer token
+// that grants the required role. The token is read from the "Authorization: Bearer" header,
+// or from the "access_token" query parameter. Requests without a known token are rejected
+// with 401 Unauthorized, requests whose token grants a lower role with 403 Forbidden.
+// The token is stored in the request context, see auth.FromContext.
+// Nil tokens disable the check.
+func RequireRole(tokens *auth.Tokens, role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if tokens == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			value, ok := auth.BearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				value = r.URL.Query().Get(AccessTokenParam)
+			}
+			token, ok := tokens.Lookup(value)
+			if value == "" || !ok {
+				logger.Log.Debug("unauthenticated request", zap.String("path", r.URL.Path))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="alertme"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !token.Role.Allows(role) {
+				logger.Log.Debug("insufficient role",
+					zap.String("token", token.Name),
+					zap.String("role", string(token.Role)),
+					zap.String("required", string(role)),
+				)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/auth"
+)
+
+func TestRequireRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	content := `[{"name": "dashboard", "token": "read-token", "role": "reader"}, {"name": "agent", "token": "write-token", "role": "writer"}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write tokens: %v", err)
+	}
+	tokens, err := auth.NewFileTokens(path)
+	if err != nil {
+		t.Fatalf("Failed to load tokens: %v", err)
+	}
+
+	var name string
+	handler := RequireRole(tokens, auth.RoleWriter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := auth.FromContext(r.Context())
+		name = token.Name
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		query         string
+		expectedCode  int
+		expectedName  string
+	}{
+		{name: "writer token", authorization: "Bearer write-token", expectedCode: http.StatusOK, expectedName: "agent"},
+		{name: "token in query", query: "?access_token=write-token", expectedCode: http.StatusOK, expectedName: "agent"},
+		{name: "reader token", authorization: "Bearer read-token", expectedCode: http.StatusForbidden},
+		{name: "unknown token", authorization: "Bearer other-token", expectedCode: http.StatusUnauthorized},
+		{name: "missing token", expectedCode: http.StatusUnauthorized},
+		{name: "basic auth", authorization: "Basic write-token", expectedCode: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name = ""
+			req := httptest.NewRequest("POST", "/"+test.query, nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+			if test.expectedCode == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate header to be set")
+			}
+			if name != test.expectedName {
+				t.Errorf("Expected token %q in context, got %q", test.expectedName, name)
+			}
+		})
+	}
+
+	t.Run("check disabled", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		RequireRole(nil, auth.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, httptest.NewRequest("POST", "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
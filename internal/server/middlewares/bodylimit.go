@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+)
+
+// bodyLimitKey is the context key of the body limit set by BodyLimiter.
+type bodyLimitKey struct{}
+
+// BodyLimiter returns a middleware that limits the request body to limit bytes.
+// Reading beyond it fails with an error recognized by BodyTooLarge.
+//
+// The limit applies to the body as received and, through GZipper, to the decompressed body,
+// so each route is bound by a single limit whatever the encoding of its requests.
+// BodyLimiter must run before any middleware reading the raw body, such as Decrypter,
+// so encrypted or compressed bodies cannot be buffered without bounds.
+// A limit of 0 disables it.
+func BodyLimiter(limit int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+				r = r.WithContext(context.WithValue(r.Context(), bodyLimitKey{}, limit))
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimit returns the body limit set by BodyLimiter, or 0 if the request is not limited.
+func bodyLimit(r *http.Request) int64 {
+	limit, _ := r.Context().Value(bodyLimitKey{}).(int64)
+	return limit
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"net/http"
+
+	"github.com/rshafikov/alertme/internal/encryption"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+)
+
+// Decrypter returns a middleware that decrypts request bodies encrypted with the server's public key.
+// Encrypted requests are marked with the "X-Encryption" header and decrypted with the private key
+// before the body is decompressed or its hash is verified, so it must run before GZipper and Hasher.
+// Requests without the header are passed through unchanged.
+// If the body cannot be decrypted, it returns a 400 Bad Request error, and if it is cut off
+// by BodyLimiter, a 413 Request Entity Too Large error.
+func Decrypter(key *rsa.PrivateKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(encryption.Header)
+			if scheme == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if scheme != encryption.Scheme {
+				logger.Log.Debug("unsupported encryption scheme", zap.String("scheme", scheme))
+				http.Error(w, "unsupported encryption scheme", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if BodyTooLarge(err) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to read body", http.StatusInternalServerError)
+				return
+			}
+
+			decrypted, err := encryption.Decrypt(key, body)
+			if err != nil {
+				logger.Log.Debug("unable to decrypt body", zap.Error(err))
+				http.Error(w, "unable to decrypt body", http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(decrypted))
+			r.ContentLength = int64(len(decrypted))
+			r.Header.Del(encryption.Header)
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/encryption"
+)
+
+func TestDecrypter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var received []byte
+	handler := Decrypter(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	payload := []byte(`[{"id":"test","type":"gauge","value":1}]`)
+	encrypted, err := encryption.Encrypt(&key.PublicKey, payload)
+	if err != nil {
+		t.Fatalf("Failed to encrypt payload: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		scheme       string
+		body         []byte
+		expectedBody []byte
+		expectedCode int
+	}{
+		{
+			name:         "encrypted body",
+			scheme:       encryption.Scheme,
+			body:         encrypted,
+			expectedBody: payload,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "plain body",
+			body:         payload,
+			expectedBody: payload,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "corrupted body",
+			scheme:       encryption.Scheme,
+			body:         payload,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unsupported scheme",
+			scheme:       "rot13",
+			body:         encrypted,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received = nil
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(test.body))
+			if test.scheme != "" {
+				req.Header.Set(encryption.Header, test.scheme)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+			if test.expectedBody != nil && !bytes.Equal(received, test.expectedBody) {
+				t.Errorf("Expected body %s, got %s", test.expectedBody, received)
+			}
+		})
+	}
+}
+
+func TestDecrypter_BodyLimit(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	called := false
+	handler := BodyLimiter(64)(Decrypter(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(make([]byte, 1024)))
+	req.Header.Set(encryption.Header, encryption.Scheme)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if called {
+		t.Error("Expected the request not to reach the handler")
+	}
+}
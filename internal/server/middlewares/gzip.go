@@ -2,34 +2,81 @@ package middlewares
 
 import (
 	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rshafikov/alertme/internal/server/settings"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 )
 
-// gzipWriterPool is a pool of gzip.Writer objects for reuse.
-// This reduces the overhead of creating new writers for each request.
-var gzipWriterPool = sync.Pool{
-	New: func() interface{} {
+// Content codings supported by GZipper for both requests and responses.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingZstd    = "zstd"
+)
+
+// supportedEncodings lists the response encodings in the order of preference,
+// used when the client accepts several of them with the same weight.
+var supportedEncodings = []string{EncodingZstd, EncodingGzip, EncodingDeflate}
+
+// CompressibleTypes is the allow-list of response media types GZipper compresses.
+// An entry ending with "/" matches every subtype, e.g. "text/" matches "text/html".
+// Other responses, e.g. already compressed images, are sent as is.
+var CompressibleTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/",
+}
+
+// encoder is a compressing writer that can be reused for another response.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// encoderPools hold encoders for reuse, one pool per encoding.
+// This reduces the overhead of creating new encoders for each response.
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() interface{} {
 		return gzip.NewWriter(nil)
-	},
+	}},
+	EncodingDeflate: {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+	EncodingZstd: {New: func() interface{} {
+		zw, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return zw
+	}},
 }
 
-// compressWriter is a wrapper around http.ResponseWriter that compresses the response with gzip.
+// compressWriter is a wrapper around http.ResponseWriter that compresses the response.
+// The body is buffered until it reaches the minimum size, so the decision to compress
+// can take the status, the content type and the size of the response into account.
 type compressWriter struct {
-	w  http.ResponseWriter // original response writer
-	zw *gzip.Writer        // gzip writer for compression
+	w        http.ResponseWriter // original response writer
+	enc      encoder             // encoder of the compressed response, nil if sent as is
+	encoding string              // negotiated content coding
+	buf      []byte              // body written before the decision
+	minSize  int                 // minimum body size to compress
+	status   int                 // HTTP status code to write
+	decided  bool                // whether the header has been written
 }
 
-// newCompressWriter creates a new compressWriter that wraps the given http.ResponseWriter.
-// It gets a gzip.Writer from the pool and resets it to write to the response writer.
-func newCompressWriter(w http.ResponseWriter) *compressWriter {
-	zw := gzipWriterPool.Get().(*gzip.Writer)
-	zw.Reset(w)
+// newCompressWriter creates a new compressWriter that wraps the given http.ResponseWriter
+// and compresses responses of at least minSize bytes with the given encoding.
+func newCompressWriter(w http.ResponseWriter, encoding string, minSize int) *compressWriter {
 	return &compressWriter{
-		w:  w,
-		zw: zw,
+		w:        w,
+		encoding: encoding,
+		minSize:  minSize,
 	}
 }
 
@@ -40,92 +87,278 @@ func (c *compressWriter) Header() http.Header {
 }
 
 // Write implements the http.ResponseWriter interface.
-// It writes the compressed data to the gzip writer.
+// It buffers the data until the minimum size is reached, then writes it through the encoder
+// or directly to the wrapped response writer.
 func (c *compressWriter) Write(p []byte) (int, error) {
-	return c.zw.Write(p)
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		c.buf = append(c.buf, p...)
+		if len(c.buf) < c.minSize {
+			return len(p), nil
+		}
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+	return c.w.Write(p)
 }
 
 // WriteHeader implements the http.ResponseWriter interface.
-// It sets the Content-Encoding header to gzip for successful responses
-// and writes the status code to the wrapped response writer.
+// It stores the status code; responses that are never compressed, such as errors,
+// are written through immediately.
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < 300 {
-		c.w.Header().Set("Content-Encoding", "gzip")
+	if c.status != 0 {
+		return
+	}
+	c.status = statusCode
+	if !c.compressible(false) {
+		c.decide(false)
+	}
+}
+
+// compressible reports whether the response may be compressed.
+// The body size and the sniffed content type are only checked once the body is buffered.
+func (c *compressWriter) compressible(buffered bool) bool {
+	if c.status < 200 || c.status >= 300 || c.status == http.StatusNoContent || c.status == http.StatusPartialContent {
+		return false
 	}
-	c.w.WriteHeader(statusCode)
+	if c.w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := c.w.Header().Get("Content-Type")
+	if contentType == "" {
+		if !buffered {
+			return true
+		}
+		contentType = http.DetectContentType(c.buf)
+	}
+	if !compressibleType(contentType) {
+		return false
+	}
+	return !buffered || len(c.buf) > 0 && len(c.buf) >= c.minSize
+}
+
+// decide writes the header, compressing the response if allowed, and flushes the buffered body.
+func (c *compressWriter) decide(buffered bool) error {
+	c.decided = true
+
+	if c.compressible(buffered) {
+		h := c.w.Header()
+		if h.Get("Content-Type") == "" {
+			// Sniff the type of the plain body, the compressed one would be detected as binary.
+			h.Set("Content-Type", http.DetectContentType(c.buf))
+		}
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+
+		c.enc = encoderPools[c.encoding].Get().(encoder)
+		c.enc.Reset(c.w)
+	}
+	c.w.WriteHeader(c.status)
+
+	if len(c.buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(c.buf)
+	} else {
+		_, err = c.w.Write(c.buf)
+	}
+	c.buf = nil
+	return err
 }
 
-// Close closes the gzip writer and returns it to the pool.
+// Close flushes the response and returns the encoder to the pool.
 // This should be called when the response is complete.
 func (c *compressWriter) Close() error {
-	defer gzipWriterPool.Put(c.zw)
-	return c.zw.Close()
+	if !c.decided {
+		if c.status == 0 {
+			// Nothing has been written, leave the default response to the server.
+			return nil
+		}
+		if err := c.decide(true); err != nil {
+			return err
+		}
+	}
+	if c.enc == nil {
+		return nil
+	}
+	defer encoderPools[c.encoding].Put(c.enc)
+	return c.enc.Close()
+}
+
+// compressibleType reports whether the content type is on the CompressibleTypes allow-list.
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range CompressibleTypes {
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed) || mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the supported encoding with the highest weight in the Accept-Encoding header.
+// Encodings with q=0 are refused; "*" stands for every encoding not listed explicitly.
+// It returns an empty string if the response must not be compressed.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		if coding == "*" {
+			wildcard = q
+		} else {
+			weights[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supportedEncodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
 }
 
-// compressReader is a wrapper around io.ReadCloser that decompresses gzip-encoded data.
-type compressReader struct {
+// decompressReader is a wrapper around io.ReadCloser that decompresses the request body.
+type decompressReader struct {
 	r  io.ReadCloser // original reader
-	zr *gzip.Reader  // gzip reader for decompression
+	zr io.Reader     // decoder of the content coding
 }
 
-// newCompressReader creates a new compressReader that wraps the given io.ReadCloser.
-// It creates a new gzip.Reader to decompress the data from the original reader.
-// Returns an error if the gzip reader cannot be created (e.g., if the data is not valid gzip).
-func newCompressReader(r io.ReadCloser) (*compressReader, error) {
-	zr, err := gzip.NewReader(r)
+// newDecompressReader creates a new decompressReader that decodes the given content coding.
+// Returns an error if the coding is not supported or the data is not valid in it.
+func newDecompressReader(r io.ReadCloser, encoding string) (*decompressReader, error) {
+	var zr io.Reader
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case EncodingGzip:
+		zr, err = gzip.NewReader(r)
+	case EncodingDeflate:
+		zr, err = zlib.NewReader(r)
+	case EncodingZstd:
+		var zd *zstd.Decoder
+		zd, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err == nil {
+			zr = zd.IOReadCloser()
+		}
+	default:
+		return nil, errUnsupportedEncoding
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &compressReader{
+	return &decompressReader{
 		r:  r,
 		zr: zr,
 	}, nil
 }
 
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
 // Read implements the io.Reader interface.
-// It reads decompressed data from the gzip reader.
-func (c compressReader) Read(p []byte) (n int, err error) {
-	return c.zr.Read(p)
+// It reads decompressed data from the decoder.
+func (d *decompressReader) Read(p []byte) (n int, err error) {
+	return d.zr.Read(p)
 }
 
 // Close implements the io.Closer interface.
-// It closes both the original reader and the gzip reader.
+// It closes both the original reader and the decoder.
 // If closing the original reader fails, the error is returned immediately.
-func (c *compressReader) Close() error {
-	if err := c.r.Close(); err != nil {
+func (d *decompressReader) Close() error {
+	if err := d.r.Close(); err != nil {
 		return err
 	}
-	return c.zr.Close()
+	if closer, ok := d.zr.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// BodyTooLarge reports whether the error was caused by reading a request body
+// beyond the limit of its route, set by BodyLimiter. The limit applies to the body as received
+// and to the body decompressed by GZipper, so handlers and middlewares reading the body,
+// such as Hasher, use it to answer with 413 Request Entity Too Large.
+func BodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
 }
 
-// GZipper is a middleware that handles gzip compression and decompression.
-// It compresses responses if the client accepts gzip encoding (via the Accept-Encoding header).
-// It also decompresses request bodies if they are gzip-encoded (via the Content-Encoding header).
-// This middleware helps reduce bandwidth usage for compatible clients.
+// GZipper is a middleware that handles compression and decompression with gzip, deflate and zstd.
+//
+// Responses are compressed with the encoding the client prefers by the q-values of the
+// Accept-Encoding header, but only successful responses of a type on the CompressibleTypes
+// allow-list that are at least the configured minimum size; all other responses are sent as is.
+// Every response carries "Vary: Accept-Encoding", so caches keep the variants apart.
+//
+// Request bodies are decompressed according to the Content-Encoding header; unsupported or
+// invalid encodings are rejected with 400 Bad Request. If BodyLimiter set a limit on the route,
+// reading the decompressed request body beyond it fails with an error recognized by
+// BodyTooLarge, so compressed bodies cannot expand without bounds.
+//
+// GZipper must wrap Hasher, so signatures are verified and computed over the uncompressed
+// request and response bodies, regardless of the encoding negotiated with the client.
 func GZipper(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ow := w
+		w.Header().Add("Vary", "Accept-Encoding")
 
-		acceptEncoding := r.Header.Get("Accept-Encoding")
-		responseWithGzip := strings.Contains(acceptEncoding, "gzip")
-		if responseWithGzip {
-			w.Header().Set("Content-Encoding", "gzip")
-			cw := newCompressWriter(w)
+		ow := w
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding != "" && r.Method != http.MethodHead {
+			cw := newCompressWriter(w, encoding, settings.CONF.CompressMinSize)
 			ow = cw
 			defer cw.Close()
 		}
 
 		contentEncoding := r.Header.Get("Content-Encoding")
-		readGzipRequest := strings.Contains(contentEncoding, "gzip")
-		if readGzipRequest {
-			cr, err := newCompressReader(r.Body)
+		if contentEncoding != "" && !strings.EqualFold(contentEncoding, "identity") {
+			dr, err := newDecompressReader(r.Body, contentEncoding)
 			if err != nil {
-				http.Error(w, "compressing error", http.StatusInternalServerError)
+				http.Error(w, "unable to decompress request body", http.StatusBadRequest)
 				return
 			}
-			r.Body = cr
-			defer cr.Close()
+			r.Body = dr
+			defer dr.Close()
+
+			if limit := bodyLimit(r); limit > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
 		}
 
 		h.ServeHTTP(ow, r)
@@ -1,15 +1,29 @@
 package middlewares
 
 import (
+	"bytes"
 	"compress/gzip"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rshafikov/alertme/internal/server/settings"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 )
 
 func TestGZipper(t *testing.T) {
+	originalMinSize := settings.CONF.CompressMinSize
+	defer func() {
+		settings.CONF.CompressMinSize = originalMinSize
+	}()
+	settings.CONF.CompressMinSize = 0
+
 	// Create a test handler that writes some data
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("test data"))
@@ -114,4 +128,252 @@ func TestGZipperCompressedRequest(t *testing.T) {
 	if rr.Body.String() != "test data" {
 		t.Errorf("Expected response body to be 'test data', got '%s'", rr.Body.String())
 	}
-}
\ No newline at end of file
+}
+
+func TestGZipperMaxBodySize(t *testing.T) {
+	handler := BodyLimiter(1024)(GZipper(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if BodyTooLarge(err) {
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name         string
+		size         int
+		expectedCode int
+	}{
+		{name: "body within limit", size: 1024, expectedCode: http.StatusOK},
+		{name: "body expanding over limit", size: 1 << 20, expectedCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gzWriter := gzip.NewWriter(&buf)
+			gzWriter.Write(make([]byte, test.size))
+			gzWriter.Close()
+
+			req := httptest.NewRequest("POST", "/", &buf)
+			req.Header.Set("Content-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "", expected: ""},
+		{acceptEncoding: "gzip", expected: EncodingGzip},
+		{acceptEncoding: "deflate", expected: EncodingDeflate},
+		{acceptEncoding: "gzip, deflate, zstd", expected: EncodingZstd},
+		{acceptEncoding: "zstd;q=0.5, gzip;q=0.8", expected: EncodingGzip},
+		{acceptEncoding: "GZIP; Q=0.2, deflate;q=0.9", expected: EncodingDeflate},
+		{acceptEncoding: "gzip;q=0", expected: ""},
+		{acceptEncoding: "br", expected: ""},
+		{acceptEncoding: "*", expected: EncodingZstd},
+		{acceptEncoding: "zstd;q=0, *;q=0.5", expected: EncodingGzip},
+		{acceptEncoding: "gzip;q=0, *;q=0", expected: ""},
+		{acceptEncoding: "identity", expected: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.acceptEncoding, func(t *testing.T) {
+			if got := negotiateEncoding(test.acceptEncoding); got != test.expected {
+				t.Errorf("Expected encoding '%s', got '%s'", test.expected, got)
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+
+	var r io.Reader
+	var err error
+	switch encoding {
+	case EncodingGzip:
+		r, err = gzip.NewReader(body)
+	case EncodingDeflate:
+		r, err = zlib.NewReader(body)
+	case EncodingZstd:
+		r, err = zstd.NewReader(body)
+	default:
+		r = body
+	}
+	if err != nil {
+		t.Fatalf("Failed to create %s reader: %v", encoding, err)
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read %s data: %v", encoding, err)
+	}
+	return string(decoded)
+}
+
+func TestGZipperResponses(t *testing.T) {
+	originalMinSize := settings.CONF.CompressMinSize
+	defer func() {
+		settings.CONF.CompressMinSize = originalMinSize
+	}()
+	settings.CONF.CompressMinSize = 64
+
+	large := strings.Repeat(`{"id": "m", "type": "gauge", "value": 1}`, 10)
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		body             string
+		status           int
+		expectedEncoding string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", contentType: "application/json", body: large, status: http.StatusOK, expectedEncoding: EncodingGzip},
+		{name: "deflate", acceptEncoding: "deflate", contentType: "application/json", body: large, status: http.StatusOK, expectedEncoding: EncodingDeflate},
+		{name: "zstd preferred", acceptEncoding: "gzip;q=0.5, zstd", contentType: "application/json", body: large, status: http.StatusOK, expectedEncoding: EncodingZstd},
+		{name: "sniffed content type", acceptEncoding: "gzip", body: large, status: http.StatusOK, expectedEncoding: EncodingGzip},
+		{name: "below minimum size", acceptEncoding: "gzip", contentType: "application/json", body: `{}`, status: http.StatusOK},
+		{name: "not on allow-list", acceptEncoding: "gzip", contentType: "image/png", body: large, status: http.StatusOK},
+		{name: "error response", acceptEncoding: "gzip", contentType: "text/plain", body: large, status: http.StatusBadRequest},
+		{name: "not accepted", acceptEncoding: "gzip;q=0", contentType: "application/json", body: large, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := GZipper(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentType != "" {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				w.WriteHeader(test.status)
+				// Write in small chunks, so the body crosses the minimum size while buffered.
+				for chunk := range slices.Chunk([]byte(test.body), 16) {
+					w.Write(chunk)
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("Expected status code %d, got %d", test.status, rr.Code)
+			}
+			if rr.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Expected Vary to be 'Accept-Encoding', got '%s'", rr.Header().Get("Vary"))
+			}
+			encoding := rr.Header().Get("Content-Encoding")
+			if encoding != test.expectedEncoding {
+				t.Errorf("Expected Content-Encoding to be '%s', got '%s'", test.expectedEncoding, encoding)
+			}
+			if test.contentType == "" && !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+				t.Errorf("Expected sniffed Content-Type to be 'text/plain', got '%s'", rr.Header().Get("Content-Type"))
+			}
+			if body := decodeBody(t, encoding, rr.Body); body != test.body {
+				t.Errorf("Expected body to be '%s', got '%s'", test.body, body)
+			}
+		})
+	}
+}
+
+func TestGZipperRequestEncodings(t *testing.T) {
+	handler := GZipper(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	}))
+
+	tests := []struct {
+		name         string
+		encoding     string
+		encode       func(w io.Writer) io.WriteCloser
+		expectedCode int
+	}{
+		{name: "gzip", encoding: "gzip", encode: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, expectedCode: http.StatusOK},
+		{name: "deflate", encoding: "deflate", encode: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }, expectedCode: http.StatusOK},
+		{name: "zstd", encoding: "zstd", encode: func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		}, expectedCode: http.StatusOK},
+		{name: "unsupported", encoding: "br", expectedCode: http.StatusBadRequest},
+		{name: "invalid gzip", encoding: "gzip", expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if test.encode != nil {
+				zw := test.encode(&buf)
+				zw.Write([]byte("test data"))
+				zw.Close()
+			} else {
+				buf.WriteString("test data")
+			}
+
+			req := httptest.NewRequest("POST", "/", &buf)
+			req.Header.Set("Content-Encoding", test.encoding)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+			if test.expectedCode == http.StatusOK && rr.Body.String() != "test data" {
+				t.Errorf("Expected response body to be 'test data', got '%s'", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGZipperHasher(t *testing.T) {
+	originalKey := settings.CONF.Key
+	originalMinSize := settings.CONF.CompressMinSize
+	defer func() {
+		settings.CONF.Key = originalKey
+		settings.CONF.CompressMinSize = originalMinSize
+	}()
+	settings.CONF.Key = "test-key"
+	settings.CONF.CompressMinSize = 0
+
+	body := `{"id": "m", "type": "gauge", "value": 1}`
+	handler := GZipper(Hasher(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})))
+
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate, EncodingZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Header().Get("Content-Encoding") != encoding {
+				t.Fatalf("Expected Content-Encoding to be '%s', got '%s'", encoding, rr.Header().Get("Content-Encoding"))
+			}
+			mac := hmac.New(sha256.New, []byte(settings.CONF.Key))
+			mac.Write([]byte(body))
+			expectedHash := hex.EncodeToString(mac.Sum(nil))
+			if rr.Header().Get("HashSHA256") != expectedHash {
+				t.Errorf("Expected hash of the uncompressed body '%s', got '%s'", expectedHash, rr.Header().Get("HashSHA256"))
+			}
+			if decoded := decodeBody(t, encoding, rr.Body); decoded != body {
+				t.Errorf("Expected body to be '%s', got '%s'", body, decoded)
+			}
+		})
+	}
+}
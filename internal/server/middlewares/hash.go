@@ -3,15 +3,23 @@ package middlewares
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"github.com/rshafikov/alertme/internal/server/keys"
 	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/replay"
 	"github.com/rshafikov/alertme/internal/server/settings"
+	"github.com/rshafikov/alertme/internal/signature"
 	"go.uber.org/zap"
 	"hash"
 	"io"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 // hashWriter is a wrapper around http.ResponseWriter that buffers the response
@@ -24,12 +32,13 @@ type hashWriter struct {
 	written bool                // whether any data has been written
 }
 
-// newHashWriter creates a new hashWriter that wraps the given http.ResponseWriter.
-func newHashWriter(w http.ResponseWriter) *hashWriter {
+// newHashWriter creates a new hashWriter that wraps the given http.ResponseWriter
+// and signs the response with the given key.
+func newHashWriter(w http.ResponseWriter, key string) *hashWriter {
 	return &hashWriter{
 		w:      w,
 		buffer: &bytes.Buffer{},
-		hasher: hmac.New(sha256.New, []byte(settings.CONF.Key)),
+		hasher: hmac.New(sha256.New, []byte(key)),
 		status: 0,
 	}
 }
@@ -75,51 +84,262 @@ func (h *hashWriter) flush() {
 	h.w.Write(h.buffer.Bytes())
 }
 
+// Headers of signed requests, see the signature package.
+const (
+	KeyIDHeader     = signature.KeyIDHeader
+	TimestampHeader = signature.TimestampHeader
+	NonceHeader     = signature.NonceHeader
+)
+
+// Reasons a request is rejected by the signature checks, reported to the RejectionRecorder.
+const (
+	// RejectMissing is reported for mutating requests without a signature while a key is configured.
+	RejectMissing = "Missing"
+	// RejectMalformed is reported for signatures, timestamps or nonces that cannot be parsed.
+	RejectMalformed = "Malformed"
+	// RejectInvalid is reported for signatures that do not match the request.
+	RejectInvalid = "Invalid"
+	// RejectUnknownKey is reported for unknown or revoked key IDs.
+	RejectUnknownKey = "UnknownKey"
+	// RejectReplayed is reported for stale or replayed requests.
+	RejectReplayed = "Replayed"
+	// RejectLegacy is reported for requests signed over the body only, without a timestamp and a nonce,
+	// as by agents older than replay protection. They are only rejected if nonces are required.
+	RejectLegacy = "Legacy"
+)
+
+// RejectionRecorder is notified of every request rejected by the signature checks.
+type RejectionRecorder func(ctx context.Context, reason string)
+
+// RejectionCounter counts the requests rejected by the signature checks by reason, in memory.
+// It is safe for concurrent use.
+type RejectionCounter struct {
+	counts map[string]*atomic.Int64
+}
+
+// NewRejectionCounter creates a new RejectionCounter for all rejection reasons.
+func NewRejectionCounter() *RejectionCounter {
+	c := &RejectionCounter{counts: make(map[string]*atomic.Int64)}
+	for _, reason := range []string{RejectMissing, RejectMalformed, RejectInvalid, RejectUnknownKey, RejectReplayed, RejectLegacy} {
+		c.counts[reason] = &atomic.Int64{}
+	}
+	return c
+}
+
+// Record counts a request rejected for the reason. It can be used as a RejectionRecorder.
+func (c *RejectionCounter) Record(_ context.Context, reason string) {
+	if count, ok := c.counts[reason]; ok {
+		count.Add(1)
+	}
+}
+
+// Counts returns the number of rejected requests by reason.
+func (c *RejectionCounter) Counts() map[string]int64 {
+	counts := make(map[string]int64, len(c.counts))
+	for reason, count := range c.counts {
+		counts[reason] = count.Load()
+	}
+	return counts
+}
+
+// HasherConfig configures the Hasher and RequireSignature middlewares.
+type HasherConfig struct {
+	// Keys resolves per-agent keys by the "KeyID" header. If nil, only the shared key is accepted.
+	Keys keys.Registry
+	// Nonces rejects stale and replayed requests. If nil, replay protection is disabled.
+	Nonces *replay.NonceCache
+	// RequireNonce rejects requests signed over the body only, without a timestamp and a nonce,
+	// which could be replayed. Otherwise they are accepted but reported as RejectLegacy.
+	RequireNonce bool
+	// Rejections, if set, is notified of rejected requests. Unsigned requests that strict mode
+	// would reject are reported even when it is disabled.
+	Rejections RejectionRecorder
+	// Strict makes RequireSignature reject unsigned requests and Hasher answer
+	// signatures that do not match with 401 Unauthorized instead of 400 Bad Request.
+	Strict bool
+}
+
+func (cfg HasherConfig) reject(w http.ResponseWriter, r *http.Request, reason, msg string, code int) {
+	if cfg.Rejections != nil {
+		cfg.Rejections(r.Context(), reason)
+	}
+	http.Error(w, msg, code)
+}
+
+// signedKey is the context key telling whether the request carried a valid signature.
+// It is only set if a key is configured for the request, or a key registry is configured.
+type signedKey struct{}
+
 // Hasher is a middleware that verifies and generates HMAC SHA-256 hashes for request and response bodies.
 // It checks the "HashSHA256" header of incoming requests against a computed hash of the request body.
 // It also adds a "HashSHA256" header to responses containing the hash of the response body.
 // If the configured key is empty, the middleware is effectively disabled.
 // If the hash verification fails, it returns a 400 Bad Request error.
 func Hasher(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		if settings.CONF.Key == "" {
-			next.ServeHTTP(w, r)
-			return
-		}
+	return NewHasher(HasherConfig{})(next)
+}
+
+// NewHasher returns the Hasher middleware that also accepts per-agent keys from the registry.
+// Requests with the "KeyID" header are verified with the key of that ID and their responses are signed with it;
+// requests without it use the configured shared key. If the key is unknown or revoked,
+// it returns a 401 Unauthorized error.
+//
+// Requests with the "Timestamp" and "Nonce" headers are signed together with them, see signature.Material,
+// and are rejected with a 401 Unauthorized error if they are stale or replayed according to the nonce cache.
+// Requests signed over the body only are reported as RejectLegacy and accepted, unless the body starts
+// with signature.Version; if nonces are required, they are rejected with 401 Unauthorized instead.
+//
+// Malformed signatures are rejected with a 400 Bad Request error, signatures that do not match
+// with 400 Bad Request, or 401 Unauthorized in strict mode. Unsigned requests are let through,
+// use RequireSignature on routes that must be signed.
+func NewHasher(cfg HasherConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := settings.CONF.Key
+			if keyID := r.Header.Get(KeyIDHeader); keyID != "" {
+				secret, err := lookupSecret(r.Context(), cfg.Keys, keyID)
+				if err != nil {
+					logger.Log.Debug("unable to resolve key", zap.String("key_id", keyID), zap.Error(err))
+					if errors.Is(err, keys.ErrUnknownKey) || errors.Is(err, keys.ErrRevokedKey) {
+						cfg.reject(w, r, RejectUnknownKey, err.Error(), http.StatusUnauthorized)
+						return
+					}
+					http.Error(w, "unable to resolve key", http.StatusInternalServerError)
+					return
+				}
+				key = secret
+			}
 
-		if receivedHashStr := r.Header.Get("HashSHA256"); receivedHashStr != "" {
-			receivedHash, err := hex.DecodeString(receivedHashStr)
-			if err != nil {
-				logger.Log.Debug("invalid or missing hash", zap.Error(err))
-				http.Error(w, "invalid Hash", http.StatusBadRequest)
+			if key == "" {
+				// With a key registry, a key applies to every request: one without a key ID is unsigned.
+				if cfg.Keys != nil {
+					r = r.WithContext(context.WithValue(r.Context(), signedKey{}, false))
+				}
+				next.ServeHTTP(w, r)
 				return
 			}
-			body, err := io.ReadAll(r.Body)
-			if err != nil {
-				http.Error(w, "failed to read body", http.StatusInternalServerError)
+
+			receivedHashStr := r.Header.Get("HashSHA256")
+			if receivedHashStr != "" {
+				receivedHash, err := hex.DecodeString(receivedHashStr)
+				if err != nil {
+					logger.Log.Debug("invalid or missing hash", zap.Error(err))
+					cfg.reject(w, r, RejectMalformed, "invalid Hash", http.StatusBadRequest)
+					return
+				}
+				body, err := io.ReadAll(r.Body)
+				if BodyTooLarge(err) {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				if err != nil {
+					http.Error(w, "failed to read body", http.StatusInternalServerError)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				timestamp, nonce := r.Header.Get(TimestampHeader), r.Header.Get(NonceHeader)
+				signed := timestamp != "" || nonce != ""
+				if !signed && cfg.RequireNonce {
+					logger.Log.Debug("missing timestamp and nonce")
+					cfg.reject(w, r, RejectLegacy, "timestamp and nonce required", http.StatusUnauthorized)
+					return
+				}
+				if !signed && bytes.HasPrefix(body, []byte(signature.Version)) {
+					logger.Log.Debug("body signed as signed material")
+					cfg.reject(w, r, RejectMalformed, "invalid body", http.StatusBadRequest)
+					return
+				}
+				var signedAt time.Time
+				if signed {
+					signedAt, err = parseTimestamp(timestamp)
+					if err != nil || nonce == "" {
+						logger.Log.Debug("invalid timestamp or nonce", zap.String("timestamp", timestamp), zap.Error(err))
+						cfg.reject(w, r, RejectMalformed, "invalid timestamp or nonce", http.StatusBadRequest)
+						return
+					}
+					body = signature.Material(timestamp, nonce, body)
+				}
+
+				expectedReqHash := hashData(key, body)
+				if !hmac.Equal(receivedHash, expectedReqHash) {
+					logger.Log.Debug("hash mismatch")
+					code := http.StatusBadRequest
+					if cfg.Strict {
+						code = http.StatusUnauthorized
+					}
+					cfg.reject(w, r, RejectInvalid, "hash mismatch", code)
+					return
+				}
+
+				if signed && cfg.Nonces != nil {
+					if err = cfg.Nonces.Check(signedAt, nonce); err != nil {
+						logger.Log.Debug("replay check failed", zap.String("nonce", nonce), zap.Error(err))
+						cfg.reject(w, r, RejectReplayed, err.Error(), http.StatusUnauthorized)
+						return
+					}
+				}
+				if !signed && cfg.Rejections != nil {
+					cfg.Rejections(r.Context(), RejectLegacy)
+				}
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), signedKey{}, receivedHashStr != ""))
+			hw := newHashWriter(w, key)
+			next.ServeHTTP(hw, r)
+			hw.flush()
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireSignature returns a middleware for mutating routes, which must run after Hasher.
+// If a key is configured for the request but it carries no signature, the request is reported
+// to the RejectionRecorder and, in strict mode, rejected with a 401 Unauthorized error.
+// With a key registry, requests without a key ID and no shared key are unsigned as well.
+func RequireSignature(cfg HasherConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			signed, keyConfigured := r.Context().Value(signedKey{}).(bool)
+			if !keyConfigured || signed {
+				next.ServeHTTP(w, r)
 				return
 			}
-			r.Body = io.NopCloser(bytes.NewReader(body))
 
-			expectedReqHash := hashData(body)
-			if !hmac.Equal(receivedHash, expectedReqHash) {
-				logger.Log.Debug("hash mismatch")
-				http.Error(w, "hash mismatch", http.StatusBadRequest)
+			logger.Log.Debug("unsigned request", zap.String("path", r.URL.Path), zap.Bool("strict", cfg.Strict))
+			if !cfg.Strict {
+				if cfg.Rejections != nil {
+					cfg.Rejections(r.Context(), RejectMissing)
+				}
+				next.ServeHTTP(w, r)
 				return
 			}
+			cfg.reject(w, r, RejectMissing, "signature required", http.StatusUnauthorized)
 		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
 
-		hw := newHashWriter(w)
-		next.ServeHTTP(hw, r)
-		hw.flush()
+// lookupSecret returns the secret of the active key with the given ID from the registry.
+func lookupSecret(ctx context.Context, registry keys.Registry, keyID string) (string, error) {
+	if registry == nil {
+		return "", keys.ErrUnknownKey
 	}
-	return http.HandlerFunc(fn)
+	return keys.Secret(ctx, registry, keyID)
 }
 
-// hashData calculates the HMAC SHA-256 hash of the given data using the configured key.
+// hashData calculates the HMAC SHA-256 hash of the given data using the given key.
 // It returns the raw hash bytes (not hex-encoded).
-func hashData(data []byte) []byte {
-	h := hmac.New(sha256.New, []byte(settings.CONF.Key))
+func hashData(key string, data []byte) []byte {
+	h := hmac.New(sha256.New, []byte(key))
 	h.Write(data)
 	return h.Sum(nil)
 }
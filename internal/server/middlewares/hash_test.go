@@ -2,13 +2,21 @@ package middlewares
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"github.com/rshafikov/alertme/internal/server/keys"
+	"github.com/rshafikov/alertme/internal/server/replay"
 	"github.com/rshafikov/alertme/internal/server/settings"
+	"github.com/rshafikov/alertme/internal/signature"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestHasher(t *testing.T) {
@@ -45,7 +53,7 @@ func TestHasher(t *testing.T) {
 	}
 
 	// Verify the hash
-	expectedHash := hashData([]byte("test data"))
+	expectedHash := hashData(settings.CONF.Key, []byte("test data"))
 	expectedHashStr := hex.EncodeToString(expectedHash)
 	if hashHeader != expectedHashStr {
 		t.Errorf("Expected hash to be %s, got %s", expectedHashStr, hashHeader)
@@ -158,4 +166,291 @@ func TestHasherWithoutKey(t *testing.T) {
 	if hashHeader != "" {
 		t.Errorf("Expected HashSHA256 header to be empty, got %s", hashHeader)
 	}
-}
\ No newline at end of file
+}
+
+func TestHasherWithKeyRegistry(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = "sharedkey"
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"id": "agent-1", "key": "agentkey"}, {"id": "agent-0", "key": "oldkey", "revoked": true}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write key registry: %v", err)
+	}
+	registry, err := keys.NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to load key registry: %v", err)
+	}
+
+	handler := NewHasher(HasherConfig{Keys: registry})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response"))
+	}))
+
+	body := []byte("test data")
+	tests := []struct {
+		name         string
+		keyID        string
+		signKey      string
+		expectedCode int
+	}{
+		{name: "agent key", keyID: "agent-1", signKey: "agentkey", expectedCode: http.StatusOK},
+		{name: "shared key without key ID", signKey: "sharedkey", expectedCode: http.StatusOK},
+		{name: "shared key with agent key ID", keyID: "agent-1", signKey: "sharedkey", expectedCode: http.StatusBadRequest},
+		{name: "revoked key", keyID: "agent-0", signKey: "oldkey", expectedCode: http.StatusUnauthorized},
+		{name: "unknown key", keyID: "agent-2", signKey: "agentkey", expectedCode: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			req.Header.Set("HashSHA256", hex.EncodeToString(hashData(test.signKey, body)))
+			if test.keyID != "" {
+				req.Header.Set(KeyIDHeader, test.keyID)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Fatalf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+			if test.expectedCode != http.StatusOK {
+				return
+			}
+			expectedHash := hex.EncodeToString(hashData(test.signKey, []byte("response")))
+			if got := rr.Header().Get("HashSHA256"); got != expectedHash {
+				t.Errorf("Expected response to be signed with the request key, got hash %s", got)
+			}
+		})
+	}
+}
+
+func TestHasherReplayProtection(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = "testkey"
+
+	nonces := replay.NewNonceCache(time.Minute, 100)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewHasher(HasherConfig{Nonces: nonces})(ok)
+	requireNonce := NewHasher(HasherConfig{Nonces: nonces, RequireNonce: true})(ok)
+
+	body := []byte("test data")
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name         string
+		timestamp    string
+		nonce        string
+		hash         []byte
+		requireNonce bool
+		expectedCode int
+	}{
+		{
+			name:         "signed request",
+			timestamp:    now,
+			nonce:        "nonce-1",
+			hash:         hashData("testkey", signature.Material(now, "nonce-1", body)),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "replayed request",
+			timestamp:    now,
+			nonce:        "nonce-1",
+			hash:         hashData("testkey", signature.Material(now, "nonce-1", body)),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "stale request",
+			timestamp:    stale,
+			nonce:        "nonce-2",
+			hash:         hashData("testkey", signature.Material(stale, "nonce-2", body)),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "timestamp not covered by hash",
+			timestamp:    now,
+			nonce:        "nonce-3",
+			hash:         hashData("testkey", body),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "missing nonce",
+			timestamp:    now,
+			hash:         hashData("testkey", signature.Material(now, "", body)),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid timestamp",
+			timestamp:    "yesterday",
+			nonce:        "nonce-4",
+			hash:         hashData("testkey", signature.Material("yesterday", "nonce-4", body)),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "request without timestamp and nonce",
+			hash:         hashData("testkey", body),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "request without timestamp and nonce when required",
+			hash:         hashData("testkey", body),
+			requireNonce: true,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "signed request when nonce required",
+			timestamp:    now,
+			nonce:        "nonce-5",
+			hash:         hashData("testkey", signature.Material(now, "nonce-5", body)),
+			requireNonce: true,
+			expectedCode: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			req.Header.Set("HashSHA256", hex.EncodeToString(test.hash))
+			if test.timestamp != "" {
+				req.Header.Set(TimestampHeader, test.timestamp)
+			}
+			if test.nonce != "" {
+				req.Header.Set(NonceHeader, test.nonce)
+			}
+			rr := httptest.NewRecorder()
+
+			if test.requireNonce {
+				requireNonce.ServeHTTP(rr, req)
+			} else {
+				handler.ServeHTTP(rr, req)
+			}
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHasherBodySignature(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = "testkey"
+
+	handler := Hasher(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	body := []byte("test data")
+	material := signature.Material(strconv.FormatInt(time.Now().Unix(), 10), "nonce-1", body)
+	tests := []struct {
+		name         string
+		body         []byte
+		expectedCode int
+	}{
+		{name: "body signature without nonce cache", body: body, expectedCode: http.StatusOK},
+		{name: "signed material sent as body", body: material, expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(test.body))
+			req.Header.Set("HashSHA256", hex.EncodeToString(hashData("testkey", test.body)))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequireSignature(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`[{"id": "agent-1", "key": "agentkey"}]`), 0o600); err != nil {
+		t.Fatalf("Failed to write key registry: %v", err)
+	}
+	registry, err := keys.NewFileRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to load key registry: %v", err)
+	}
+
+	body := []byte("test data")
+	tests := []struct {
+		registry        keys.Registry
+		name            string
+		key             string
+		keyID           string
+		strict          bool
+		hash            string
+		expectedCode    int
+		expectedReasons []string
+	}{
+		{name: "no key configured", strict: true, expectedCode: http.StatusOK},
+		{name: "body signed request", key: "testkey", strict: true, hash: hex.EncodeToString(hashData("testkey", body)), expectedCode: http.StatusOK, expectedReasons: []string{RejectLegacy}},
+		{name: "unsigned request", key: "testkey", strict: true, expectedCode: http.StatusUnauthorized, expectedReasons: []string{RejectMissing}},
+		{name: "unsigned request without strict mode", key: "testkey", expectedCode: http.StatusOK, expectedReasons: []string{RejectMissing}},
+		{name: "invalid signature", key: "testkey", strict: true, hash: hex.EncodeToString(hashData("wrongkey", body)), expectedCode: http.StatusUnauthorized, expectedReasons: []string{RejectInvalid}},
+		{name: "invalid signature without strict mode", key: "testkey", hash: hex.EncodeToString(hashData("wrongkey", body)), expectedCode: http.StatusBadRequest, expectedReasons: []string{RejectInvalid}},
+		{name: "malformed signature", key: "testkey", strict: true, hash: "zz", expectedCode: http.StatusBadRequest, expectedReasons: []string{RejectMalformed}},
+		{name: "registry key", registry: registry, keyID: "agent-1", strict: true, hash: hex.EncodeToString(hashData("agentkey", body)), expectedCode: http.StatusOK, expectedReasons: []string{RejectLegacy}},
+		{name: "registry without key ID", registry: registry, strict: true, hash: hex.EncodeToString(hashData("agentkey", body)), expectedCode: http.StatusUnauthorized, expectedReasons: []string{RejectMissing}},
+		{name: "registry key ID without signature", registry: registry, keyID: "agent-1", strict: true, expectedCode: http.StatusUnauthorized, expectedReasons: []string{RejectMissing}},
+		{name: "registry without key ID and strict mode", registry: registry, expectedCode: http.StatusOK, expectedReasons: []string{RejectMissing}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings.CONF.Key = test.key
+
+			var reasons []string
+			cfg := HasherConfig{
+				Keys:   test.registry,
+				Strict: test.strict,
+				Rejections: func(ctx context.Context, reason string) {
+					reasons = append(reasons, reason)
+				},
+			}
+			handler := NewHasher(cfg)(RequireSignature(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			if test.hash != "" {
+				req.Header.Set("HashSHA256", test.hash)
+			}
+			if test.keyID != "" {
+				req.Header.Set(KeyIDHeader, test.keyID)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+			if len(reasons) != len(test.expectedReasons) {
+				t.Fatalf("Expected rejections %v, got %v", test.expectedReasons, reasons)
+			}
+			for i := range reasons {
+				if reasons[i] != test.expectedReasons[i] {
+					t.Errorf("Expected rejections %v, got %v", test.expectedReasons, reasons)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package middlewares
 
 import (
+	"bufio"
 	"github.com/rshafikov/alertme/internal/server/logger"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -36,8 +39,25 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.respData.status = statusCode
 }
 
+// Unwrap returns the underlying ResponseWriter, so http.ResponseController
+// can reach optional interfaces such as http.Flusher.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack implements the http.Hijacker interface, so protocol upgrades such as
+// WebSocket work behind the middleware. The status is recorded as 101.
+func (r *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.respData.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
 // Logger is a middleware that logs information about HTTP requests and responses.
 // It captures the request method, URI, response status, duration, and response size.
+// The access token query parameter is masked, so tokens do not end up in the logs.
 // The log entry is written at the Info level using the application's logger.
 func Logger(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -57,7 +77,7 @@ func Logger(h http.Handler) http.Handler {
 
 		logger.Log.Info("-",
 			zap.String("method", r.Method),
-			zap.String("uri", r.RequestURI),
+			zap.String("uri", loggedURI(r.URL)),
 			zap.Int("status", rData.status),
 			zap.String("status_text", http.StatusText(rData.status)),
 			zap.String("duration", duration.String()),
@@ -65,3 +85,16 @@ func Logger(h http.Handler) http.Handler {
 		)
 	})
 }
+
+// loggedURI returns the path and query of the request URL with the access token masked.
+func loggedURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	query := u.Query()
+	if query.Has(AccessTokenParam) {
+		query.Set(AccessTokenParam, "REDACTED")
+		return u.Path + "?" + query.Encode()
+	}
+	return u.Path + "?" + u.RawQuery
+}
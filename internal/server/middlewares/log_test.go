@@ -32,4 +32,55 @@ func TestLogger(t *testing.T) {
 	if rr.Body.String() != "test data" {
 		t.Errorf("Expected response body to be 'test data', got '%s'", rr.Body.String())
 	}
-}
\ No newline at end of file
+}
+
+func TestLoggerHijack(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("Expected response writer to implement http.Hijacker")
+			return
+		}
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		rw.Flush()
+	})
+
+	ts := httptest.NewServer(Logger(handler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestLoggedURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{name: "path only", target: "/value/gauge/g", expected: "/value/gauge/g"},
+		{name: "query", target: "/query?id=g&type=gauge", expected: "/query?id=g&type=gauge"},
+		{name: "access token", target: "/stream?access_token=secret&type=gauge", expected: "/stream?access_token=REDACTED&type=gauge"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.target, nil)
+			if got := loggedURI(req.URL); got != test.expected {
+				t.Errorf("Expected URI %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
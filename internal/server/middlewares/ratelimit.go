@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+	"go.uber.org/zap"
+)
+
+// RateLimit returns a middleware that limits the rate of requests per client address.
+// Requests exceeding the limit are rejected with 429 Too Many Requests and
+// a "Retry-After" header holding the number of seconds until the next request is allowed.
+// A nil limiter disables the check.
+func RateLimit(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := clientAddress(r)
+			if ok, wait := limiter.Allow(client); !ok {
+				logger.Log.Debug("rate limit exceeded", zap.String("client", client), zap.Duration("retry_after", wait))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// clientAddress returns the host the request was received from.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	handler := RateLimit(ratelimit.NewLimiter(1, 2))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		expectedCode int
+	}{
+		{name: "first request", remoteAddr: "10.0.0.1:1234", expectedCode: http.StatusOK},
+		{name: "burst from another port", remoteAddr: "10.0.0.1:1235", expectedCode: http.StatusOK},
+		{name: "over the limit", remoteAddr: "10.0.0.1:1236", expectedCode: http.StatusTooManyRequests},
+		{name: "another client", remoteAddr: "10.0.0.2:1234", expectedCode: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+			if test.expectedCode == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "1" {
+				t.Errorf("Expected Retry-After to be '1', got '%s'", rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	handler := RateLimit(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 10; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	}
+}
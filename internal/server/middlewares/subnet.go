@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+)
+
+// RealIPHeader is the request header carrying the address of the agent.
+const RealIPHeader = "X-Real-IP"
+
+// TrustedSubnet returns a middleware that only lets through requests whose "X-Real-IP" header
+// holds an address within the trusted subnet. Other requests are rejected with 403 Forbidden.
+// A nil subnet disables the check.
+func TrustedSubnet(subnet *net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if subnet == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			realIP := r.Header.Get(RealIPHeader)
+			ip := net.ParseIP(realIP)
+			if ip == nil || !subnet.Contains(ip) {
+				logger.Log.Debug("request from untrusted address", zap.String("real_ip", realIP))
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
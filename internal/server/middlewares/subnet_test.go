@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedSubnet(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("Failed to parse subnet: %v", err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		subnet       *net.IPNet
+		realIP       string
+		expectedCode int
+	}{
+		{name: "address in subnet", subnet: subnet, realIP: "192.168.1.17", expectedCode: http.StatusOK},
+		{name: "address outside subnet", subnet: subnet, realIP: "10.0.0.1", expectedCode: http.StatusForbidden},
+		{name: "missing header", subnet: subnet, expectedCode: http.StatusForbidden},
+		{name: "invalid address", subnet: subnet, realIP: "not an ip", expectedCode: http.StatusForbidden},
+		{name: "check disabled", realIP: "10.0.0.1", expectedCode: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+			if test.realIP != "" {
+				req.Header.Set(RealIPHeader, test.realIP)
+			}
+			rr := httptest.NewRecorder()
+
+			TrustedSubnet(test.subnet)(handler).ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedCode {
+				t.Errorf("Expected status code %d, got %d", test.expectedCode, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package migrations
+
+const CreateAgentKeysTable = `
+	CREATE TABLE IF NOT EXISTS agent_keys (
+		id TEXT PRIMARY KEY,
+		secret TEXT NOT NULL,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+`
@@ -94,6 +94,21 @@ func (m *Metric) MapName() string {
 	return m.mapName
 }
 
+// Clone returns a deep copy of the metric, so the copy can be shared
+// without being affected by later changes to the original.
+func (m *Metric) Clone() *Metric {
+	clone := &Metric{Name: m.Name, Type: m.Type}
+	if m.Value != nil {
+		value := *m.Value
+		clone.Value = &value
+	}
+	if m.Delta != nil {
+		delta := *m.Delta
+		clone.Delta = &delta
+	}
+	return clone
+}
+
 // ConvertToPlain converts a strongly-typed Metric to a PlainMetric with string values.
 // This is useful for serialization or when string representation is needed.
 // The Value field of the returned PlainMetric is set using the String() method.
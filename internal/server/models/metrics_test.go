@@ -96,3 +96,20 @@ func TestConvertToMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestMetric_Clone(t *testing.T) {
+	value := 1.5
+	delta := int64(3)
+	original := &Metric{Name: "m", Type: GaugeType, Value: &value, Delta: &delta}
+
+	clone := original.Clone()
+	if !reflect.DeepEqual(original, clone) {
+		t.Errorf("Clone() = %v, want %v", clone, original)
+	}
+
+	*original.Value = 2.5
+	*original.Delta = 4
+	if *clone.Value != 1.5 || *clone.Delta != 3 {
+		t.Errorf("Clone() shares values with the original metric")
+	}
+}
@@ -0,0 +1,143 @@
+// Package pubsub provides a publish/subscribe hub that fans out metric updates
+// accepted by the server to live subscribers such as the SSE stream.
+package pubsub
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"go.uber.org/zap"
+)
+
+// DefaultBufferSize is the number of published batches buffered for each subscriber.
+const DefaultBufferSize = 256
+
+// Filter selects which metric updates are delivered to a subscriber.
+// Empty fields match any metric.
+type Filter struct {
+	// Type restricts updates to metrics of the given type.
+	Type models.MetricType
+	// Prefix restricts updates to metrics whose name starts with the given prefix.
+	Prefix string
+}
+
+// Match reports whether the metric satisfies the filter.
+func (f Filter) Match(m *models.Metric) bool {
+	if f.Type != "" && f.Type != m.Type {
+		return false
+	}
+	return strings.HasPrefix(m.Name, f.Prefix)
+}
+
+// matching returns the metrics satisfying the filter.
+func (f Filter) matching(metrics []*models.Metric) []*models.Metric {
+	matched := make([]*models.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if f.Match(m) {
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
+
+// Subscription represents a single subscriber of the hub.
+type Subscription struct {
+	hub    *Hub
+	ch     chan []*models.Metric
+	filter Filter
+}
+
+// Updates returns the channel of metric updates matching the subscription filter.
+// Metrics published together are received together, in a single non-empty batch.
+// The channel is closed when the subscription is closed or dropped by the hub
+// because the subscriber could not keep up.
+func (s *Subscription) Updates() <-chan []*models.Metric {
+	return s.ch
+}
+
+// Close unsubscribes from the hub. It is safe to call Close more than once.
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// Hub distributes published metrics to subscribers.
+// Publishing never blocks: a subscriber whose buffer of batches is full is dropped,
+// so one slow consumer cannot stall the storage write path. Since the buffer holds whole batches,
+// a subscriber is only dropped if it falls behind over several publications, however large they are.
+type Hub struct {
+	subs       map[*Subscription]struct{}
+	bufferSize int
+	mu         sync.RWMutex
+}
+
+// NewHub creates a new hub with the given per-subscriber buffer size.
+// A non-positive size falls back to DefaultBufferSize.
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		subs:       make(map[*Subscription]struct{}),
+		bufferSize: bufferSize,
+	}
+}
+
+// Subscribe registers a new subscriber receiving updates that match the filter.
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		ch:     make(chan []*models.Metric, h.bufferSize),
+		filter: filter,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+// Publish delivers the metrics matching the filter of every subscriber to it as a single batch,
+// without blocking. Subscribers that cannot accept the batch are dropped.
+func (h *Hub) Publish(metrics ...*models.Metric) {
+	var slow []*Subscription
+
+	h.mu.RLock()
+	for s := range h.subs {
+		batch := s.filter.matching(metrics)
+		if len(batch) == 0 {
+			continue
+		}
+		select {
+		case s.ch <- batch:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, s := range slow {
+		logger.Log.Warn("dropping slow subscriber", zap.Int("buffer_size", h.bufferSize))
+		h.unsubscribe(s)
+	}
+}
+
+// Len returns the number of active subscribers.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+func (h *Hub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	close(s.ch)
+}
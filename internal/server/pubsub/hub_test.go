@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(name string, value float64) *models.Metric {
+	return &models.Metric{Name: name, Type: models.GaugeType, Value: &value}
+}
+
+func counter(name string, delta int64) *models.Metric {
+	return &models.Metric{Name: name, Type: models.CounterType, Delta: &delta}
+}
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		metric *models.Metric
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, metric: gauge("Alloc", 1), want: true},
+		{name: "type match", filter: Filter{Type: models.GaugeType}, metric: gauge("Alloc", 1), want: true},
+		{name: "type mismatch", filter: Filter{Type: models.CounterType}, metric: gauge("Alloc", 1), want: false},
+		{name: "prefix match", filter: Filter{Prefix: "CPU"}, metric: gauge("CPUutilization1", 1), want: true},
+		{name: "prefix mismatch", filter: Filter{Prefix: "CPU"}, metric: gauge("Alloc", 1), want: false},
+		{name: "type and prefix", filter: Filter{Type: models.CounterType, Prefix: "Poll"}, metric: counter("PollCount", 1), want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, test.filter.Match(test.metric))
+		})
+	}
+}
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	hub := NewHub(4)
+	all := hub.Subscribe(Filter{})
+	counters := hub.Subscribe(Filter{Type: models.CounterType})
+	defer all.Close()
+	defer counters.Close()
+
+	hub.Publish(gauge("g", 1), counter("c", 2))
+
+	require.Len(t, all.Updates(), 1, "metrics published together are delivered together")
+	assert.Len(t, <-all.Updates(), 2)
+	require.Len(t, counters.Updates(), 1)
+	batch := <-counters.Updates()
+	require.Len(t, batch, 1)
+	assert.Equal(t, "c", batch[0].Name)
+
+	hub.Publish(gauge("g", 2))
+	assert.Empty(t, counters.Updates(), "batches without matching metrics are not delivered")
+}
+
+func TestHub_KeepsSubscriberOfLargeBatches(t *testing.T) {
+	hub := NewHub(2)
+	s := hub.Subscribe(Filter{})
+	defer s.Close()
+
+	batch := make([]*models.Metric, 0, 1000)
+	for i := 0; i < cap(batch); i++ {
+		batch = append(batch, counter("c", int64(i)))
+	}
+	hub.Publish(batch...)
+
+	assert.Equal(t, 1, hub.Len(), "a batch larger than the buffer does not drop the subscriber")
+	assert.Len(t, <-s.Updates(), len(batch))
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	hub := NewHub(1)
+	slow := hub.Subscribe(Filter{})
+	fast := hub.Subscribe(Filter{Prefix: "fast"})
+	defer fast.Close()
+
+	hub.Publish(gauge("g1", 1))
+	hub.Publish(gauge("g2", 2))
+
+	assert.Equal(t, 1, hub.Len())
+
+	batch, ok := <-slow.Updates()
+	require.True(t, ok)
+	assert.Equal(t, "g1", batch[0].Name)
+	_, ok = <-slow.Updates()
+	assert.False(t, ok, "slow subscriber channel must be closed")
+}
+
+func TestSubscription_Close(t *testing.T) {
+	hub := NewHub(0)
+	s := hub.Subscribe(Filter{})
+	assert.Equal(t, 1, hub.Len())
+
+	s.Close()
+	s.Close()
+	assert.Equal(t, 0, hub.Len())
+
+	hub.Publish(gauge("g", 1))
+	_, ok := <-s.Updates()
+	assert.False(t, ok)
+}
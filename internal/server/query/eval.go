@@ -0,0 +1,229 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/history"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/storage"
+)
+
+// ErrEval is returned when a parsed expression cannot be evaluated.
+var ErrEval = errors.New("evaluation error")
+
+// ResultType is the type of an evaluation result.
+type ResultType string
+
+const (
+	// VectorResult is a list of samples, one per selected metric.
+	VectorResult ResultType = "vector"
+	// ScalarResult is a single number produced by an aggregation.
+	ScalarResult ResultType = "scalar"
+)
+
+// Sample is the value of a single metric in a vector.
+type Sample struct {
+	Name  string            `json:"id"`
+	Type  models.MetricType `json:"type"`
+	Value float64           `json:"value"`
+}
+
+// Result is the outcome of an evaluation.
+// Value holds []Sample for vectors and *float64 for scalars;
+// a nil scalar means the aggregation had no input.
+type Result struct {
+	Value any        `json:"result"`
+	Type  ResultType `json:"type"`
+}
+
+// HistoryReader provides recent values of a metric, oldest first.
+type HistoryReader interface {
+	Get(metricType models.MetricType, name string) []history.Point
+}
+
+// Evaluator evaluates expressions against a metric storage.
+type Evaluator struct {
+	store   storage.BaseMetricStorage
+	history HistoryReader
+	now     func() time.Time
+}
+
+// NewEvaluator creates an evaluator over the given storage.
+// The history is used by rate and may be nil, in which case rate is unavailable.
+func NewEvaluator(store storage.BaseMetricStorage, hist HistoryReader) *Evaluator {
+	return &Evaluator{
+		store:   store,
+		history: hist,
+		now:     time.Now,
+	}
+}
+
+// Query parses and evaluates the expression.
+func (e *Evaluator) Query(ctx context.Context, input string) (*Result, error) {
+	expr, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(ctx, expr)
+}
+
+// Eval evaluates a parsed expression.
+func (e *Evaluator) Eval(ctx context.Context, expr Expr) (*Result, error) {
+	switch node := expr.(type) {
+	case *Selector:
+		if node.Range > 0 {
+			return nil, fmt.Errorf("%w: range selector %s can only be used in rate", ErrEval, node)
+		}
+		return &Result{Type: VectorResult, Value: e.selectSamples(ctx, node)}, nil
+
+	case *Call:
+		if node.Func == "rate" {
+			return e.rate(ctx, node)
+		}
+		arg, err := e.Eval(ctx, node.Arg)
+		if err != nil {
+			return nil, err
+		}
+		if arg.Type != VectorResult {
+			return nil, fmt.Errorf("%w: %s expects a vector argument", ErrEval, node.Func)
+		}
+		return &Result{Type: ScalarResult, Value: aggregate(node.Func, arg.Value.([]Sample))}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported expression %s", ErrEval, expr)
+	}
+}
+
+func (e *Evaluator) selectMetrics(ctx context.Context, sel *Selector) []*models.Metric {
+	var selected []*models.Metric
+	for _, m := range e.store.List(ctx) {
+		if matchSelector(sel, m) {
+			selected = append(selected, m)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].Name != selected[j].Name {
+			return selected[i].Name < selected[j].Name
+		}
+		return selected[i].Type < selected[j].Type
+	})
+	return selected
+}
+
+func (e *Evaluator) selectSamples(ctx context.Context, sel *Selector) []Sample {
+	samples := []Sample{}
+	for _, m := range e.selectMetrics(ctx, sel) {
+		value, ok := metricValue(m)
+		if !ok {
+			continue
+		}
+		samples = append(samples, Sample{Name: m.Name, Type: m.Type, Value: value})
+	}
+	return samples
+}
+
+// rate computes the per-second increase of each selected metric from its recent history.
+// Metrics with less than two points in the window are left out.
+func (e *Evaluator) rate(ctx context.Context, call *Call) (*Result, error) {
+	sel, ok := call.Arg.(*Selector)
+	if !ok {
+		return nil, fmt.Errorf("%w: rate expects a selector argument", ErrEval)
+	}
+	if e.history == nil {
+		return nil, fmt.Errorf("%w: rate requires metric history", ErrEval)
+	}
+
+	var since time.Time
+	if sel.Range > 0 {
+		since = e.now().Add(-sel.Range)
+	}
+
+	samples := []Sample{}
+	for _, m := range e.selectMetrics(ctx, sel) {
+		var window []history.Point
+		for _, p := range e.history.Get(m.Type, m.Name) {
+			if !p.Time.Before(since) {
+				window = append(window, p)
+			}
+		}
+		if len(window) < 2 {
+			continue
+		}
+		first, last := window[0], window[len(window)-1]
+		elapsed := last.Time.Sub(first.Time).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		samples = append(samples, Sample{Name: m.Name, Type: m.Type, Value: (last.Value - first.Value) / elapsed})
+	}
+	return &Result{Type: VectorResult, Value: samples}, nil
+}
+
+func aggregate(fn string, samples []Sample) *float64 {
+	if fn == "count" {
+		n := float64(len(samples))
+		return &n
+	}
+	if len(samples) == 0 {
+		if fn == "sum" {
+			return new(float64)
+		}
+		return nil
+	}
+
+	result := samples[0].Value
+	for _, s := range samples[1:] {
+		switch fn {
+		case "sum", "avg":
+			result += s.Value
+		case "min":
+			result = min(result, s.Value)
+		case "max":
+			result = max(result, s.Value)
+		}
+	}
+	if fn == "avg" {
+		result /= float64(len(samples))
+	}
+	return &result
+}
+
+func matchSelector(sel *Selector, m *models.Metric) bool {
+	if ok, _ := path.Match(sel.Name, m.Name); !ok {
+		return false
+	}
+	for _, matcher := range sel.Matchers {
+		if !matcher.Matches(labelValue(m, matcher.Label)) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelValue returns the value of a built-in label of the metric, one of Labels.
+func labelValue(m *models.Metric, label string) string {
+	switch label {
+	case "name":
+		return m.Name
+	case "type":
+		return string(m.Type)
+	default:
+		return ""
+	}
+}
+
+func metricValue(m *models.Metric) (float64, bool) {
+	switch {
+	case m.Type == models.GaugeType && m.Value != nil:
+		return *m.Value, true
+	case m.Type == models.CounterType && m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/history"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHistory map[string][]history.Point
+
+func (f fakeHistory) Get(metricType models.MetricType, name string) []history.Point {
+	return f[string(metricType)+"-"+name]
+}
+
+func newTestEvaluator(t *testing.T) *Evaluator {
+	t.Helper()
+
+	store := storage.NewMemStorage()
+	for _, pm := range []models.PlainMetric{
+		{Name: "CPUutilization0", Type: models.GaugeType, Value: "10"},
+		{Name: "CPUutilization1", Type: models.GaugeType, Value: "30"},
+		{Name: "HeapAlloc", Type: models.GaugeType, Value: "1024"},
+		{Name: "PollCount", Type: models.CounterType, Value: "120"},
+	} {
+		m, err := pm.ConverToMetric()
+		require.NoError(t, err)
+		require.NoError(t, store.Add(context.Background(), m))
+	}
+
+	now := time.Date(2025, 1, 1, 0, 10, 0, 0, time.UTC)
+	hist := fakeHistory{
+		"counter-PollCount": {
+			{Time: now.Add(-5 * time.Minute), Value: 0},
+			{Time: now.Add(-time.Minute), Value: 60},
+			{Time: now, Value: 120},
+		},
+	}
+	e := NewEvaluator(store, hist)
+	e.now = func() time.Time { return now }
+	return e
+}
+
+func TestEvaluator_Query(t *testing.T) {
+	e := newTestEvaluator(t)
+
+	scalar := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name  string
+		input string
+		want  *Result
+	}{
+		{
+			name:  "select by glob",
+			input: "CPUutilization*",
+			want: &Result{Type: VectorResult, Value: []Sample{
+				{Name: "CPUutilization0", Type: models.GaugeType, Value: 10},
+				{Name: "CPUutilization1", Type: models.GaugeType, Value: 30},
+			}},
+		},
+		{
+			name:  "select by type label",
+			input: `*{type="counter"}`,
+			want: &Result{Type: VectorResult, Value: []Sample{
+				{Name: "PollCount", Type: models.CounterType, Value: 120},
+			}},
+		},
+		{name: "sum", input: "sum(CPUutilization*)", want: &Result{Type: ScalarResult, Value: scalar(40)}},
+		{name: "avg", input: "avg(CPUutilization*)", want: &Result{Type: ScalarResult, Value: scalar(20)}},
+		{name: "min", input: "min(CPUutilization*)", want: &Result{Type: ScalarResult, Value: scalar(10)}},
+		{name: "max", input: `max(*{type="gauge"})`, want: &Result{Type: ScalarResult, Value: scalar(1024)}},
+		{name: "count", input: "count(*)", want: &Result{Type: ScalarResult, Value: scalar(4)}},
+		{name: "sum of nothing", input: "sum(Unknown*)", want: &Result{Type: ScalarResult, Value: scalar(0)}},
+		{name: "max of nothing", input: "max(Unknown*)", want: &Result{Type: ScalarResult, Value: (*float64)(nil)}},
+		{
+			name:  "rate over whole history",
+			input: "rate(PollCount)",
+			want: &Result{Type: VectorResult, Value: []Sample{
+				{Name: "PollCount", Type: models.CounterType, Value: 0.4},
+			}},
+		},
+		{
+			name:  "rate over window",
+			input: "rate(PollCount[2m])",
+			want: &Result{Type: VectorResult, Value: []Sample{
+				{Name: "PollCount", Type: models.CounterType, Value: 1},
+			}},
+		},
+		{name: "rate without enough points", input: "rate(HeapAlloc)", want: &Result{Type: VectorResult, Value: []Sample{}}},
+		{name: "sum of rates", input: "sum(rate(*))", want: &Result{Type: ScalarResult, Value: scalar(0.4)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := e.Query(context.Background(), test.input)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestEvaluator_QueryErrors(t *testing.T) {
+	e := newTestEvaluator(t)
+
+	for _, input := range []string{
+		"sum(sum(CPU*))",
+		"rate(sum(CPU*))",
+		"PollCount[1m]",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := e.Query(context.Background(), input)
+			assert.ErrorIs(t, err, ErrEval)
+		})
+	}
+
+	t.Run("rate without history", func(t *testing.T) {
+		_, err := NewEvaluator(storage.NewMemStorage(), nil).Query(context.Background(), "rate(PollCount)")
+		assert.ErrorIs(t, err, ErrEval)
+	})
+}
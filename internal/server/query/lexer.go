@@ -0,0 +1,166 @@
+// Package query implements a small expression language for selecting and
+// aggregating stored metrics.
+//
+// An expression is either a selector or a function call:
+//
+//	CPUutilization*                      all metrics whose name matches the glob
+//	*{type="gauge", name!~"CPU*"}        label matchers: =, !=, =~ (glob), !~
+//	sum(CPUutilization*)                 sum, avg, min, max, count reduce a vector to a scalar
+//	rate(PollCount[1m])                  per-second rate from recent history over the window
+//	max(rate(*{type="counter"}))         functions can be nested
+//
+// Every metric exposes the built-in labels "name" and "type".
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokDuration
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokComma
+	tokEq
+	tokNeq
+	tokMatch
+	tokNotMatch
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of input"
+	case tokIdent:
+		return "identifier"
+	case tokString:
+		return "string"
+	case tokDuration:
+		return "duration"
+	case tokLParen:
+		return `"("`
+	case tokRParen:
+		return `")"`
+	case tokLBrace:
+		return `"{"`
+	case tokRBrace:
+		return `"}"`
+	case tokComma:
+		return `","`
+	case tokEq:
+		return `"="`
+	case tokNeq:
+		return `"!="`
+	case tokMatch:
+		return `"=~"`
+	case tokNotMatch:
+		return `"!~"`
+	default:
+		return "unknown token"
+	}
+}
+
+type token struct {
+	text     string
+	kind     tokenKind
+	pos      int
+	duration time.Duration
+}
+
+// lex splits the input into tokens.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for pos := 0; pos < len(input); {
+		c := input[pos]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			pos++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			pos++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			pos++
+		case c == '{':
+			tokens = append(tokens, token{kind: tokLBrace, text: "{", pos: pos})
+			pos++
+		case c == '}':
+			tokens = append(tokens, token{kind: tokRBrace, text: "}", pos: pos})
+			pos++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: pos})
+			pos++
+
+		case c == '=' || c == '!':
+			op := input[pos:min(pos+2, len(input))]
+			switch {
+			case op == "=~":
+				tokens = append(tokens, token{kind: tokMatch, text: op, pos: pos})
+				pos += 2
+			case op == "!~":
+				tokens = append(tokens, token{kind: tokNotMatch, text: op, pos: pos})
+				pos += 2
+			case op == "!=":
+				tokens = append(tokens, token{kind: tokNeq, text: op, pos: pos})
+				pos += 2
+			case c == '=':
+				tokens = append(tokens, token{kind: tokEq, text: "=", pos: pos})
+				pos++
+			default:
+				return nil, syntaxError(pos, "unexpected %q", c)
+			}
+
+		case c == '"':
+			end := strings.IndexByte(input[pos+1:], '"')
+			if end < 0 {
+				return nil, syntaxError(pos, "unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokString, text: input[pos+1 : pos+1+end], pos: pos})
+			pos += end + 2
+
+		case c == '[':
+			end := strings.IndexByte(input[pos+1:], ']')
+			if end < 0 {
+				return nil, syntaxError(pos, "unterminated duration")
+			}
+			text := input[pos+1 : pos+1+end]
+			d, err := time.ParseDuration(strings.TrimSpace(text))
+			if err != nil || d <= 0 {
+				return nil, syntaxError(pos, "invalid duration %q", text)
+			}
+			tokens = append(tokens, token{kind: tokDuration, text: text, pos: pos, duration: d})
+			pos += end + 2
+
+		case isIdentChar(c):
+			start := pos
+			for pos < len(input) && isIdentChar(input[pos]) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: input[start:pos], pos: start})
+
+		default:
+			return nil, syntaxError(pos, "unexpected %q", c)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(input)}), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '*' || c == '?' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func syntaxError(pos int, format string, args ...any) error {
+	return fmt.Errorf("%w at position %d: %s", ErrSyntax, pos, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,257 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrSyntax is returned when an expression cannot be parsed.
+var ErrSyntax = errors.New("syntax error")
+
+// MatchOp is a label matching operator.
+type MatchOp string
+
+const (
+	// MatchEqual selects labels equal to the value.
+	MatchEqual MatchOp = "="
+	// MatchNotEqual selects labels not equal to the value.
+	MatchNotEqual MatchOp = "!="
+	// MatchGlob selects labels matching the glob pattern.
+	MatchGlob MatchOp = "=~"
+	// MatchNotGlob selects labels not matching the glob pattern.
+	MatchNotGlob MatchOp = "!~"
+)
+
+// Expr is a node of a parsed expression.
+type Expr interface {
+	String() string
+}
+
+// Labels lists the labels metrics can be selected by. Matchers of other labels are rejected,
+// so a misspelled label does not silently match nothing.
+var Labels = []string{"name", "type"}
+
+// Matcher selects metrics by the value of a label.
+type Matcher struct {
+	Label string
+	Op    MatchOp
+	Value string
+}
+
+// Matches reports whether the label value satisfies the matcher.
+func (m Matcher) Matches(value string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchGlob:
+		ok, _ := path.Match(m.Value, value)
+		return ok
+	case MatchNotGlob:
+		ok, _ := path.Match(m.Value, value)
+		return !ok
+	default:
+		return false
+	}
+}
+
+// String returns the matcher in expression syntax.
+func (m Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Label, m.Op, m.Value)
+}
+
+// Selector selects stored metrics by name glob and label matchers.
+// Range is set when the selector is used as a range, e.g. PollCount[1m].
+type Selector struct {
+	Name     string
+	Matchers []Matcher
+	Range    time.Duration
+}
+
+// String returns the selector in expression syntax.
+func (s *Selector) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	if len(s.Matchers) > 0 {
+		parts := make([]string, 0, len(s.Matchers))
+		for _, m := range s.Matchers {
+			parts = append(parts, m.String())
+		}
+		b.WriteString("{" + strings.Join(parts, ", ") + "}")
+	}
+	if s.Range > 0 {
+		b.WriteString("[" + s.Range.String() + "]")
+	}
+	return b.String()
+}
+
+// Call applies a function to its argument.
+type Call struct {
+	Arg  Expr
+	Func string
+}
+
+// String returns the call in expression syntax.
+func (c *Call) String() string {
+	return c.Func + "(" + c.Arg.String() + ")"
+}
+
+// functions lists the supported functions.
+var functions = map[string]bool{
+	"sum":   true,
+	"avg":   true,
+	"min":   true,
+	"max":   true,
+	"count": true,
+	"rate":  true,
+}
+
+// Parse parses an expression.
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	if p.peek().kind == tokEOF {
+		return nil, syntaxError(0, "empty expression")
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, syntaxError(tok.pos, "unexpected %s", tok.kind)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, syntaxError(tok.pos, "expected %s, got %s", kind, tok.kind)
+	}
+	return tok, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	tok, err := p.expect(tokIdent)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokLParen {
+		return p.parseCall(tok)
+	}
+	return p.parseSelector(tok)
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	if !functions[name.text] {
+		return nil, syntaxError(name.pos, "unknown function %q", name.text)
+	}
+	p.next()
+
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokRParen); err != nil {
+		return nil, err
+	}
+	return &Call{Func: name.text, Arg: arg}, nil
+}
+
+func (p *parser) parseSelector(name token) (Expr, error) {
+	if _, err := path.Match(name.text, ""); err != nil {
+		return nil, syntaxError(name.pos, "invalid glob %q", name.text)
+	}
+	sel := &Selector{Name: name.text}
+
+	if p.peek().kind == tokLBrace {
+		p.next()
+		for p.peek().kind != tokRBrace {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			sel.Matchers = append(sel.Matchers, m)
+
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokRBrace); err != nil {
+			return nil, err
+		}
+	}
+
+	if tok := p.peek(); tok.kind == tokDuration {
+		p.next()
+		sel.Range = tok.duration
+	}
+	return sel, nil
+}
+
+func (p *parser) parseMatcher() (Matcher, error) {
+	label, err := p.expect(tokIdent)
+	if err != nil {
+		return Matcher{}, err
+	}
+
+	if !slices.Contains(Labels, label.text) {
+		return Matcher{}, syntaxError(label.pos, "unknown label %q, expected one of %s", label.text, strings.Join(Labels, ", "))
+	}
+
+	op := p.next()
+	m := Matcher{Label: label.text}
+	switch op.kind {
+	case tokEq:
+		m.Op = MatchEqual
+	case tokNeq:
+		m.Op = MatchNotEqual
+	case tokMatch:
+		m.Op = MatchGlob
+	case tokNotMatch:
+		m.Op = MatchNotGlob
+	default:
+		return Matcher{}, syntaxError(op.pos, "expected matching operator, got %s", op.kind)
+	}
+
+	value, err := p.expect(tokString)
+	if err != nil {
+		return Matcher{}, err
+	}
+	m.Value = value.text
+
+	if m.Op == MatchGlob || m.Op == MatchNotGlob {
+		if _, err = path.Match(m.Value, ""); err != nil {
+			return Matcher{}, syntaxError(value.pos, "invalid glob %q", m.Value)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Expr
+	}{
+		{
+			name:  "name glob",
+			input: "CPUutilization*",
+			want:  &Selector{Name: "CPUutilization*"},
+		},
+		{
+			name:  "label matchers",
+			input: `*{type="gauge", name!~"CPU*"}`,
+			want: &Selector{Name: "*", Matchers: []Matcher{
+				{Label: "type", Op: MatchEqual, Value: "gauge"},
+				{Label: "name", Op: MatchNotGlob, Value: "CPU*"},
+			}},
+		},
+		{
+			name:  "aggregation",
+			input: "sum( CPUutilization* )",
+			want:  &Call{Func: "sum", Arg: &Selector{Name: "CPUutilization*"}},
+		},
+		{
+			name:  "nested rate with range",
+			input: `max(rate(*{type="counter"}[1m]))`,
+			want: &Call{Func: "max", Arg: &Call{Func: "rate", Arg: &Selector{
+				Name:     "*",
+				Matchers: []Matcher{{Label: "type", Op: MatchEqual, Value: "counter"}},
+				Range:    time.Minute,
+			}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.input)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	inputs := []string{
+		"",
+		"sum(",
+		"sum(Alloc",
+		"median(Alloc)",
+		`Alloc{type="gauge"`,
+		`Alloc{type:"gauge"}`,
+		`Alloc{type="gauge}`,
+		`Alloc{host="web-1"}`,
+		`Alloc{Type="gauge"}`,
+		"Alloc[1x]",
+		"Alloc[-1m]",
+		"Alloc Alloc",
+		"Alloc)",
+		"Alloc#",
+	}
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			_, err := Parse(input)
+			assert.ErrorIs(t, err, ErrSyntax)
+		})
+	}
+}
+
+func TestExprString(t *testing.T) {
+	input := `max(rate(*{type="counter"}[1m0s]))`
+	expr, err := Parse(input)
+	require.NoError(t, err)
+	assert.Equal(t, input, expr.String())
+}
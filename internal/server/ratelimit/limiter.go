@@ -0,0 +1,96 @@
+// Package ratelimit limits the rate of requests per client with token buckets.
+//
+// Every client has a bucket holding up to burst tokens, refilled at rate tokens per second.
+// A request takes one token and is rejected if the bucket is empty.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	updated time.Time
+	tokens  float64
+}
+
+// Limiter keeps a token bucket per client.
+// Buckets of clients that have been idle long enough to refill are dropped,
+// so the memory used is bounded by the number of recently active clients.
+type Limiter struct {
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+}
+
+// NewLimiter creates a limiter allowing each client rate requests per second on average,
+// with bursts of up to burst requests. A burst below 1 falls back to 1.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		rate:    rate,
+		burst:   float64(burst),
+	}
+}
+
+// Allow takes a token from the client's bucket.
+// If the bucket is empty, it returns false and the time until a token is available.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration(math.Ceil((1 - b.tokens) / l.rate * float64(time.Second)))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Len returns the number of tracked clients.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return min(l.burst, b.tokens+elapsed*l.rate)
+}
+
+// prune drops full buckets, at most once per the time it takes to refill an empty bucket.
+func (l *Limiter) prune(now time.Time) {
+	refillTime := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastPrune) < refillTime {
+		return
+	}
+	l.lastPrune = now
+	for client, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
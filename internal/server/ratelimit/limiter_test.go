@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(rate float64, burst int, now *time.Time) *Limiter {
+	l := NewLimiter(rate, burst)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newTestLimiter(2, 3, &now)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok, "request %d within burst", i)
+	}
+
+	ok, wait := l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.Allow("b")
+	assert.True(t, ok, "other clients have their own bucket")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("a")
+	assert.True(t, ok, "bucket is refilled over time")
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newTestLimiter(1, 4, &now)
+
+	l.Allow("a")
+	l.Allow("b")
+	assert.Equal(t, 2, l.Len())
+
+	now = now.Add(3 * time.Second)
+	for i := 0; i < 3; i++ {
+		l.Allow("b")
+	}
+	now = now.Add(time.Second)
+	l.Allow("c")
+	assert.Equal(t, 2, l.Len(), "idle client with a full bucket is dropped")
+}
@@ -0,0 +1,113 @@
+// Package replay protects signed requests from being replayed.
+//
+// A signed request carries the time it was created at and a random nonce.
+// It is accepted only if its timestamp is within the clock-skew window around
+// the server time and its nonce has not been seen within that window.
+package replay
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is the default clock-skew window.
+	DefaultWindow = 5 * time.Minute
+	// DefaultCacheSize is the default maximum number of remembered nonces.
+	DefaultCacheSize = 100_000
+)
+
+// ErrStale is returned when the request timestamp is outside of the window.
+var ErrStale = errors.New("request timestamp outside of the allowed window")
+
+// ErrReplayed is returned when the request nonce has already been used.
+var ErrReplayed = errors.New("request nonce already used")
+
+type entry struct {
+	nonce string
+	ts    time.Time
+}
+
+// NonceCache remembers the nonces of accepted requests for as long as their timestamps are within the window.
+// The cache is bounded: when it is full, the oldest nonce is forgotten and requests
+// not newer than its timestamp are rejected as stale from then on, so a forgotten nonce cannot be replayed.
+type NonceCache struct {
+	seen   map[string]*list.Element
+	order  *list.List
+	floor  time.Time
+	now    func() time.Time
+	window time.Duration
+	size   int
+	mu     sync.Mutex
+}
+
+// NewNonceCache creates a cache for the given window, holding at most size nonces.
+// Non-positive values fall back to DefaultWindow and DefaultCacheSize.
+func NewNonceCache(window time.Duration, size int) *NonceCache {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &NonceCache{
+		seen:   make(map[string]*list.Element),
+		order:  list.New(),
+		now:    time.Now,
+		window: window,
+		size:   size,
+	}
+}
+
+// Check verifies that the request created at ts with the given nonce is neither stale nor replayed,
+// and remembers the nonce. Returns ErrStale or ErrReplayed otherwise.
+func (c *NonceCache) Check(ts time.Time, nonce string) error {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(now)
+	if ts.Before(now.Add(-c.window)) || ts.After(now.Add(c.window)) || !ts.After(c.floor) {
+		return ErrStale
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return ErrReplayed
+	}
+
+	if c.order.Len() >= c.size {
+		c.evict(c.order.Front())
+	}
+	c.seen[nonce] = c.order.PushBack(entry{nonce: nonce, ts: ts})
+	return nil
+}
+
+// Len returns the number of remembered nonces.
+func (c *NonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// prune forgets the oldest nonces whose timestamps are already outside of the window.
+func (c *NonceCache) prune(now time.Time) {
+	expired := now.Add(-c.window)
+	for e := c.order.Front(); e != nil && e.Value.(entry).ts.Before(expired); e = c.order.Front() {
+		c.remove(e)
+	}
+}
+
+// evict forgets a nonce whose timestamp may still be within the window and raises the floor to it.
+func (c *NonceCache) evict(e *list.Element) {
+	if ts := e.Value.(entry).ts; ts.After(c.floor) {
+		c.floor = ts
+	}
+	c.remove(e)
+}
+
+func (c *NonceCache) remove(e *list.Element) {
+	delete(c.seen, e.Value.(entry).nonce)
+	c.order.Remove(e)
+}
@@ -0,0 +1,78 @@
+package replay
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(window time.Duration, size int, now time.Time) *NonceCache {
+	c := NewNonceCache(window, size)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestNonceCache_Check(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := newTestCache(time.Minute, 10, now)
+
+	tests := []struct {
+		name        string
+		ts          time.Time
+		nonce       string
+		expectedErr error
+	}{
+		{name: "fresh request", ts: now, nonce: "a"},
+		{name: "replayed nonce", ts: now, nonce: "a", expectedErr: ErrReplayed},
+		{name: "slightly skewed clock", ts: now.Add(-50 * time.Second), nonce: "b"},
+		{name: "clock ahead", ts: now.Add(50 * time.Second), nonce: "c"},
+		{name: "too old", ts: now.Add(-2 * time.Minute), nonce: "d", expectedErr: ErrStale},
+		{name: "too far in the future", ts: now.Add(2 * time.Minute), nonce: "e", expectedErr: ErrStale},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := c.Check(test.ts, test.nonce)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNonceCache_Expiration(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := newTestCache(time.Minute, 10, now)
+
+	require.NoError(t, c.Check(now, "a"))
+	require.Equal(t, 1, c.Len())
+
+	// Once the nonce is outside of the window it is forgotten,
+	// and the request it belonged to is rejected as stale anyway.
+	c.now = func() time.Time { return now.Add(2 * time.Minute) }
+	assert.ErrorIs(t, c.Check(now, "a"), ErrStale)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestNonceCache_Bounded(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := newTestCache(time.Minute, 3, now)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Check(now.Add(time.Duration(i-10)*time.Second), fmt.Sprintf("n%d", i)))
+	}
+	require.NoError(t, c.Check(now, "n3"))
+	assert.Equal(t, 3, c.Len())
+
+	t.Run("evicted nonce cannot be replayed", func(t *testing.T) {
+		assert.ErrorIs(t, c.Check(now.Add(-10*time.Second), "n0"), ErrStale)
+	})
+
+	t.Run("newer requests are accepted", func(t *testing.T) {
+		assert.NoError(t, c.Check(now.Add(-5*time.Second), "n4"))
+	})
+}
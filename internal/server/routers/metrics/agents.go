@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"encoding/json"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+)
+
+// UpdateAgentInfo handles the host metadata reported by an agent, e.g. once per connection.
+// The metadata is recorded along with the agent's address and the time it was reported.
+// Responds with HTTP status 200 on success, or 400 if the body is invalid or has no hostname.
+func (h *Router) UpdateAgentInfo(w http.ResponseWriter, r *http.Request) {
+	var info agents.Info
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		code, decodeErr := decodeErrorCode(err)
+		logger.Log.Debug(decodeErr.Error(), zap.Error(err))
+		http.Error(w, decodeErr.Error(), code)
+		return
+	}
+
+	if err := h.agents.Update(info, clientAddress(r)); err != nil {
+		logger.Log.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Log.Info("agent connected",
+		zap.String("hostname", info.Hostname),
+		zap.String("os", info.OS),
+		zap.String("kernel", info.KernelVersion),
+	)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListAgents responds with the host metadata of every agent as a JSON array, ordered by hostname.
+func (h *Router) ListAgents(w http.ResponseWriter, _ *http.Request) {
+	jsonBytes, encodeErr := json.Marshal(h.agents.List())
+	if encodeErr != nil {
+		logger.Log.Debug(errmsg.UnableToEncodeJSON)
+		http.Error(w, encodeErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, writeErr := w.Write(jsonBytes); writeErr != nil {
+		logger.Log.Debug(errmsg.UnableToWriteResponse)
+	}
+}
+
+// clientAddress returns the address of the client, taken from the X-Real-IP header set by agents,
+// or from the connection.
+func clientAddress(r *http.Request) string {
+	if ip := r.Header.Get(middlewares.RealIPHeader); ip != "" {
+		return ip
+	}
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return host
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRouter_Agents(t *testing.T) {
+	registry := agents.NewRegistry()
+	ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithAgents(registry)).Routes())
+	defer ts.Close()
+	client := NewHTTPClient(ts.URL, false)
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "valid info", body: `{"hostname": "web", "os": "linux", "kernel_version": "6.1.0"}`, expectedCode: http.StatusOK},
+		{name: "missing hostname", body: `{"os": "linux"}`, expectedCode: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{"hostname": `, expectedCode: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := client.JSONRequest(t, http.MethodPost, "/agents/info", test.body)
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+		})
+	}
+
+	resp, body := client.URLRequest(t, http.MethodGet, "/agents")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	var listed []agents.Info
+	require.NoError(t, json.Unmarshal([]byte(body), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "web", listed[0].Hostname)
+	assert.Equal(t, "6.1.0", listed[0].KernelVersion)
+	assert.Equal(t, "127.0.0.1", listed[0].Address)
+	assert.False(t, listed[0].SeenAt.IsZero())
+
+	t.Run("address from real IP header", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/agents/info", nil)
+		r.Header.Set(middlewares.RealIPHeader, "10.0.0.7")
+		assert.Equal(t, "10.0.0.7", clientAddress(r))
+	})
+}
+
+func TestMetricsRouter_AgentsDisabled(t *testing.T) {
+	ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage()).Routes())
+	defer ts.Close()
+
+	resp, _ := NewHTTPClient(ts.URL, false).JSONRequest(t, http.MethodPost, "/agents/info", `{"hostname": "web"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
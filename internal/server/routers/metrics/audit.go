@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/audit"
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/models"
+)
+
+// audit reports the metrics written by the request to the auditor, if any.
+func (h *Router) audit(r *http.Request, metrics ...*models.Metric) {
+	if h.auditor == nil || len(metrics) == 0 {
+		return
+	}
+
+	event := newAuditEvent(r, audit.ActionUpdate)
+	event.Metrics = make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		event.Metrics = append(event.Metrics, m.Name)
+	}
+	h.auditor.Notify(event)
+}
+
+// auditClear reports the removal of all metrics by the request to the auditor, if any.
+func (h *Router) auditClear(r *http.Request) {
+	if h.auditor == nil {
+		return
+	}
+	h.auditor.Notify(newAuditEvent(r, audit.ActionClear))
+}
+
+// newAuditEvent returns an event of the action describing the client of the request.
+func newAuditEvent(r *http.Request, action string) audit.Event {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	event := audit.Event{
+		Action:    action,
+		Timestamp: time.Now().Unix(),
+		IPAddress: host,
+		RealIP:    r.Header.Get(middlewares.RealIPHeader),
+		KeyID:     r.Header.Get(middlewares.KeyIDHeader),
+	}
+	if token, ok := auth.FromContext(r.Context()); ok {
+		event.Client = token.Name
+	}
+	return event
+}
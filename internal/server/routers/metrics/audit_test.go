@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/audit"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	events []audit.Event
+	mu     sync.Mutex
+}
+
+func (s *recordingSink) Write(_ context.Context, event audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestMetricsRouter_Audit(t *testing.T) {
+	sink := &recordingSink{}
+	auditor := audit.NewAuditor(10, sink)
+
+	ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithAuditor(auditor)).Routes())
+	defer ts.Close()
+
+	requests := []struct {
+		path   string
+		body   string
+		realIP string
+	}{
+		{path: "/update/gauge/a_1/1", realIP: "10.0.0.1"},
+		{path: "/update/", body: `{"id": "a_2", "type": "counter", "delta": 1}`},
+		{path: "/updates/", body: `[{"id": "a_3", "type": "gauge", "value": 1}, {"id": "a_4", "type": "counter", "delta": 2}]`, realIP: "10.0.0.2"},
+		{path: "/update/", body: `{"id": "a_5", "type": "unknown", "value": 1}`},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodPost, ts.URL+req.path, strings.NewReader(req.body))
+		r.RequestURI = ""
+		if req.realIP != "" {
+			r.Header.Set("X-Real-IP", req.realIP)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	auditor.Close()
+
+	require.Len(t, sink.events, 3, "rejected writes are not audited")
+	assert.Equal(t, audit.ActionUpdate, sink.events[0].Action)
+	assert.Equal(t, []string{"a_1"}, sink.events[0].Metrics)
+	assert.Equal(t, "127.0.0.1", sink.events[0].IPAddress, "connection address is used despite X-Real-IP")
+	assert.Equal(t, "10.0.0.1", sink.events[0].RealIP)
+	assert.Equal(t, "127.0.0.1", sink.events[1].IPAddress)
+	assert.Empty(t, sink.events[1].RealIP)
+	assert.Equal(t, []string{"a_3", "a_4"}, sink.events[2].Metrics)
+	assert.Equal(t, "10.0.0.2", sink.events[2].RealIP)
+	assert.NotZero(t, sink.events[2].Timestamp)
+}
+
+func TestMetricsRouter_AuditClear(t *testing.T) {
+	sink := &recordingSink{}
+	auditor := audit.NewAuditor(10, sink)
+
+	ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithAuditor(auditor)).Routes())
+	defer ts.Close()
+
+	r, err := http.NewRequest(http.MethodDelete, ts.URL+"/admin/metrics", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	auditor.Close()
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, audit.ActionClear, sink.events[0].Action)
+	assert.Empty(t, sink.events[0].Metrics)
+	assert.Equal(t, "127.0.0.1", sink.events[0].IPAddress)
+}
@@ -1,43 +1,289 @@
 package metrics
 
 import (
+	"crypto/rsa"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rshafikov/alertme/internal/server/agents"
+	"github.com/rshafikov/alertme/internal/server/audit"
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/history"
+	"github.com/rshafikov/alertme/internal/server/keys"
 	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/pubsub"
+	"github.com/rshafikov/alertme/internal/server/ratelimit"
+	"github.com/rshafikov/alertme/internal/server/replay"
 	"github.com/rshafikov/alertme/internal/server/storage"
+	"net"
+	"net/http"
+	"time"
 )
 
 // Router manages HTTP routes and interactions with the metric storage system.
 type Router struct {
-	store storage.BaseMetricStorage
+	store        storage.BaseMetricStorage
+	hub          *pubsub.Hub
+	history      *history.History
+	privateKey   *rsa.PrivateKey
+	subnet       *net.IPNet
+	keys         keys.Registry
+	nonces       *replay.NonceCache
+	limiter      *ratelimit.Limiter
+	tokens       *auth.Tokens
+	auditor      *audit.Auditor
+	agents       *agents.Registry
+	rejections   *middlewares.RejectionCounter
+	maxBody      int64
+	maxIngest    int64
+	maxBatch     int
+	strict       bool
+	requireNonce bool
+}
+
+// RouterOption configures optional Router dependencies.
+type RouterOption func(*Router)
+
+// WithHub enables the SSE stream and the live dashboard fed by updates published to the given hub.
+func WithHub(hub *pubsub.Hub) RouterOption {
+	return func(h *Router) {
+		h.hub = hub
+	}
+}
+
+// WithHistory enables sparklines of recent values on the dashboard.
+func WithHistory(hist *history.History) RouterOption {
+	return func(h *Router) {
+		h.history = hist
+	}
+}
+
+// WithPrivateKey enables decryption of request bodies encrypted with the matching public key.
+func WithPrivateKey(key *rsa.PrivateKey) RouterOption {
+	return func(h *Router) {
+		h.privateKey = key
+	}
+}
+
+// WithTrustedSubnet restricts metric updates to agents whose X-Real-IP is within the subnet.
+// Read-only routes stay available from any address.
+func WithTrustedSubnet(subnet *net.IPNet) RouterOption {
+	return func(h *Router) {
+		h.subnet = subnet
+	}
+}
+
+// WithKeyRegistry enables per-agent keys: requests with a key ID are verified with the agent's key from the registry.
+func WithKeyRegistry(registry keys.Registry) RouterOption {
+	return func(h *Router) {
+		h.keys = registry
+	}
+}
+
+// WithReplayWindow sets the clock-skew window in which signed requests carrying a timestamp and a nonce are accepted.
+func WithReplayWindow(window time.Duration) RouterOption {
+	return func(h *Router) {
+		h.nonces = replay.NewNonceCache(window, replay.DefaultCacheSize)
+	}
+}
+
+// WithStrictSignatures requires a valid signature on routes updating metrics once a key is configured.
+// Without it, unsigned updates are accepted but still counted as rejected.
+func WithStrictSignatures(strict bool) RouterOption {
+	return func(h *Router) {
+		h.strict = strict
+	}
+}
+
+// WithRequireNonce rejects requests signed over the body only, without a timestamp and a nonce.
+// Without it, they are accepted but counted as rejected, so agents that must be upgraded can be found.
+func WithRequireNonce(require bool) RouterOption {
+	return func(h *Router) {
+		h.requireNonce = require
+	}
+}
+
+// WithRateLimit limits metric updates of every client address to rate requests per second,
+// with bursts of up to burst requests. A non-positive rate disables the limit.
+func WithRateLimit(rate float64, burst int) RouterOption {
+	return func(h *Router) {
+		h.limiter = nil
+		if rate > 0 {
+			h.limiter = ratelimit.NewLimiter(rate, burst)
+		}
+	}
+}
+
+// WithLimiter limits metric updates of every client address with the limiter,
+// e.g. to share it with the gRPC server. A nil limiter disables the limit.
+func WithLimiter(limiter *ratelimit.Limiter) RouterOption {
+	return func(h *Router) {
+		h.limiter = limiter
+	}
+}
+
+// WithMaxBodySize limits request bodies, compressed or not, to size bytes on all routes but /ingest.
+// Zero means no limit.
+func WithMaxBodySize(size int64) RouterOption {
+	return func(h *Router) {
+		h.maxBody = size
+	}
+}
+
+// WithMaxIngestSize limits request bodies of /ingest, compressed or not, to size bytes.
+// Unsigned bodies are streamed, so only the length of a line is limited otherwise;
+// signed bodies are held in memory until their signature is verified. Zero means no limit.
+func WithMaxIngestSize(size int64) RouterOption {
+	return func(h *Router) {
+		h.maxIngest = size
+	}
+}
+
+// WithMaxBatchSize limits the number of metrics in a single batch update. Zero means no limit.
+func WithMaxBatchSize(size int) RouterOption {
+	return func(h *Router) {
+		h.maxBatch = size
+	}
+}
+
+// WithTokens requires bearer tokens on all routes except /ping and the dashboard assets:
+// reading metrics requires the reader role, updating them the writer role
+// and the administrative routes the admin role.
+func WithTokens(tokens *auth.Tokens) RouterOption {
+	return func(h *Router) {
+		h.tokens = tokens
+	}
+}
+
+// WithAuditor reports every metric write accepted over /update, /updates/ and /ingest to the auditor.
+func WithAuditor(auditor *audit.Auditor) RouterOption {
+	return func(h *Router) {
+		h.auditor = auditor
+	}
+}
+
+// WithAgents enables the routes recording and listing the host metadata reported by the agents.
+func WithAgents(registry *agents.Registry) RouterOption {
+	return func(h *Router) {
+		h.agents = registry
+	}
+}
+
+// WithRejectionCounter counts requests rejected by the signature checks in the counter,
+// e.g. to share it with the gRPC server. By default, the router counts them on its own.
+func WithRejectionCounter(counter *middlewares.RejectionCounter) RouterOption {
+	return func(h *Router) {
+		h.rejections = counter
+	}
 }
 
 // NewMetricsRouter initializes a new Router with the provided metric storage.
-func NewMetricsRouter(store storage.BaseMetricStorage) *Router {
-	return &Router{
-		store: store,
+func NewMetricsRouter(store storage.BaseMetricStorage, opts ...RouterOption) *Router {
+	h := &Router{
+		store:      store,
+		nonces:     replay.NewNonceCache(replay.DefaultWindow, replay.DefaultCacheSize),
+		rejections: middlewares.NewRejectionCounter(),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // Routes initializes and configures the application's routes and middleware stack.
 // Returns a chi.Router instance with all routes and middleware applied.
+// Streaming routes are registered outside of the GZipper and Hasher middlewares,
+// since both buffer the response body.
+// Encrypted bodies are decrypted before they are decompressed and their hash is verified.
+// Routes are grouped by the role they require: reading, updating or administering metrics.
+// Routes updating metrics are checked against the trusted subnet and the rate limit
+// before their bodies are read, all other routes are allowed from any address.
+// Request bodies are limited to the maximum body size, except for /ingest with a limit of its own.
+// Requests rejected by the signature checks are counted in memory and listed by /admin/rejections.
 func (h *Router) Routes() chi.Router {
+	signatures := middlewares.HasherConfig{
+		Keys:         h.keys,
+		Nonces:       h.nonces,
+		RequireNonce: h.requireNonce,
+		Strict:       h.strict,
+		Rejections:   h.rejections.Record,
+	}
+
 	r := chi.NewRouter()
 	r.Use(middlewares.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middlewares.GZipper)
-	r.Use(middlewares.Hasher)
-
-	r.Get("/", h.ListMetrics)
-	r.Get("/ping", h.PingDB)
-	r.Post("/updates/", h.CreateMetricsFromJSON)
-	r.Route("/update", func(r chi.Router) {
-		r.Post("/", h.CreateMetricFromJSON)
-		r.Post("/{metricType}/{metricName}/{metricValue}", h.CreateMetricFromURL)
+
+	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+	r.With(middlewares.GZipper).Get("/ping", h.PingDB)
+
+	if h.hub != nil {
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireRole(h.tokens, auth.RoleReader))
+
+			r.Get("/stream", h.StreamMetrics)
+			r.Get("/ws", h.DashboardSocket)
+		})
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.RequireRole(h.tokens, auth.RoleReader))
+		h.useBodyMiddlewares(r, signatures, h.maxBody)
+
+		r.Get("/", h.ListMetrics)
+		r.Get("/query", h.QueryMetrics)
+		if h.agents != nil {
+			r.Get("/agents", h.ListAgents)
+		}
+		r.Route("/value", func(r chi.Router) {
+			r.Post("/", h.GetMericFromJSON)
+			r.Get("/{metricType}/{metricName}", h.GetMetricFromURL)
+		})
 	})
-	r.Route("/value", func(r chi.Router) {
-		r.Post("/", h.GetMericFromJSON)
-		r.Get("/{metricType}/{metricName}", h.GetMetricFromURL)
+
+	r.Group(func(r chi.Router) {
+		h.useWriterMiddlewares(r, signatures, h.maxIngest)
+
+		r.Post("/ingest", h.IngestMetrics)
+	})
+
+	r.Group(func(r chi.Router) {
+		h.useWriterMiddlewares(r, signatures, h.maxBody)
+
+		r.Post("/updates/", h.CreateMetricsFromJSON)
+		if h.agents != nil {
+			r.Post("/agents/info", h.UpdateAgentInfo)
+		}
+		r.Route("/update", func(r chi.Router) {
+			r.Post("/", h.CreateMetricFromJSON)
+			r.Post("/{metricType}/{metricName}/{metricValue}", h.CreateMetricFromURL)
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.RequireRole(h.tokens, auth.RoleAdmin))
+		h.useBodyMiddlewares(r, signatures, h.maxBody)
+
+		r.Delete("/admin/metrics", h.ClearMetrics)
+		r.Get("/admin/rejections", h.ListRejections)
 	})
 	return r
 }
+
+// useWriterMiddlewares adds the middlewares guarding routes updating metrics, with bodies of up to maxBody bytes.
+func (h *Router) useWriterMiddlewares(r chi.Router, signatures middlewares.HasherConfig, maxBody int64) {
+	r.Use(middlewares.TrustedSubnet(h.subnet))
+	r.Use(middlewares.RateLimit(h.limiter))
+	r.Use(middlewares.RequireRole(h.tokens, auth.RoleWriter))
+	h.useBodyMiddlewares(r, signatures, maxBody)
+	r.Use(middlewares.RequireSignature(signatures))
+}
+
+// useBodyMiddlewares adds the middlewares limiting request bodies to maxBody bytes,
+// decoding them and verifying their signatures.
+func (h *Router) useBodyMiddlewares(r chi.Router, signatures middlewares.HasherConfig, maxBody int64) {
+	r.Use(middlewares.BodyLimiter(maxBody))
+	if h.privateKey != nil {
+		r.Use(middlewares.Decrypter(h.privateKey))
+	}
+	r.Use(middlewares.GZipper)
+	r.Use(middlewares.NewHasher(signatures))
+}
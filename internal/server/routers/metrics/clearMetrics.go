@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// ClearMetrics handles the administrative request to remove all stored metrics.
+// It responds with HTTP status 204 once the storage is cleared, and reports the request to the auditor.
+func (h *Router) ClearMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token, _ := auth.FromContext(ctx)
+	logger.Log.Warn("clearing all metrics", zap.String("token", token.Name))
+
+	h.store.Clear(ctx)
+	h.auditClear(r)
+	w.WriteHeader(http.StatusNoContent)
+}
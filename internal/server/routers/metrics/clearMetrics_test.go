@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/auth"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRouter_ClearMetrics(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	value := 1.5
+	require.NoError(t, memStorage.Add(context.Background(), &models.Metric{Name: "cm_1", Type: models.GaugeType, Value: &value}))
+
+	ts := httptest.NewServer(NewMetricsRouter(memStorage).Routes())
+	defer ts.Close()
+
+	r := httptest.NewRequest(http.MethodDelete, ts.URL+"/admin/metrics", nil)
+	r.RequestURI = ""
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Empty(t, memStorage.List(context.Background()))
+}
+
+func TestMetricsRouter_Roles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	content := `[
+		{"name": "dashboard", "token": "read-token", "role": "reader"},
+		{"name": "agent", "token": "write-token", "role": "writer"},
+		{"name": "ops", "token": "admin-token", "role": "admin"}
+	]`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	tokens, err := auth.NewFileTokens(path)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithTokens(tokens)).Routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		expectedCode int
+	}{
+		{name: "list metrics without token", method: http.MethodGet, path: "/", expectedCode: http.StatusUnauthorized},
+		{name: "list metrics as reader", method: http.MethodGet, path: "/", token: "read-token", expectedCode: http.StatusOK},
+		{name: "list metrics with query token", method: http.MethodGet, path: "/?access_token=read-token", expectedCode: http.StatusOK},
+		{name: "update as reader", method: http.MethodPost, path: "/update/gauge/r_1/1", token: "read-token", expectedCode: http.StatusForbidden},
+		{name: "update as writer", method: http.MethodPost, path: "/update/gauge/r_1/1", token: "write-token", expectedCode: http.StatusOK},
+		{name: "read as writer", method: http.MethodGet, path: "/value/gauge/r_1", token: "write-token", expectedCode: http.StatusOK},
+		{name: "clear as writer", method: http.MethodDelete, path: "/admin/metrics", token: "write-token", expectedCode: http.StatusForbidden},
+		{name: "clear as admin", method: http.MethodDelete, path: "/admin/metrics", token: "admin-token", expectedCode: http.StatusNoContent},
+		{name: "assets without token", method: http.MethodGet, path: "/static/dashboard.js", expectedCode: http.StatusOK},
+		{name: "ping without token", method: http.MethodGet, path: "/ping", expectedCode: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, ts.URL+test.path, nil)
+			r.RequestURI = ""
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+		})
+	}
+}
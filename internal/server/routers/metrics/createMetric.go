@@ -26,6 +26,7 @@ func (h *Router) CreateMetricFromURL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, storageErr.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.audit(r, newMetric)
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -49,6 +50,7 @@ func (h *Router) CreateMetricFromJSON(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, saveErr.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.audit(r, newMetric)
 
 	createdMetric, getErr := h.store.Get(ctx, newMetric.Type, newMetric.Name)
 	if getErr != nil {
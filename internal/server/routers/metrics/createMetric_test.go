@@ -5,18 +5,26 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/rshafikov/alertme/internal/encryption"
 	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
 	"github.com/rshafikov/alertme/internal/server/models"
 	"github.com/rshafikov/alertme/internal/server/settings"
 	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/rshafikov/alertme/internal/signature"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -238,6 +246,12 @@ func TestMetricsRouter_GZIPCompression(t *testing.T) {
 	ts := httptest.NewServer(router.Routes())
 	defer ts.Close()
 
+	originalMinSize := settings.CONF.CompressMinSize
+	defer func() {
+		settings.CONF.CompressMinSize = originalMinSize
+	}()
+	settings.CONF.CompressMinSize = 0
+
 	successBody := `{"id": "test_gzipped_gauge_1", "value": 1000, "type": "gauge"}`
 
 	t.Run("send metric in gzip", func(t *testing.T) {
@@ -325,21 +339,35 @@ func TestMetricsRouter_GZIPCompression(t *testing.T) {
 
 }
 
+// signRequest signs the body of the request with the key, a fresh timestamp and a random nonce, like the agent.
+func signRequest(r *http.Request, key, body string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(signature.Material(timestamp, nonce, []byte(body)))
+	r.Header.Set("HashSHA256", hex.EncodeToString(h.Sum(nil)))
+	r.Header.Set(middlewares.TimestampHeader, timestamp)
+	r.Header.Set(middlewares.NonceHeader, nonce)
+}
+
 func TestMetricsRouter_HashMiddleware(t *testing.T) {
 	memStorage := storage.NewMemStorage()
 	router := NewMetricsRouter(memStorage)
 	ts := httptest.NewServer(router.Routes())
 	defer ts.Close()
 
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
 	key := "I voted for Trump"
 	settings.CONF.Key = key
 	h := hmac.New(sha256.New, []byte(key))
 
 	t.Run("send signed and zipped data", func(t *testing.T) {
 		reqBody := `[{"id": "h_1", "value": 1234.56789, "type": "gauge"}, {"id": "h_2", "delta": 123456789, "type": "counter"}]`
-		h.Write([]byte(reqBody))
-		hash := h.Sum(nil)
-		defer h.Reset()
 
 		buf := bytes.NewBuffer(nil)
 		zb := gzip.NewWriter(buf)
@@ -352,7 +380,7 @@ func TestMetricsRouter_HashMiddleware(t *testing.T) {
 		r.Header.Set("Content-Encoding", "gzip")
 		r.Header.Set("Accept-Encoding", "gzip")
 		r.Header.Set("Content-Type", "application/json")
-		r.Header.Set("HashSHA256", hex.EncodeToString(hash))
+		signRequest(r, key, reqBody)
 
 		resp, err := http.DefaultClient.Do(r)
 		require.NoError(t, err)
@@ -361,6 +389,32 @@ func TestMetricsRouter_HashMiddleware(t *testing.T) {
 		require.Equal(t, http.StatusOK, resp.StatusCode)
 	})
 
+	t.Run("body signature without timestamp and nonce", func(t *testing.T) {
+		reqBody := `[{"id": "h_3", "value": 1, "type": "gauge"}]`
+		h.Write([]byte(reqBody))
+		hash := h.Sum(nil)
+		defer h.Reset()
+
+		post := func(url string) *http.Response {
+			r := httptest.NewRequest(http.MethodPost, url+"/updates/", strings.NewReader(reqBody))
+			r.RequestURI = ""
+			r.Header.Set("HashSHA256", hex.EncodeToString(hash))
+
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			resp.Body.Close()
+			return resp
+		}
+
+		assert.Equal(t, http.StatusOK, post(ts.URL).StatusCode)
+		counts := router.rejections.Counts()
+		assert.Equal(t, int64(1), counts[middlewares.RejectLegacy])
+
+		strict := httptest.NewServer(NewMetricsRouter(memStorage, WithRequireNonce(true)).Routes())
+		defer strict.Close()
+		assert.Equal(t, http.StatusUnauthorized, post(strict.URL).StatusCode)
+	})
+
 	t.Run("get signed and zipped data", func(t *testing.T) {
 		gaugeMetricRequest := `{"id": "h_1", "type": "gauge"}`
 		h.Write([]byte(`{"value":1234.56789,"id":"h_1","type":"gauge"}`))
@@ -376,3 +430,244 @@ func TestMetricsRouter_HashMiddleware(t *testing.T) {
 		require.Equal(t, hex.EncodeToString(hash), resp.Header.Get("Hashsha256"))
 	})
 }
+
+func TestMetricsRouter_DecryptMiddleware(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	memStorage := storage.NewMemStorage()
+	router := NewMetricsRouter(memStorage, WithPrivateKey(privateKey))
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	key := "encryption key"
+	settings.CONF.Key = key
+
+	reqBody := `[{"id": "enc_1", "value": 1.5, "type": "gauge"}]`
+
+	buf := bytes.NewBuffer(nil)
+	zb := gzip.NewWriter(buf)
+	_, err = zb.Write([]byte(reqBody))
+	require.NoError(t, err)
+	require.NoError(t, zb.Close())
+
+	encrypted, err := encryption.Encrypt(&privateKey.PublicKey, buf.Bytes())
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, ts.URL+"/updates/", bytes.NewReader(encrypted))
+	r.RequestURI = ""
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set("Content-Type", "application/json")
+	signRequest(r, key, reqBody)
+	r.Header.Set(encryption.Header, encryption.Scheme)
+
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	m, err := memStorage.Get(context.Background(), models.GaugeType, "enc_1")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *m.Value)
+}
+
+func TestMetricsRouter_TrustedSubnet(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.10.0.0/16")
+	require.NoError(t, err)
+
+	memStorage := storage.NewMemStorage()
+	router := NewMetricsRouter(memStorage, WithTrustedSubnet(subnet))
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		realIP       string
+		expectedCode int
+	}{
+		{name: "update from trusted address", method: http.MethodPost, path: "/update/gauge/ts_1/1", realIP: "10.10.1.1", expectedCode: http.StatusOK},
+		{name: "update from untrusted address", method: http.MethodPost, path: "/update/gauge/ts_1/2", realIP: "10.11.1.1", expectedCode: http.StatusForbidden},
+		{name: "batch update without address", method: http.MethodPost, path: "/updates/", expectedCode: http.StatusForbidden},
+		{name: "list metrics from untrusted address", method: http.MethodGet, path: "/", realIP: "10.11.1.1", expectedCode: http.StatusOK},
+		{name: "ping without address is not forbidden", method: http.MethodGet, path: "/ping", expectedCode: http.StatusInternalServerError},
+		{name: "get value without address", method: http.MethodGet, path: "/value/gauge/ts_1", expectedCode: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, ts.URL+test.path, nil)
+			r.RequestURI = ""
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestMetricsRouter_StrictSignatures(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	key := "strict key"
+	settings.CONF.Key = key
+
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), "strict-nonce"
+	sign := func(body string) string {
+		h := hmac.New(sha256.New, []byte(key))
+		h.Write(signature.Material(timestamp, nonce, []byte(body)))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	body := `{"id": "ss_1", "type": "gauge", "value": 1}`
+
+	tests := []struct {
+		name           string
+		strict         bool
+		method         string
+		path           string
+		body           string
+		hash           string
+		expectedCode   int
+		expectedReason string
+	}{
+		{name: "signed update", strict: true, method: http.MethodPost, path: "/update/", body: body, hash: sign(body), expectedCode: http.StatusOK},
+		{name: "unsigned update", strict: true, method: http.MethodPost, path: "/update/", body: body, expectedCode: http.StatusUnauthorized, expectedReason: "Missing"},
+		{name: "unsigned url update", strict: true, method: http.MethodPost, path: "/update/gauge/ss_1/2", expectedCode: http.StatusUnauthorized, expectedReason: "Missing"},
+		{name: "wrong signature", strict: true, method: http.MethodPost, path: "/update/", body: body, hash: sign("other"), expectedCode: http.StatusUnauthorized, expectedReason: "Invalid"},
+		{name: "malformed signature", strict: true, method: http.MethodPost, path: "/update/", body: body, hash: "not hex", expectedCode: http.StatusBadRequest, expectedReason: "Malformed"},
+		{name: "unsigned read", strict: true, method: http.MethodGet, path: "/value/gauge/ss_1", expectedCode: http.StatusOK},
+		{name: "unsigned update without strict mode", method: http.MethodPost, path: "/update/", body: body, expectedCode: http.StatusOK, expectedReason: "Missing"},
+		{name: "wrong signature without strict mode", method: http.MethodPost, path: "/update/", body: body, hash: sign("other"), expectedCode: http.StatusBadRequest, expectedReason: "Invalid"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memStorage := storage.NewMemStorage()
+			require.NoError(t, memStorage.Add(context.Background(), &models.Metric{Name: "ss_1", Type: models.GaugeType, Value: new(float64)}))
+			router := NewMetricsRouter(memStorage, WithStrictSignatures(test.strict))
+			ts := httptest.NewServer(router.Routes())
+			defer ts.Close()
+
+			r := httptest.NewRequest(test.method, ts.URL+test.path, strings.NewReader(test.body))
+			r.RequestURI = ""
+			if test.hash != "" {
+				r.Header.Set("HashSHA256", test.hash)
+				r.Header.Set(middlewares.TimestampHeader, timestamp)
+				r.Header.Set(middlewares.NonceHeader, nonce)
+			}
+
+			resp, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+			_, err = memStorage.Get(context.Background(), models.CounterType, "RejectedSignature"+test.expectedReason)
+			assert.Error(t, err, "rejections are not stored as metrics")
+
+			for reason, count := range router.rejections.Counts() {
+				if reason == test.expectedReason {
+					assert.Equal(t, int64(1), count, reason)
+				} else {
+					assert.Zero(t, count, reason)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsRouter_RequestLimits(t *testing.T) {
+	batch := func(n int) string {
+		metrics := make([]string, n)
+		for i := range metrics {
+			metrics[i] = `{"id": "rl_1", "type": "counter", "delta": 1}`
+		}
+		return "[" + strings.Join(metrics, ",") + "]"
+	}
+
+	t.Run("batch size", func(t *testing.T) {
+		memStorage := storage.NewMemStorage()
+		ts := httptest.NewServer(NewMetricsRouter(memStorage, WithMaxBatchSize(3)).Routes())
+		defer ts.Close()
+
+		resp, err := http.Post(ts.URL+"/updates/", "application/json", strings.NewReader(batch(3)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = http.Post(ts.URL+"/updates/", "application/json", strings.NewReader(batch(4)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		m, err := memStorage.Get(context.Background(), models.CounterType, "rl_1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), *m.Delta, "rejected batch is not stored")
+	})
+
+	t.Run("body size", func(t *testing.T) {
+		ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithMaxBodySize(4096)).Routes())
+		defer ts.Close()
+
+		buf := bytes.NewBuffer(nil)
+		zb := gzip.NewWriter(buf)
+		_, err := zb.Write([]byte(batch(1000)))
+		require.NoError(t, err)
+		require.NoError(t, zb.Close())
+
+		r := httptest.NewRequest(http.MethodPost, ts.URL+"/updates/", buf)
+		r.RequestURI = ""
+		r.Header.Set("Content-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+
+	t.Run("ingest size", func(t *testing.T) {
+		lines := strings.Repeat(`{"id": "rl_1", "type": "counter", "delta": 1}`+"\n", 1000)
+
+		ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithMaxBodySize(4096)).Routes())
+		defer ts.Close()
+		resp, err := http.Post(ts.URL+"/ingest", "application/x-ndjson", strings.NewReader(lines))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "the maximum body size does not apply to /ingest")
+
+		ts = httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithMaxIngestSize(4096)).Routes())
+		defer ts.Close()
+		resp, err = http.Post(ts.URL+"/ingest", "application/x-ndjson", strings.NewReader(lines))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithRateLimit(0.01, 2)).Routes())
+		defer ts.Close()
+
+		for _, expectedCode := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			resp, err := http.Post(ts.URL+"/update/counter/rl_1/1", "text/plain", nil)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, expectedCode, resp.StatusCode)
+			if expectedCode == http.StatusTooManyRequests {
+				assert.Equal(t, "100", resp.Header.Get("Retry-After"))
+			}
+		}
+
+		resp, err := http.Get(ts.URL + "/value/counter/rl_1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "reads are not rate limited")
+	})
+}
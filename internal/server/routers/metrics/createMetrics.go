@@ -25,6 +25,7 @@ func (h *Router) CreateMetricsFromJSON(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, saveErr.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.audit(r, newMetrics...)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte(""))
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/rshafikov/alertme/internal/server/history"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/pubsub"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	// DashboardWriteTimeout limits the time spent writing a single WebSocket message.
+	DashboardWriteTimeout = 10 * time.Second
+	// DashboardPingInterval is the interval between WebSocket pings sent to the dashboard.
+	DashboardPingInterval = 30 * time.Second
+)
+
+// dashboardMetric is a metric sent to the dashboard together with its recent values.
+type dashboardMetric struct {
+	*models.Metric
+	History []history.Point `json:"history,omitempty"`
+}
+
+// dashboardMessage is a WebSocket message sent to the dashboard.
+// Kind is "snapshot" for the initial state and "update" for live changes.
+type dashboardMessage struct {
+	Kind    string            `json:"kind"`
+	Metrics []dashboardMetric `json:"metrics"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// DashboardSocket upgrades the connection to WebSocket and feeds the dashboard.
+// It first sends a snapshot of all stored metrics with their recent history,
+// then forwards every accepted metric update until the client disconnects.
+func (h *Router) DashboardSocket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Log.Debug("unable to upgrade connection", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	sub := h.hub.Subscribe(pubsub.Filter{})
+	defer sub.Close()
+
+	snapshot := dashboardMessage{Kind: "snapshot", Metrics: []dashboardMetric{}}
+	for _, m := range h.store.List(ctx) {
+		snapshot.Metrics = append(snapshot.Metrics, h.dashboardMetric(m))
+	}
+	if err = h.writeDashboardMessage(conn, snapshot); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, readErr := conn.NextReader(); readErr != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(DashboardPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+
+		case <-ping.C:
+			deadline := time.Now().Add(DashboardWriteTimeout)
+			if err = conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+
+		case batch, ok := <-sub.Updates():
+			if !ok {
+				logger.Log.Debug("dashboard subscription closed")
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"),
+					time.Now().Add(DashboardWriteTimeout))
+				return
+			}
+			update := dashboardMessage{Kind: "update"}
+			for _, m := range batch {
+				update.Metrics = append(update.Metrics, dashboardMetric{Metric: m})
+			}
+			for pending := len(sub.Updates()); pending > 0; pending-- {
+				next, more := <-sub.Updates()
+				if !more {
+					break
+				}
+				for _, m := range next {
+					update.Metrics = append(update.Metrics, dashboardMetric{Metric: m})
+				}
+			}
+			if err = h.writeDashboardMessage(conn, update); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Router) dashboardMetric(m *models.Metric) dashboardMetric {
+	dm := dashboardMetric{Metric: m}
+	if h.history != nil {
+		dm.History = h.history.Get(m.Type, m.Name)
+	}
+	return dm
+}
+
+func (h *Router) writeDashboardMessage(conn *websocket.Conn, msg dashboardMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(DashboardWriteTimeout)); err != nil {
+		return err
+	}
+	if err := conn.WriteJSON(msg); err != nil {
+		logger.Log.Debug("unable to write dashboard message", zap.Error(err))
+		return err
+	}
+	return nil
+}
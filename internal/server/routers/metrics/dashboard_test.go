@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rshafikov/alertme/internal/server/history"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/pubsub"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler_DashboardSocket(t *testing.T) {
+	hub := pubsub.NewHub(pubsub.DefaultBufferSize)
+	hist := history.NewHistory(history.DefaultSize)
+	store := storage.NewPublishingStorage(storage.NewMemStorage(), hub, hist)
+	router := NewMetricsRouter(store, WithHub(hub), WithHistory(hist))
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	m, err := models.NewMetric(models.GaugeType, "dash_gauge", "1.5")
+	require.NoError(t, err)
+	require.NoError(t, store.Add(context.Background(), m))
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	t.Run("snapshot with history", func(t *testing.T) {
+		var msg struct {
+			Kind    string `json:"kind"`
+			Metrics []struct {
+				ID      string          `json:"id"`
+				Value   float64         `json:"value"`
+				History []history.Point `json:"history"`
+			} `json:"metrics"`
+		}
+		require.NoError(t, conn.ReadJSON(&msg))
+
+		assert.Equal(t, "snapshot", msg.Kind)
+		require.Len(t, msg.Metrics, 1)
+		assert.Equal(t, "dash_gauge", msg.Metrics[0].ID)
+		require.Len(t, msg.Metrics[0].History, 1)
+		assert.Equal(t, 1.5, msg.Metrics[0].History[0].Value)
+	})
+
+	t.Run("live update", func(t *testing.T) {
+		post, postErr := http.Post(ts.URL+"/update/counter/dash_counter/7", "", nil)
+		require.NoError(t, postErr)
+		post.Body.Close()
+
+		var msg struct {
+			Kind    string          `json:"kind"`
+			Metrics []models.Metric `json:"metrics"`
+		}
+		require.NoError(t, conn.ReadJSON(&msg))
+
+		assert.Equal(t, "update", msg.Kind)
+		require.Len(t, msg.Metrics, 1)
+		assert.Equal(t, "dash_counter", msg.Metrics[0].Name)
+		assert.EqualValues(t, 7, *msg.Metrics[0].Delta)
+	})
+}
+
+func TestMetricsHandler_DashboardAssets(t *testing.T) {
+	router := NewMetricsRouter(storage.NewMemStorage())
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	for path, contentType := range map[string]string{
+		"/static/dashboard.js":  "javascript",
+		"/static/dashboard.css": "text/css",
+	} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Contains(t, resp.Header.Get("Content-Type"), contentType)
+			assert.NotEmpty(t, body)
+		})
+	}
+
+	t.Run("live updates disabled without hub", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `data-live="false"`)
+	})
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	// IngestChunkSize is the maximum number of metrics stored by a single AddBatch call during ingestion.
+	IngestChunkSize = 1000
+	// MaxIngestLineSize is the maximum size of a single NDJSON line in bytes.
+	MaxIngestLineSize = 64 * 1024
+)
+
+// IngestResult describes the outcome of a streaming ingestion request.
+// Error is set if the request failed after some metrics may have been stored.
+type IngestResult struct {
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Error    string `json:"error,omitempty"`
+}
+
+// IngestMetrics handles bulk ingestion of metrics sent as newline-delimited JSON.
+// The body is decoded line by line and stored in chunks of IngestChunkSize metrics,
+// so memory usage does not depend on the size of the request.
+// This only holds for unsigned bodies: a signed body is held in memory by the Hasher
+// until its signature is verified, so it is bounded by the maximum ingest size instead.
+// Lines that cannot be decoded or validated are counted as rejected and skipped.
+// Responds with the number of accepted and rejected lines in JSON, also if the request fails
+// after some chunks were stored, with the reason of the failure in the error field.
+func (h *Router) IngestMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var result IngestResult
+	chunk := make([]*models.Metric, 0, IngestChunkSize)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := h.store.AddBatch(ctx, chunk); err != nil {
+			return err
+		}
+		h.audit(r, chunk...)
+		result.Accepted += len(chunk)
+		chunk = make([]*models.Metric, 0, IngestChunkSize)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MaxIngestLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		metric, parseErr := h.ParseMetricFromLine(line)
+		if parseErr != nil {
+			logger.Log.Debug("rejected ingest line", zap.Error(parseErr))
+			result.Rejected++
+			continue
+		}
+
+		chunk = append(chunk, metric)
+		if len(chunk) == IngestChunkSize {
+			if saveErr := flush(); saveErr != nil {
+				logger.Log.Debug(errmsg.UnableToAddMetric, zap.Error(saveErr))
+				result.Error = errmsg.UnableToAddMetric
+				writeIngestResult(w, http.StatusInternalServerError, result)
+				return
+			}
+		}
+	}
+
+	if scanErr := scanner.Err(); scanErr != nil {
+		if middlewares.BodyTooLarge(scanErr) {
+			logger.Log.Debug(errmsg.RequestTooLarge, zap.Error(scanErr))
+			result.Error = errmsg.RequestTooLarge
+			writeIngestResult(w, http.StatusRequestEntityTooLarge, result)
+			return
+		}
+		logger.Log.Debug(errmsg.UnableToReadBody, zap.Error(scanErr))
+		result.Error = errmsg.UnableToReadBody
+		writeIngestResult(w, http.StatusBadRequest, result)
+		return
+	}
+
+	if saveErr := flush(); saveErr != nil {
+		logger.Log.Debug(errmsg.UnableToAddMetric, zap.Error(saveErr))
+		result.Error = errmsg.UnableToAddMetric
+		writeIngestResult(w, http.StatusInternalServerError, result)
+		return
+	}
+
+	writeIngestResult(w, http.StatusOK, result)
+}
+
+// writeIngestResult writes the result of an ingestion request in JSON with the status code.
+func writeIngestResult(w http.ResponseWriter, status int, result IngestResult) {
+	jsonBytes, encodeErr := json.Marshal(result)
+	if encodeErr != nil {
+		logger.Log.Debug(errmsg.UnableToEncodeJSON)
+		http.Error(w, errmsg.UnableToEncodeJSON, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, writeErr := w.Write(jsonBytes)
+	if writeErr != nil {
+		logger.Log.Debug(errmsg.UnableToWriteResponse)
+		return
+	}
+}
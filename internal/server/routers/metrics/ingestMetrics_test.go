@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/settings"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ingestPath = "/ingest"
+
+func TestMetricsHandler_IngestMetrics(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	router := NewMetricsRouter(memStorage)
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	var notCompress bool
+	client := NewHTTPClient(ts.URL, notCompress)
+
+	tests := []struct {
+		name         string
+		reqBody      string
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			name:         "ingest valid lines",
+			reqBody:      "{\"id\": \"ingest_g\", \"value\": 1.5, \"type\": \"gauge\"}\n{\"id\": \"ingest_c\", \"delta\": 2, \"type\": \"counter\"}\n",
+			expectedBody: `{"accepted": 2, "rejected": 0}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "ingest with invalid lines",
+			reqBody:      "{\"id\": \"ingest_c\", \"delta\": 3, \"type\": \"counter\"}\nnot a json\n{\"id\": \"ingest_x\", \"type\": \"gauge\"}\n{\"id\": \"ingest_y\", \"value\": 1, \"type\": \"gague\"}",
+			expectedBody: `{"accepted": 1, "rejected": 3}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "ingest skips empty lines",
+			reqBody:      "\n\n   \n",
+			expectedBody: `{"accepted": 0, "rejected": 0}`,
+			expectedCode: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, respBody := client.JSONRequest(t, http.MethodPost, ingestPath, test.reqBody)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+			assert.JSONEq(t, test.expectedBody, respBody)
+		})
+	}
+
+	t.Run("counter deltas are summed", func(t *testing.T) {
+		m, err := memStorage.Get(context.Background(), models.CounterType, "ingest_c")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), *m.Delta)
+	})
+
+	t.Run("line too long", func(t *testing.T) {
+		longName := strings.Repeat("a", MaxIngestLineSize)
+		reqBody := fmt.Sprintf(`{"id": "%s", "value": 1, "type": "gauge"}`, longName)
+		resp, respBody := client.JSONRequest(t, http.MethodPost, ingestPath, reqBody)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.JSONEq(t, `{"accepted": 0, "rejected": 0, "error": "cannot read request body"}`, respBody)
+	})
+}
+
+// failingStorage fails to store batches once the given number of them was stored.
+type failingStorage struct {
+	*storage.MemStorage
+	batches int
+}
+
+func (s *failingStorage) AddBatch(ctx context.Context, metrics []*models.Metric) error {
+	if s.batches == 0 {
+		return errors.New("storage is unavailable")
+	}
+	s.batches--
+	return s.MemStorage.AddBatch(ctx, metrics)
+}
+
+func TestMetricsHandler_IngestMetricsPartialFailure(t *testing.T) {
+	store := &failingStorage{MemStorage: storage.NewMemStorage(), batches: 1}
+	ts := httptest.NewServer(NewMetricsRouter(store).Routes())
+	defer ts.Close()
+
+	var lines strings.Builder
+	for i := 0; i < IngestChunkSize*2; i++ {
+		fmt.Fprintf(&lines, "{\"id\": \"fail_%d\", \"value\": %d, \"type\": \"gauge\"}\n", i, i)
+	}
+	lines.WriteString("not a json\n")
+
+	resp, err := http.Post(ts.URL+ingestPath, "application/x-ndjson", strings.NewReader(lines.String()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.JSONEq(t, fmt.Sprintf(`{"accepted": %d, "rejected": 0, "error": "unable to add metric"}`, IngestChunkSize), string(respBody))
+	assert.Len(t, store.List(context.Background()), IngestChunkSize)
+}
+
+func TestMetricsHandler_IngestMetricsStreaming(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	ts := httptest.NewServer(NewMetricsRouter(memStorage).Routes())
+	defer ts.Close()
+
+	pr, pw := io.Pipe()
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post(ts.URL+ingestPath, "application/x-ndjson", pr)
+		assert.NoError(t, err)
+		done <- resp
+	}()
+
+	for i := 0; i < IngestChunkSize; i++ {
+		_, err := fmt.Fprintf(pw, "{\"id\": \"stream_%d\", \"value\": %d, \"type\": \"gauge\"}\n", i, i)
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		return len(memStorage.List(context.Background())) == IngestChunkSize
+	}, 5*time.Second, 10*time.Millisecond, "an unsigned body is stored before it is fully sent")
+
+	require.NoError(t, pw.Close())
+	resp := <-done
+	require.NotNil(t, resp)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMetricsHandler_IngestMetricsSigned(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	key := "ingest key"
+	settings.CONF.Key = key
+
+	var lines strings.Builder
+	for i := 0; i < IngestChunkSize*2; i++ {
+		fmt.Fprintf(&lines, "{\"id\": \"signed_%d\", \"value\": %d, \"type\": \"gauge\"}\n", i, i)
+	}
+	reqBody := lines.String()
+
+	post := func(t *testing.T, ts *httptest.Server) *http.Response {
+		r := httptest.NewRequest(http.MethodPost, ts.URL+ingestPath, strings.NewReader(reqBody))
+		r.RequestURI = ""
+		r.Header.Set("Content-Type", "application/x-ndjson")
+		signRequest(r, key, reqBody)
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("signed body is verified", func(t *testing.T) {
+		memStorage := storage.NewMemStorage()
+		ts := httptest.NewServer(NewMetricsRouter(memStorage).Routes())
+		defer ts.Close()
+
+		resp := post(t, ts)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, memStorage.List(context.Background()), IngestChunkSize*2)
+	})
+
+	t.Run("signed body is buffered up to the limit", func(t *testing.T) {
+		memStorage := storage.NewMemStorage()
+		ts := httptest.NewServer(NewMetricsRouter(memStorage, WithMaxIngestSize(int64(len(reqBody)/2))).Routes())
+		defer ts.Close()
+
+		resp := post(t, ts)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		assert.Empty(t, memStorage.List(context.Background()), "no chunk is stored before the signature is verified")
+	})
+}
+
+func TestMetricsHandler_IngestMetricsChunks(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	router := NewMetricsRouter(memStorage)
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	linesCount := IngestChunkSize*2 + 17
+
+	buf := bytes.NewBuffer(nil)
+	zb := gzip.NewWriter(buf)
+	for i := 0; i < linesCount; i++ {
+		_, err := fmt.Fprintf(zb, "{\"id\": \"chunk_%d\", \"value\": %d, \"type\": \"gauge\"}\n", i, i)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zb.Close())
+
+	r := httptest.NewRequest(http.MethodPost, ts.URL+ingestPath, buf)
+	r.RequestURI = ""
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, memStorage.List(context.Background()), linesCount)
+}
@@ -1,63 +1,58 @@
 package metrics
 
 import (
+	"embed"
 	"github.com/rshafikov/alertme/internal/server/errmsg"
 	"github.com/rshafikov/alertme/internal/server/logger"
 	"github.com/rshafikov/alertme/internal/server/models"
 	"html/template"
+	"io/fs"
 	"net/http"
+	"sort"
 )
 
-// ListMetrics generates an HTML page displaying a table of all available metrics.
-// It queries the store for metrics, converts them to plain format, and renders them using a template.
+//go:embed web
+var webFS embed.FS
+
+// staticFS holds the dashboard scripts and styles served under /static/.
+var staticFS, _ = fs.Sub(webFS, "web/static")
+
+var dashboardTemplate = template.Must(template.ParseFS(webFS, "web/index.html"))
+
+// dashboardPage is the data rendered into the dashboard template.
+type dashboardPage struct {
+	Metrics []models.PlainMetric
+	Live    bool
+}
+
+// ListMetrics generates an HTML dashboard displaying a table of all available metrics.
+// It queries the store for metrics, converts them to plain format, and renders them using
+// the embedded template. When live updates are enabled, the page subscribes to them over WebSocket.
 // The response is sent as an HTML document with HTTP status 200 on success.
 // In case of errors, it logs and sends an appropriate HTTP error response.
 func (h *Router) ListMetrics(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	metrics := h.store.List(ctx)
-
-	var plainMetrics []models.PlainMetric
-	for _, metric := range metrics {
-		plainMetrics = append(plainMetrics, *metric.ConvertToPlain())
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Type != metrics[j].Type {
+			return metrics[i].Type < metrics[j].Type
+		}
+		return metrics[i].Name < metrics[j].Name
+	})
+
+	page := dashboardPage{
+		Metrics: make([]models.PlainMetric, 0, len(metrics)),
+		Live:    h.hub != nil,
 	}
-
-	const tmpl = `
-	<!DOCTYPE html>
-	<html lang="en">
-	<head>
-		<meta charset="UTF-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1.0">
-		<title>Metrics</title>
-		<style>
-			body { font-family: Arial, sans-serif; margin: 20px; }
-			table { border-collapse: collapse; width: 50%; }
-			th, td { border: 1px solid black; padding: 8px; text-align: left; }
-			th { background-color: #f2f2f2; }
-		</style>
-	</head>
-	<body>
-		<h1>Metrics List</h1>
-		<table>
-			<tr><th>Type</th><th>Name</th><th>Value</th></tr>
-			{{range .}}
-				<tr><td>{{.Type}}</td><td>{{.Name}}</td><td>{{.Value}}</td></tr>
-			{{end}}
-		</table>
-	</body>
-	</html>`
-
-	t, err := template.New("metrics").Parse(tmpl)
-	if err != nil {
-		logger.Log.Debug(errmsg.UnableToParseTemplate)
-		http.Error(w, errmsg.UnableToParseTemplate, http.StatusInternalServerError)
-		return
+	for _, metric := range metrics {
+		page.Metrics = append(page.Metrics, *metric.ConvertToPlain())
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 
-	err = t.Execute(w, plainMetrics)
+	err := dashboardTemplate.Execute(w, page)
 	if err != nil {
 		logger.Log.Debug(errmsg.UnableToWriteTemplate)
 		http.Error(w, errmsg.UnableToWriteTemplate, http.StatusInternalServerError)
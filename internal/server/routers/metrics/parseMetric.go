@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/middlewares"
 	"github.com/rshafikov/alertme/internal/server/models"
 	"net/http"
 )
@@ -42,7 +43,8 @@ func (h *Router) ParseMetricFromJSON(r *http.Request) (*models.Metric, int, erro
 
 	dec := json.NewDecoder(r.Body)
 	if err := dec.Decode(&reqMetric); err != nil {
-		return nil, http.StatusBadRequest, errors.New(errmsg.UnableToDecodeJSON)
+		code, decodeErr := decodeErrorCode(err)
+		return nil, code, decodeErr
 	}
 
 	errCode, err := h.baseMetricValidation(reqMetric.Name, reqMetric.Type)
@@ -79,14 +81,40 @@ func (h *Router) baseMetricValidation(metricName string, metricType models.Metri
 }
 
 // ParseMetricsFromJSON parses JSON from an HTTP request to extract a list of metrics.
+// The list is decoded one metric at a time, so a batch over the configured maximum size is rejected
+// with 413 Request Entity Too Large without being decoded in full.
 // Returns the metrics, an HTTP status code, and an error if any issues occur during parsing or validation.
 func (h *Router) ParseMetricsFromJSON(r *http.Request) ([]*models.Metric, int, error) {
 	var reqMetrics []*models.Metric
 
 	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&reqMetrics); err != nil {
+	tok, err := dec.Token()
+	if err != nil {
+		code, decodeErr := decodeErrorCode(err)
+		return nil, code, decodeErr
+	}
+	if tok == nil {
+		return reqMetrics, http.StatusOK, nil
+	}
+	if tok != json.Delim('[') {
 		return nil, http.StatusBadRequest, errors.New(errmsg.UnableToDecodeJSON)
 	}
+	for dec.More() {
+		if h.maxBatch > 0 && len(reqMetrics) == h.maxBatch {
+			return nil, http.StatusRequestEntityTooLarge, errors.New(errmsg.TooManyMetrics)
+		}
+		var reqMetric *models.Metric
+		if err = dec.Decode(&reqMetric); err != nil {
+			code, decodeErr := decodeErrorCode(err)
+			return nil, code, decodeErr
+		}
+		reqMetrics = append(reqMetrics, reqMetric)
+	}
+	if _, err = dec.Token(); err != nil {
+		code, decodeErr := decodeErrorCode(err)
+		return nil, code, decodeErr
+	}
+
 	for _, reqMetric := range reqMetrics {
 		if reqMetric == nil {
 			return nil, http.StatusBadRequest, errors.New(errmsg.InvalidMetricValue)
@@ -98,3 +126,38 @@ func (h *Router) ParseMetricsFromJSON(r *http.Request) ([]*models.Metric, int, e
 	}
 	return reqMetrics, http.StatusOK, nil
 }
+
+// ParseMetricFromLine decodes a single NDJSON line into a metric.
+// Unlike ParseMetricsFromJSON, the metric must carry a value matching its type,
+// since every line of a stream is stored as is.
+func (h *Router) ParseMetricFromLine(line []byte) (*models.Metric, error) {
+	var reqMetric models.Metric
+	if err := json.Unmarshal(line, &reqMetric); err != nil {
+		return nil, errors.New(errmsg.UnableToDecodeJSON)
+	}
+
+	if _, err := h.baseMetricValidation(reqMetric.Name, reqMetric.Type); err != nil {
+		return nil, err
+	}
+
+	switch reqMetric.Type {
+	case models.CounterType:
+		if reqMetric.Delta == nil {
+			return nil, errors.New(errmsg.InvalidMetricValue)
+		}
+	case models.GaugeType:
+		if reqMetric.Value == nil {
+			return nil, errors.New(errmsg.InvalidMetricValue)
+		}
+	}
+
+	return &reqMetric, nil
+}
+
+// decodeErrorCode returns the HTTP status code and the error for a request body that cannot be decoded.
+func decodeErrorCode(err error) (int, error) {
+	if middlewares.BodyTooLarge(err) {
+		return http.StatusRequestEntityTooLarge, errors.New(errmsg.RequestTooLarge)
+	}
+	return http.StatusBadRequest, errors.New(errmsg.UnableToDecodeJSON)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"encoding/json"
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/query"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// QueryMetrics evaluates the expression passed in the "expr" query parameter
+// and responds with the result in JSON. See package query for the syntax.
+// Responds with 400 if the expression is missing, malformed or cannot be evaluated.
+func (h *Router) QueryMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	expr := r.URL.Query().Get("expr")
+	if expr == "" {
+		logger.Log.Debug(errmsg.QueryRequired)
+		http.Error(w, errmsg.QueryRequired, http.StatusBadRequest)
+		return
+	}
+
+	var hist query.HistoryReader
+	if h.history != nil {
+		hist = h.history
+	}
+
+	result, queryErr := query.NewEvaluator(h.store, hist).Query(ctx, expr)
+	if queryErr != nil {
+		logger.Log.Debug("unable to evaluate query", zap.String("expr", expr), zap.Error(queryErr))
+		http.Error(w, queryErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonBytes, encodeErr := json.Marshal(result)
+	if encodeErr != nil {
+		logger.Log.Debug(errmsg.UnableToEncodeJSON)
+		http.Error(w, encodeErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, writeErr := w.Write(jsonBytes)
+	if writeErr != nil {
+		logger.Log.Debug(errmsg.UnableToWriteResponse)
+		return
+	}
+}
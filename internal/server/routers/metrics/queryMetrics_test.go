@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler_QueryMetrics(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	router := NewMetricsRouter(memStorage)
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	var notCompress bool
+	client := NewHTTPClient(ts.URL, notCompress)
+
+	err := FillStorageWithTestData(memStorage, []models.PlainMetric{
+		{Name: "CPUutilization0", Type: models.GaugeType, Value: "12.5"},
+		{Name: "CPUutilization1", Type: models.GaugeType, Value: "7.5"},
+		{Name: "PollCount", Type: models.CounterType, Value: "3"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		expr         string
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			name:         "aggregate",
+			expr:         "sum(CPUutilization*)",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"type": "scalar", "result": 20}`,
+		},
+		{
+			name:         "select",
+			expr:         `*{type="counter"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"type": "vector", "result": [{"id": "PollCount", "type": "counter", "value": 3}]}`,
+		},
+		{
+			name:         "missing expression",
+			expr:         "",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: errmsg.QueryRequired,
+		},
+		{
+			name:         "syntax error",
+			expr:         "sum(",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "rate without history",
+			expr:         "rate(PollCount)",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, respBody := client.URLRequest(t, http.MethodGet, "/query?expr="+url.QueryEscape(test.expr))
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+			switch {
+			case test.expectedCode == http.StatusOK:
+				assert.JSONEq(t, test.expectedBody, respBody)
+			case test.expectedBody != "":
+				assert.Equal(t, test.expectedBody, strings.Trim(respBody, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"encoding/json"
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"net/http"
+)
+
+// rejectionMetricPrefix prefixes the names of counts of requests rejected by the signature checks,
+// e.g. RejectedSignatureMissing.
+const rejectionMetricPrefix = "RejectedSignature"
+
+// ListRejections responds with the number of requests rejected by the signature checks since the server started,
+// by reason, as a JSON object, e.g. {"RejectedSignatureMissing": 2}.
+func (h *Router) ListRejections(w http.ResponseWriter, _ *http.Request) {
+	counts := make(map[string]int64)
+	for reason, count := range h.rejections.Counts() {
+		counts[rejectionMetricPrefix+reason] = count
+	}
+
+	jsonBytes, encodeErr := json.Marshal(counts)
+	if encodeErr != nil {
+		logger.Log.Debug(errmsg.UnableToEncodeJSON)
+		http.Error(w, encodeErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, writeErr := w.Write(jsonBytes); writeErr != nil {
+		logger.Log.Debug(errmsg.UnableToWriteResponse)
+	}
+}
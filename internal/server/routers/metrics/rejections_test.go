@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/middlewares"
+	"github.com/rshafikov/alertme/internal/server/settings"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRouter_ListRejections(t *testing.T) {
+	originalKey := settings.CONF.Key
+	defer func() {
+		settings.CONF.Key = originalKey
+	}()
+	settings.CONF.Key = "rejections key"
+
+	counter := middlewares.NewRejectionCounter()
+	ts := httptest.NewServer(NewMetricsRouter(storage.NewMemStorage(), WithStrictSignatures(true), WithRejectionCounter(counter)).Routes())
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(ts.URL+"/update/gauge/rj_1/1", "text/plain", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp, err := http.Get(ts.URL + "/admin/rejections")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var counts map[string]int64
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&counts))
+	assert.Equal(t, int64(2), counts["RejectedSignatureMissing"])
+	assert.Equal(t, int64(0), counts["RejectedSignatureInvalid"])
+	assert.Equal(t, int64(2), counter.Counts()[middlewares.RejectMissing])
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/logger"
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/rshafikov/alertme/internal/server/pubsub"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// StreamHeartbeatInterval is the interval between keep-alive comments sent to idle SSE clients.
+const StreamHeartbeatInterval = 15 * time.Second
+
+// StreamMetrics pushes every accepted metric update to the client as a Server-Sent Event.
+// Updates can be narrowed with the optional "type" and "prefix" query parameters.
+// Each event is named "metric" and carries the metric in JSON.
+// The stream ends when the client disconnects or falls too far behind.
+func (h *Router) StreamMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	filter, err := parseStreamFilter(r)
+	if err != nil {
+		logger.Log.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	sub := h.hub.Subscribe(filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		logger.Log.Debug("streaming is not supported", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+
+		case batch, ok := <-sub.Updates():
+			if !ok {
+				logger.Log.Debug("stream subscription closed")
+				return
+			}
+			for _, m := range batch {
+				data, encodeErr := json.Marshal(m)
+				if encodeErr != nil {
+					logger.Log.Debug(errmsg.UnableToEncodeJSON, zap.Error(encodeErr))
+					continue
+				}
+				if _, err = fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data); err != nil {
+					logger.Log.Debug(errmsg.UnableToWriteResponse, zap.Error(err))
+					return
+				}
+			}
+		}
+
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func parseStreamFilter(r *http.Request) (pubsub.Filter, error) {
+	filter := pubsub.Filter{
+		Type:   models.MetricType(r.URL.Query().Get("type")),
+		Prefix: r.URL.Query().Get("prefix"),
+	}
+	if filter.Type != "" && filter.Type != models.GaugeType && filter.Type != models.CounterType {
+		return filter, errors.New(errmsg.InvalidMetricType)
+	}
+	return filter, nil
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rshafikov/alertme/internal/server/pubsub"
+	"github.com/rshafikov/alertme/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler_StreamMetrics(t *testing.T) {
+	hub := pubsub.NewHub(pubsub.DefaultBufferSize)
+	store := storage.NewPublishingStorage(storage.NewMemStorage(), hub)
+	router := NewMetricsRouter(store, WithHub(hub))
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	t.Run("invalid type filter", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/stream?type=gague")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("receive filtered updates", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?type=gauge&prefix=CPU", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		require.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+		for _, path := range []string{"/update/gauge/Alloc/1", "/update/counter/CPUcount/1", "/update/gauge/CPUutilization1/42.5"} {
+			post, postErr := http.Post(ts.URL+path, "", nil)
+			require.NoError(t, postErr)
+			post.Body.Close()
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		event, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		data, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		assert.Equal(t, "event: metric", strings.TrimSpace(event))
+		assert.JSONEq(t, `{"id": "CPUutilization1", "type": "gauge", "value": 42.5}`, strings.TrimPrefix(strings.TrimSpace(data), "data: "))
+	})
+
+	t.Run("subscription is released on disconnect", func(t *testing.T) {
+		assert.Eventually(t, func() bool { return hub.Len() == 0 }, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestMetricsHandler_StreamDisabledWithoutHub(t *testing.T) {
+	router := NewMetricsRouter(storage.NewMemStorage())
+	ts := httptest.NewServer(router.Routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,222 @@
+(function () {
+	"use strict";
+
+	var MAX_POINTS = 60;
+	var SPARK_WIDTH = 120;
+	var SPARK_HEIGHT = 24;
+
+	var metrics = {};
+	var sortKey = "name";
+	var sortDir = 1;
+
+	var tbody = document.querySelector("#metrics tbody");
+	var statusEl = document.getElementById("status");
+	var filterEl = document.getElementById("filter");
+	var typeEl = document.getElementById("type-filter");
+	var countEl = document.getElementById("count");
+
+	function key(m) {
+		return m.type + "-" + m.id;
+	}
+
+	function valueOf(m) {
+		return m.type === "counter" ? m.delta : m.value;
+	}
+
+	function format(v) {
+		if (v === undefined || v === null) {
+			return "";
+		}
+		return String(Math.round(v * 1e7) / 1e7);
+	}
+
+	function readInitialRows() {
+		tbody.querySelectorAll("tr").forEach(function (tr) {
+			var cells = tr.querySelectorAll("td");
+			var v = parseFloat(cells[2].textContent);
+			var m = { id: tr.dataset.name, type: tr.dataset.type, history: [] };
+			if (m.type === "counter") {
+				m.delta = v;
+			} else {
+				m.value = v;
+			}
+			metrics[key(m)] = m;
+		});
+	}
+
+	function sparkline(points) {
+		if (!points || points.length < 2) {
+			return "";
+		}
+		var min = Infinity;
+		var max = -Infinity;
+		points.forEach(function (p) {
+			min = Math.min(min, p.v);
+			max = Math.max(max, p.v);
+		});
+		var span = max - min || 1;
+		var step = SPARK_WIDTH / (points.length - 1);
+		var coords = points.map(function (p, i) {
+			var x = (i * step).toFixed(1);
+			var y = (SPARK_HEIGHT - 1 - ((p.v - min) / span) * (SPARK_HEIGHT - 2)).toFixed(1);
+			return x + "," + y;
+		});
+		return '<svg class="spark" width="' + SPARK_WIDTH + '" height="' + SPARK_HEIGHT + '">' +
+			'<polyline points="' + coords.join(" ") + '"/></svg>';
+	}
+
+	function compare(a, b) {
+		var x;
+		var y;
+		if (sortKey === "value") {
+			x = valueOf(a);
+			y = valueOf(b);
+		} else if (sortKey === "type") {
+			x = a.type + a.id;
+			y = b.type + b.id;
+		} else {
+			x = a.id.toLowerCase();
+			y = b.id.toLowerCase();
+		}
+		if (x < y) {
+			return -sortDir;
+		}
+		if (x > y) {
+			return sortDir;
+		}
+		return 0;
+	}
+
+	function visible(m) {
+		var text = filterEl.value.trim().toLowerCase();
+		if (typeEl.value && m.type !== typeEl.value) {
+			return false;
+		}
+		return !text || m.id.toLowerCase().indexOf(text) !== -1;
+	}
+
+	function render(changed) {
+		var list = Object.keys(metrics).map(function (k) {
+			return metrics[k];
+		}).filter(visible).sort(compare);
+
+		var rows = document.createDocumentFragment();
+		list.forEach(function (m) {
+			var tr = document.createElement("tr");
+			var cells = [m.type, m.id, format(valueOf(m))];
+			cells.forEach(function (text, i) {
+				var td = document.createElement("td");
+				td.textContent = text;
+				if (i === 2) {
+					td.className = "num";
+				}
+				tr.appendChild(td);
+			});
+			var spark = document.createElement("td");
+			spark.innerHTML = sparkline(m.history);
+			tr.appendChild(spark);
+			if (changed && changed[key(m)]) {
+				tr.className = "flash";
+			}
+			rows.appendChild(tr);
+		});
+		tbody.replaceChildren(rows);
+		countEl.textContent = list.length + " metrics";
+
+		if (changed) {
+			requestAnimationFrame(function () {
+				tbody.querySelectorAll("tr.flash").forEach(function (tr) {
+					tr.className = "";
+				});
+			});
+		}
+	}
+
+	function applySnapshot(list) {
+		metrics = {};
+		list.forEach(function (m) {
+			m.history = m.history || [];
+			metrics[key(m)] = m;
+		});
+		render();
+	}
+
+	function applyUpdate(list) {
+		var changed = {};
+		var now = new Date().toISOString();
+		list.forEach(function (m) {
+			var k = key(m);
+			var prev = metrics[k];
+			m.history = prev ? prev.history : [];
+			m.history.push({ t: now, v: valueOf(m) });
+			if (m.history.length > MAX_POINTS) {
+				m.history.splice(0, m.history.length - MAX_POINTS);
+			}
+			metrics[k] = m;
+			changed[k] = true;
+		});
+		render(changed);
+	}
+
+	function setStatus(text, cls) {
+		statusEl.textContent = text;
+		statusEl.className = "status " + cls;
+	}
+
+	function connect(delay) {
+		var proto = location.protocol === "https:" ? "wss://" : "ws://";
+		var query = "";
+		var token = new URLSearchParams(location.search).get("access_token");
+		if (token) {
+			query = "?access_token=" + encodeURIComponent(token);
+		}
+		var ws = new WebSocket(proto + location.host + "/ws" + query);
+
+		ws.onopen = function () {
+			delay = 1000;
+			setStatus("live", "live");
+		};
+		ws.onmessage = function (ev) {
+			var msg = JSON.parse(ev.data);
+			if (msg.kind === "snapshot") {
+				applySnapshot(msg.metrics || []);
+			} else if (msg.kind === "update") {
+				applyUpdate(msg.metrics || []);
+			}
+		};
+		ws.onclose = function () {
+			setStatus("reconnecting…", "offline");
+			setTimeout(function () {
+				connect(Math.min(delay * 2, 30000));
+			}, delay);
+		};
+	}
+
+	document.querySelectorAll("th[data-sort]").forEach(function (th) {
+		th.addEventListener("click", function () {
+			if (sortKey === th.dataset.sort) {
+				sortDir = -sortDir;
+			} else {
+				sortKey = th.dataset.sort;
+				sortDir = 1;
+			}
+			document.querySelectorAll("th[data-sort]").forEach(function (other) {
+				other.classList.remove("asc", "desc");
+			});
+			th.classList.add(sortDir > 0 ? "asc" : "desc");
+			render();
+		});
+	});
+	filterEl.addEventListener("input", function () {
+		render();
+	});
+	typeEl.addEventListener("change", function () {
+		render();
+	});
+
+	readInitialRows();
+	render();
+	if (statusEl.dataset.live === "true") {
+		connect(1000);
+	}
+})();
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strings"
 )
 
 // InitServerConfiguration initializes the server configuration by processing command-line flags
@@ -48,17 +49,114 @@ func InitServerConfiguration() {
 		if ServerEnv.Key != "" {
 			CONF.Key = ServerEnv.Key
 		}
+
+		if ServerEnv.ReplayWindow > 0 {
+			CONF.ReplayWindow = ServerEnv.ReplayWindow
+		}
+
+		if ServerEnv.MaxBodySize >= 0 {
+			CONF.MaxBodySize = ServerEnv.MaxBodySize
+		}
+
+		if ServerEnv.MaxIngestSize >= 0 {
+			CONF.MaxIngestSize = ServerEnv.MaxIngestSize
+		}
+
+		if ServerEnv.MaxBatchSize >= 0 {
+			CONF.MaxBatchSize = ServerEnv.MaxBatchSize
+		}
+
+		if ServerEnv.RateLimit > 0 {
+			CONF.RateLimit = ServerEnv.RateLimit
+		}
+
+		if ServerEnv.RateBurst > 0 {
+			CONF.RateBurst = ServerEnv.RateBurst
+		}
+
+		if ServerEnv.CompressMinSize >= 0 {
+			CONF.CompressMinSize = ServerEnv.CompressMinSize
+		}
+
+		if ServerEnv.StrictSignatures {
+			CONF.StrictSignatures = ServerEnv.StrictSignatures
+		}
+
+		if ServerEnv.RequireNonce {
+			CONF.RequireNonce = ServerEnv.RequireNonce
+		}
+
+		if ServerEnv.KeyRegistry != "" {
+			CONF.KeyRegistry = ServerEnv.KeyRegistry
+		}
+
+		if ServerEnv.AuthTokens != "" {
+			CONF.AuthTokens = ServerEnv.AuthTokens
+		}
+
+		if ServerEnv.AuditFile != "" {
+			CONF.AuditFile = ServerEnv.AuditFile
+		}
+
+		if ServerEnv.AuditURL != "" {
+			CONF.AuditURL = ServerEnv.AuditURL
+		}
+
+		if ServerEnv.GRPCAddress != "" {
+			CONF.GRPCAddress = ServerEnv.GRPCAddress
+		}
+
+		if ServerEnv.CryptoKey != "" {
+			CONF.CryptoKey = ServerEnv.CryptoKey
+		}
+
+		if ServerEnv.TLSCert != "" {
+			CONF.TLSCert = ServerEnv.TLSCert
+		}
+
+		if ServerEnv.TLSKey != "" {
+			CONF.TLSKey = ServerEnv.TLSKey
+		}
+
+		if ServerEnv.TLSClientCA != "" {
+			CONF.TLSClientCA = ServerEnv.TLSClientCA
+		}
+
+		if ServerEnv.TrustedSubnet != "" {
+			CONF.TrustedSubnet = ServerEnv.TrustedSubnet
+		}
+	}
+
+	if CONF.TrustedSubnet != "" {
+		if _, _, err := net.ParseCIDR(CONF.TrustedSubnet); err != nil {
+			log.Fatal("invalid trusted subnet: ", CONF.TrustedSubnet)
+		}
 	}
 
 	initMessage := "\033[1;36m╭────────────────────────────────────────\033[0m\n" +
 		"\033[1;36m│ \033[1;34m🚀 Server Initialized Successfully \033[0m\n" +
 		"\033[1;36m├────────────────────────────────────────\033[0m\n" +
 		"\033[1;36m│ \033[1;33m📡 Server Address:  \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📡 gRPC Address:    \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m│ \033[1;33m⏱️ Store Interval:  \033[0;37m%-39d\033[0m\n" +
 		"\033[1;36m│ \033[1;33m💾 File Storage:    \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m│ \033[1;33m🔄 Restore State:   \033[0;37m%-39t\033[0m\n" +
 		"\033[1;36m│ \033[1;33m🐘 Database DSN:    \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m│ \033[1;33m🔐 Hash Key:        \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m✍️ Strict Signing:  \033[0;37m%-39t\033[0m\n" +
+		"\033[1;36m│ \033[1;33m✍️ Require Nonce:   \033[0;37m%-39t\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🗝  Key Registry:    \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🎫 Auth Tokens:     \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📜 Audit:           \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m⏱️ Replay Window:   \033[0;37m%-39d\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📦 Max Body Size:   \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📦 Max Ingest Size: \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m📦 Max Batch Size:  \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🚦 Rate Limit:      \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🗜  Compress From:   \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🔑 Crypto Key:      \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🔒 TLS:             \033[0;37m%-39s\033[0m\n" +
+		"\033[1;36m│ \033[1;33m🛡  Trusted Subnet:  \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m│ \033[1;33m📝 Logging Level:   \033[0;37m%-39s\033[0m\n" +
 		"\033[1;36m╰────────────────────────────────────────\033[0m\n"
 
@@ -72,14 +170,93 @@ func InitServerConfiguration() {
 		keyInitMessage = "********"
 	}
 
+	keyRegistryMessage := "-----"
+	if CONF.KeyRegistry != "" {
+		keyRegistryMessage = CONF.KeyRegistry
+	}
+
+	authTokensMessage := "-----"
+	if CONF.AuthTokens != "" {
+		authTokensMessage = CONF.AuthTokens
+	}
+
+	var auditTargets []string
+	for _, target := range []string{CONF.AuditFile, CONF.AuditURL} {
+		if target != "" {
+			auditTargets = append(auditTargets, target)
+		}
+	}
+	auditMessage := "-----"
+	if len(auditTargets) > 0 {
+		auditMessage = strings.Join(auditTargets, ", ")
+	}
+
+	cryptoKeyMessage := "-----"
+	if CONF.CryptoKey != "" {
+		cryptoKeyMessage = CONF.CryptoKey
+	}
+
+	tlsMessage := "-----"
+	if CONF.TLSCert != "" {
+		tlsMessage = CONF.TLSCert
+		if CONF.TLSClientCA != "" {
+			tlsMessage += " (mutual)"
+		}
+	}
+
+	trustedSubnetMessage := "-----"
+	if CONF.TrustedSubnet != "" {
+		trustedSubnetMessage = CONF.TrustedSubnet
+	}
+
+	maxBodySizeMessage := "-----"
+	if CONF.MaxBodySize > 0 {
+		maxBodySizeMessage = fmt.Sprintf("%d bytes", CONF.MaxBodySize)
+	}
+
+	maxIngestSizeMessage := "-----"
+	if CONF.MaxIngestSize > 0 {
+		maxIngestSizeMessage = fmt.Sprintf("%d bytes", CONF.MaxIngestSize)
+	}
+
+	maxBatchSizeMessage := "-----"
+	if CONF.MaxBatchSize > 0 {
+		maxBatchSizeMessage = fmt.Sprintf("%d metrics", CONF.MaxBatchSize)
+	}
+
+	rateLimitMessage := "-----"
+	if CONF.RateLimit > 0 {
+		rateLimitMessage = fmt.Sprintf("%g/s, burst %d", CONF.RateLimit, CONF.RateBurst)
+	}
+
+	grpcAddressMessage := "-----"
+	if CONF.GRPCAddress != "" {
+		grpcAddressMessage = CONF.GRPCAddress
+	}
+
 	fmt.Printf(
 		initMessage,
 		CONF.ServerAddress.String(),
+		grpcAddressMessage,
 		CONF.StoreInterval,
 		CONF.FileStoragePath,
 		CONF.Restore,
 		dbURLMessage,
 		keyInitMessage,
+		CONF.StrictSignatures,
+		CONF.RequireNonce,
+		keyRegistryMessage,
+		authTokensMessage,
+		auditMessage,
+		CONF.ReplayWindow,
+		maxBodySizeMessage,
+		maxIngestSizeMessage,
+		maxBatchSizeMessage,
+		rateLimitMessage,
+		fmt.Sprintf("%d bytes", CONF.CompressMinSize),
+		cryptoKeyMessage,
+		tlsMessage,
+		trustedSubnetMessage,
 		CONF.LogLevel,
 	)
 }
@@ -6,13 +6,32 @@ import (
 )
 
 type envServerConfig struct {
-	ServerAddress   string `env:"ADDRESS"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	DatabaseURL     string `env:"DATABASE_DSN"`
-	Key             string `env:"KEY"`
-	LogLevel        string `env:"LOG_LEVEL"`
-	StoreInteval    int    `env:"STORE_INTERVAL" envDefault:"-1"`
-	Restore         bool   `env:"RESTORE"`
+	ServerAddress    string  `env:"ADDRESS"`
+	FileStoragePath  string  `env:"FILE_STORAGE_PATH"`
+	DatabaseURL      string  `env:"DATABASE_DSN"`
+	Key              string  `env:"KEY"`
+	KeyRegistry      string  `env:"KEY_REGISTRY"`
+	AuthTokens       string  `env:"AUTH_TOKENS"`
+	AuditFile        string  `env:"AUDIT_FILE"`
+	AuditURL         string  `env:"AUDIT_URL"`
+	GRPCAddress      string  `env:"GRPC_ADDRESS"`
+	CryptoKey        string  `env:"CRYPTO_KEY"`
+	TLSCert          string  `env:"TLS_CERT"`
+	TLSKey           string  `env:"TLS_KEY"`
+	TLSClientCA      string  `env:"TLS_CLIENT_CA"`
+	TrustedSubnet    string  `env:"TRUSTED_SUBNET"`
+	LogLevel         string  `env:"LOG_LEVEL"`
+	StoreInteval     int     `env:"STORE_INTERVAL" envDefault:"-1"`
+	ReplayWindow     int     `env:"REPLAY_WINDOW"`
+	MaxBodySize      int64   `env:"MAX_BODY_SIZE" envDefault:"-1"`
+	MaxIngestSize    int64   `env:"MAX_INGEST_SIZE" envDefault:"-1"`
+	MaxBatchSize     int     `env:"MAX_BATCH_SIZE" envDefault:"-1"`
+	RateLimit        float64 `env:"RATE_LIMIT"`
+	RateBurst        int     `env:"RATE_BURST"`
+	CompressMinSize  int     `env:"COMPRESS_MIN_SIZE" envDefault:"-1"`
+	Restore          bool    `env:"RESTORE"`
+	StrictSignatures bool    `env:"STRICT_SIGNATURES"`
+	RequireNonce     bool    `env:"REQUIRE_NONCE"`
 }
 
 // ServerEnv holds the configuration values loaded from environment variables.
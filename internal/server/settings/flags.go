@@ -9,6 +9,9 @@ import (
 	"strings"
 )
 
+// KeyRegistryDB is the KeyRegistry value selecting the database-backed key registry.
+const KeyRegistryDB = "db"
+
 const (
 	defaultHost            = "localhost"
 	defaultHostPort        = "8080"
@@ -17,6 +20,12 @@ const (
 	defaultRestore         = false
 	defaultLogLevel        = "info"
 	defaultProfiling       = false
+	defaultReplayWindow    = 300
+	defaultMaxBodySize     = 32 << 20
+	defaultMaxIngestSize   = 1 << 30
+	defaultMaxBatchSize    = 10_000
+	defaultRateBurst       = 20
+	defaultCompressMinSize = 1024
 )
 
 type serverConfig struct {
@@ -26,8 +35,27 @@ type serverConfig struct {
 	LogLevel         string
 	Key              string
 	DatabaseURL      string
+	GRPCAddress      string
+	CryptoKey        string
+	TLSCert          string
+	TLSKey           string
+	TLSClientCA      string
+	TrustedSubnet    string
+	KeyRegistry      string
+	AuthTokens       string
+	AuditFile        string
+	AuditURL         string
 	StoreInterval    int
+	ReplayWindow     int
+	MaxBodySize      int64
+	MaxIngestSize    int64
+	MaxBatchSize     int
+	RateLimit        float64
+	RateBurst        int
+	CompressMinSize  int
 	Profiling        bool
+	StrictSignatures bool
+	RequireNonce     bool
 	Restore          bool
 }
 
@@ -120,6 +148,12 @@ var CONF = serverConfig{
 	FileStoragePath:  defaultFileStoragePath,
 	Restore:          defaultRestore,
 	LogLevel:         defaultLogLevel,
+	ReplayWindow:     defaultReplayWindow,
+	MaxBodySize:      defaultMaxBodySize,
+	MaxIngestSize:    defaultMaxIngestSize,
+	MaxBatchSize:     defaultMaxBatchSize,
+	RateBurst:        defaultRateBurst,
+	CompressMinSize:  defaultCompressMinSize,
 	DatabaseURL:      "",
 	Key:              "",
 }
@@ -138,6 +172,25 @@ func InitServerFlags() {
 	flag.BoolVar(&CONF.Restore, "r", defaultRestore, "restore metrics from file, specified in the storage path")
 	flag.StringVar(&CONF.LogLevel, "l", defaultLogLevel, "log level")
 	flag.StringVar(&CONF.Key, "k", "", "a key to sign transmitted data")
+	flag.StringVar(&CONF.KeyRegistry, "key-registry", "", `per-agent key registry: path to a JSON file, or "db" for the database`)
+	flag.BoolVar(&CONF.StrictSignatures, "strict-signatures", false, "require a valid signature on metric updates when a key is set")
+	flag.BoolVar(&CONF.RequireNonce, "require-nonce", false, "reject signed requests without a timestamp and a nonce, as sent by older agents")
+	flag.StringVar(&CONF.AuthTokens, "auth-tokens", "", "path to a JSON file with bearer tokens and their roles, authentication is disabled if empty")
+	flag.StringVar(&CONF.AuditFile, "audit-file", "", "path to the file to append the audit log of metric writes to")
+	flag.StringVar(&CONF.AuditURL, "audit-url", "", "URL to post the audit log of metric writes to")
+	flag.IntVar(&CONF.ReplayWindow, "replay-window", defaultReplayWindow, "allowed clock skew of signed requests, in seconds")
+	flag.Int64Var(&CONF.MaxBodySize, "max-body-size", defaultMaxBodySize, "maximum request body size, compressed or not, in bytes, unlimited if 0")
+	flag.Int64Var(&CONF.MaxIngestSize, "max-ingest-size", defaultMaxIngestSize, "maximum request body size of /ingest, compressed or not, in bytes, unlimited if 0")
+	flag.IntVar(&CONF.MaxBatchSize, "max-batch-size", defaultMaxBatchSize, "maximum number of metrics in a batch update, unlimited if 0")
+	flag.Float64Var(&CONF.RateLimit, "rate-limit", 0, "allowed metric updates per second per client, unlimited if 0")
+	flag.IntVar(&CONF.RateBurst, "rate-burst", defaultRateBurst, "allowed burst of metric updates per client")
+	flag.IntVar(&CONF.CompressMinSize, "compress-min-size", defaultCompressMinSize, "minimum response body size to compress, in bytes")
+	flag.StringVar(&CONF.GRPCAddress, "g", "", "gRPC server address, gRPC is disabled if empty")
+	flag.StringVar(&CONF.CryptoKey, "crypto-key", "", "path to the private key to decrypt agent payloads")
+	flag.StringVar(&CONF.TLSCert, "tls-cert", "", "path to the TLS certificate, HTTPS is disabled if empty")
+	flag.StringVar(&CONF.TLSKey, "tls-key", "", "path to the TLS private key")
+	flag.StringVar(&CONF.TLSClientCA, "tls-client-ca", "", "path to the CA bundle to verify client certificates (mutual TLS)")
+	flag.StringVar(&CONF.TrustedSubnet, "t", "", "trusted subnet of agents in CIDR notation, any address is trusted if empty")
 	flag.BoolVar(&CONF.Profiling, "pprof", defaultProfiling, "enanble profiling endpoint on /debug/pprof/")
 	flag.Parse()
 
@@ -145,5 +198,25 @@ func InitServerFlags() {
 		log.Fatal("store interval cannot be negative")
 	}
 
+	if CONF.ReplayWindow <= 0 {
+		log.Fatal("replay window must be positive")
+	}
+
+	if CONF.MaxBodySize < 0 || CONF.MaxIngestSize < 0 || CONF.MaxBatchSize < 0 {
+		log.Fatal("body and batch size limits cannot be negative")
+	}
+
+	if CONF.CompressMinSize < 0 {
+		log.Fatal("minimum compressed response size cannot be negative")
+	}
+
+	if CONF.RateLimit < 0 || CONF.RateBurst <= 0 {
+		log.Fatal("rate limit cannot be negative and rate burst must be positive")
+	}
+
+	if CONF.TLSClientCA != "" && CONF.TLSCert == "" {
+		log.Fatal("client certificate verification requires a TLS certificate")
+	}
+
 	CONF.DatabaseURL = CONF.DatabaseSettings.String()
 }
@@ -23,6 +23,14 @@ type BaseMetricStorage interface {
 	AddBatch(ctx context.Context, metrics []*models.Metric) error
 }
 
+// TotalsAdder is implemented by storages that report the metrics stored by a write,
+// so counters can be published with their new totals without reading them back.
+type TotalsAdder interface {
+	// AddBatchTotals adds metrics like AddBatch and returns the stored metrics in the same order,
+	// counters carrying their total after the write.
+	AddBatchTotals(ctx context.Context, metrics []*models.Metric) ([]*models.Metric, error)
+}
+
 // BaseMetricSaver defines the interface for saving and loading metrics to/from persistent storage.
 type BaseMetricSaver interface {
 	// LoadStorage loads metrics from persistent storage into memory.
@@ -37,3 +45,9 @@ type BaseMetricSaver interface {
 	// LoadMetrics loads metrics from persistent storage and returns them.
 	LoadMetrics() ([]*models.Metric, error)
 }
+
+// Publisher defines the interface for receiving metrics accepted by the storage.
+type Publisher interface {
+	// Publish delivers the provided metrics to subscribers. It must not block.
+	Publish(metrics ...*models.Metric)
+}
@@ -27,7 +27,8 @@ func (s *MemStorage) Add(ctx context.Context, m *models.Metric) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.addMetric(m)
+	_, err := s.addMetric(m)
+	return err
 }
 
 func (s *MemStorage) Get(ctx context.Context, metricType models.MetricType, metricName string) (*models.Metric, error) {
@@ -63,29 +64,39 @@ func (s *MemStorage) Clear(ctx context.Context) {
 }
 
 func (s *MemStorage) AddBatch(ctx context.Context, metrics []*models.Metric) error {
+	_, err := s.AddBatchTotals(ctx, metrics)
+	return err
+}
+
+// AddBatchTotals implements the TotalsAdder interface.
+func (s *MemStorage) AddBatchTotals(ctx context.Context, metrics []*models.Metric) ([]*models.Metric, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	stored := make([]*models.Metric, 0, len(metrics))
 	for _, metric := range metrics {
-		if err := s.addMetric(metric); err != nil {
-			return err
+		m, err := s.addMetric(metric)
+		if err != nil {
+			return nil, err
 		}
+		stored = append(stored, m.Clone())
 	}
-	return nil
+	return stored, nil
 }
 
-func (s *MemStorage) addMetric(m *models.Metric) error {
+// addMetric stores the metric and returns the stored metric.
+func (s *MemStorage) addMetric(m *models.Metric) (*models.Metric, error) {
 	existingMetric, exists := s.metrics[m.MapName()]
 
 	switch m.Type {
 	case models.GaugeType:
 		if m.Value == nil {
-			return errors.New("metric gauge value cannot be nil")
+			return nil, errors.New("metric gauge value cannot be nil")
 		}
 		s.metrics[m.MapName()] = m
 	case models.CounterType:
 		if m.Delta == nil {
-			return errors.New("metric counter delta cannot be nil")
+			return nil, errors.New("metric counter delta cannot be nil")
 		}
 		newDelta := *m.Delta
 		if exists {
@@ -97,8 +108,8 @@ func (s *MemStorage) addMetric(m *models.Metric) error {
 			Delta: &newDelta,
 		}
 	default:
-		return errors.New(errmsg.InvalidMetricType)
+		return nil, errors.New(errmsg.InvalidMetricType)
 	}
 
-	return nil
+	return s.metrics[m.MapName()], nil
 }
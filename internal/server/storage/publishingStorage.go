@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/rshafikov/alertme/internal/server/database"
+	"github.com/rshafikov/alertme/internal/server/errmsg"
+	"github.com/rshafikov/alertme/internal/server/models"
+)
+
+// PublishingStorage wraps a BaseMetricStorage and publishes every accepted write.
+// If the wrapped storage is a TotalsAdder, counters are published with the total stored by the write,
+// otherwise with the received delta.
+type PublishingStorage struct {
+	BaseMetricStorage
+	publishers []Publisher
+}
+
+// NewPublishingStorage creates a storage that publishes writes made to the given storage
+// to each of the provided publishers.
+func NewPublishingStorage(store BaseMetricStorage, publishers ...Publisher) *PublishingStorage {
+	return &PublishingStorage{
+		BaseMetricStorage: store,
+		publishers:        publishers,
+	}
+}
+
+// Add adds a metric to the wrapped storage and publishes it on success.
+func (s *PublishingStorage) Add(ctx context.Context, m *models.Metric) error {
+	if _, ok := s.BaseMetricStorage.(TotalsAdder); ok {
+		return s.AddBatch(ctx, []*models.Metric{m})
+	}
+	if err := s.BaseMetricStorage.Add(ctx, m); err != nil {
+		return err
+	}
+	s.publish([]*models.Metric{m})
+	return nil
+}
+
+// AddBatch adds metrics to the wrapped storage and publishes them on success.
+func (s *PublishingStorage) AddBatch(ctx context.Context, metrics []*models.Metric) error {
+	store, ok := s.BaseMetricStorage.(TotalsAdder)
+	if !ok {
+		if err := s.BaseMetricStorage.AddBatch(ctx, metrics); err != nil {
+			return err
+		}
+		s.publish(metrics)
+		return nil
+	}
+
+	stored, err := store.AddBatchTotals(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	s.publish(stored)
+	return nil
+}
+
+// Ping checks the wrapped storage if it supports pinging.
+func (s *PublishingStorage) Ping(ctx context.Context) error {
+	db, ok := s.BaseMetricStorage.(database.Pinger)
+	if !ok {
+		return errors.New(errmsg.UnableToPingDB)
+	}
+	return db.Ping(ctx)
+}
+
+func (s *PublishingStorage) publish(metrics []*models.Metric) {
+	updates := make([]*models.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		updates = append(updates, m.Clone())
+	}
+	for _, p := range s.publishers {
+		p.Publish(updates...)
+	}
+}
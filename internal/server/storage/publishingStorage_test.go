@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rshafikov/alertme/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	published []*models.Metric
+}
+
+func (p *recordingPublisher) Publish(metrics ...*models.Metric) {
+	p.published = append(p.published, metrics...)
+}
+
+func TestPublishingStorage(t *testing.T) {
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	store := NewPublishingStorage(NewMemStorage(), publisher)
+
+	t.Run("add publishes gauge", func(t *testing.T) {
+		m, err := models.NewMetric(models.GaugeType, "g", "1.5")
+		require.NoError(t, err)
+		require.NoError(t, store.Add(ctx, m))
+
+		require.Len(t, publisher.published, 1)
+		assert.EqualValues(t, 1.5, *publisher.published[0].Value)
+	})
+
+	t.Run("batch publishes counter totals", func(t *testing.T) {
+		publisher.published = nil
+		m1, err := models.NewMetric(models.CounterType, "c", "2")
+		require.NoError(t, err)
+		m2, err := models.NewMetric(models.CounterType, "c", "3")
+		require.NoError(t, err)
+		require.NoError(t, store.AddBatch(ctx, []*models.Metric{m1}))
+		require.NoError(t, store.AddBatch(ctx, []*models.Metric{m2}))
+
+		require.Len(t, publisher.published, 2)
+		assert.EqualValues(t, 5, *publisher.published[1].Delta)
+	})
+
+	t.Run("batch publishes the total after each write", func(t *testing.T) {
+		publisher.published = nil
+		delta1, delta2 := int64(1), int64(2)
+		require.NoError(t, store.AddBatch(ctx, []*models.Metric{
+			{Name: "c", Type: models.CounterType, Delta: &delta1},
+			{Name: "c", Type: models.CounterType, Delta: &delta2},
+		}))
+
+		require.Len(t, publisher.published, 2)
+		assert.EqualValues(t, 6, *publisher.published[0].Delta)
+		assert.EqualValues(t, 8, *publisher.published[1].Delta)
+		assert.EqualValues(t, 1, delta1, "received metrics are left untouched")
+	})
+
+	t.Run("failed write is not published", func(t *testing.T) {
+		publisher.published = nil
+		err := store.Add(ctx, &models.Metric{Name: "bad", Type: models.GaugeType})
+		require.Error(t, err)
+		assert.Empty(t, publisher.published)
+	})
+
+	t.Run("ping without database", func(t *testing.T) {
+		assert.Error(t, store.Ping(ctx))
+	})
+}
+
+// unreadableStorage fails every read, to check that writes are published without reading them back.
+type unreadableStorage struct {
+	*MemStorage
+}
+
+func (s unreadableStorage) Get(_ context.Context, _ models.MetricType, _ string) (*models.Metric, error) {
+	return nil, errors.New("unexpected read")
+}
+
+func TestPublishingStorage_DoesNotReadBack(t *testing.T) {
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	store := NewPublishingStorage(unreadableStorage{NewMemStorage()}, publisher)
+
+	delta := int64(2)
+	require.NoError(t, store.Add(ctx, &models.Metric{Name: "c", Type: models.CounterType, Delta: &delta}))
+	require.NoError(t, store.Add(ctx, &models.Metric{Name: "c", Type: models.CounterType, Delta: &delta}))
+
+	require.Len(t, publisher.published, 2)
+	assert.EqualValues(t, 4, *publisher.published[1].Delta)
+}
@@ -0,0 +1,50 @@
+// Package signature defines the material agents sign and the server verifies,
+// shared by the HTTP client and middlewares and the gRPC messages.
+//
+// A signed request carries the HMAC-SHA256 of
+//
+//	Version \n timestamp \n nonce \n body
+//
+// where the timestamp is the Unix time in seconds the request was signed at and
+// the nonce a random value unique to the request, so that the request cannot be replayed.
+// The messages of a gRPC stream share the timestamp and the nonce of the stream,
+// and are each signed with a nonce of their own, see MessageNonce.
+package signature
+
+import "strconv"
+
+const (
+	// Version starts the signed material, so its signature cannot pass for the signature
+	// of a body holding the same bytes, signed on its own.
+	Version = "alertme-v1"
+
+	// HashHeader is the header carrying the hex-encoded signature of the request or the response.
+	HashHeader = "HashSHA256"
+	// KeyIDHeader is the request header carrying the ID of the agent key the request is signed with.
+	KeyIDHeader = "KeyID"
+	// TimestampHeader is the request header carrying the Unix time in seconds the request was signed at.
+	TimestampHeader = "Timestamp"
+	// NonceHeader is the request header carrying a random value unique to the signed request.
+	NonceHeader = "Nonce"
+)
+
+// Material returns the data signed by a request signed at the timestamp with the nonce:
+// Version, the timestamp, the nonce and the body separated by newlines.
+func Material(timestamp, nonce string, body []byte) []byte {
+	material := make([]byte, 0, len(Version)+len(timestamp)+len(nonce)+len(body)+3)
+	material = append(material, Version...)
+	material = append(material, '\n')
+	material = append(material, timestamp...)
+	material = append(material, '\n')
+	material = append(material, nonce...)
+	material = append(material, '\n')
+	return append(material, body...)
+}
+
+// MessageNonce returns the nonce the message with the sequence number of a stream is signed with:
+// the nonce of the stream and the sequence number, counted from 0, separated by a slash.
+// Every message of the stream thus has a signature of its own, so messages cannot be
+// replayed or reordered within the stream, whose nonce is only checked once.
+func MessageNonce(nonce string, seq uint64) string {
+	return nonce + "/" + strconv.FormatUint(seq, 10)
+}
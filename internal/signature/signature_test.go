@@ -0,0 +1,36 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaterial(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		body      string
+		expected  string
+	}{
+		{
+			name:      "body",
+			timestamp: "1700000000",
+			nonce:     "abc",
+			body:      `[{"id":"m","type":"gauge","value":1}]`,
+			expected:  "alertme-v1\n1700000000\nabc\n" + `[{"id":"m","type":"gauge","value":1}]`,
+		},
+		{
+			name:      "empty body",
+			timestamp: "1700000000",
+			nonce:     "abc",
+			expected:  "alertme-v1\n1700000000\nabc\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, string(Material(test.timestamp, test.nonce, []byte(test.body))))
+		})
+	}
+}